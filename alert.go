@@ -0,0 +1,67 @@
+package naivehttpcache
+
+import "sync"
+
+// WithHitRatioAlert makes Transport call fn once the hit ratio of the last
+// window cacheable requests drops below threshold, see
+// Transport.OnLowHitRatio.
+func WithHitRatioAlert(window int, threshold float64, fn func(ratio float64)) Option {
+	return func(o *Options) {
+		o.HitRatioWindow = window
+		o.HitRatioThreshold = threshold
+		o.OnLowHitRatio = fn
+	}
+}
+
+// hitRatioWindow holds outcomes of the last Transport.HitRatioWindow
+// cacheable requests.
+type hitRatioWindow struct {
+	mu   sync.Mutex
+	hits []bool
+	// next is the index of the oldest outcome, which is replaced next.
+	next  int
+	count int
+	full  bool
+	// low is set once the ratio dropped below the threshold and it was
+	// reported, until it recovers.
+	low bool
+}
+
+// trackHitRatio records outcome of a successful round trip and reports the
+// hit ratio to OnLowHitRatio once it drops below HitRatioThreshold.
+func (t *Transport) trackHitRatio(outcome Outcome) {
+	if t.OnLowHitRatio == nil || t.HitRatioWindow <= 0 || outcome == OutcomeBypass {
+		return
+	}
+	hit := outcome != OutcomeMiss
+
+	w := &t.hitRatio
+	w.mu.Lock()
+	if w.hits == nil {
+		w.hits = make([]bool, t.HitRatioWindow)
+	}
+	if w.full && w.hits[w.next] {
+		w.count--
+	}
+	w.hits[w.next] = hit
+	if hit {
+		w.count++
+	}
+	w.next++
+	if w.next == len(w.hits) {
+		w.next = 0
+		w.full = true
+	}
+
+	ratio := float64(w.count) / float64(len(w.hits))
+	report := false
+	if w.full {
+		report = !w.low && ratio < t.HitRatioThreshold
+		w.low = ratio < t.HitRatioThreshold
+	}
+	w.mu.Unlock()
+
+	if report {
+		t.OnLowHitRatio(ratio)
+	}
+}
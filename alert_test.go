@@ -0,0 +1,45 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestHitRatioAlert(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	var alerts []float64
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithHitRatioAlert(4, 0.5, func(ratio float64) {
+				alerts = append(alerts, ratio)
+			}),
+		),
+	}
+
+	for i := 0; i < 4; i++ {
+		mustGet(t, client, ts.URL)
+	}
+	for _, path := range []string{"/b", "/c"} {
+		mustGet(t, client, ts.URL+path)
+	}
+	if len(alerts) != 0 {
+		t.Fatalf("expected no alerts while the ratio holds; got %v", alerts)
+	}
+
+	for _, path := range []string{"/d", "/e"} {
+		mustGet(t, client, ts.URL+path)
+	}
+	if len(alerts) != 1 || alerts[0] != 0.25 {
+		t.Fatalf("expected a single alert once the ratio dropped; got %v", alerts)
+	}
+}
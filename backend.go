@@ -0,0 +1,193 @@
+package naivehttpcache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// BackendErrorPolicy states what Transport does when operations of the cache
+// fail.
+type BackendErrorPolicy int
+
+const (
+	// BackendFailOpen treats failed reads as misses and ignores failed
+	// writes, so requests fall through to the network. This is the default.
+	BackendFailOpen BackendErrorPolicy = iota
+	// BackendFailClosed surfaces failures as *CacheError: failed reads fail
+	// RoundTrip and failed writes fail reading the response body.
+	BackendFailClosed
+)
+
+// CacheError is the error of a failed cache operation.
+type CacheError struct {
+	// Op is the operation: "get", "set" or "delete".
+	Op  string
+	Key string
+	Err error
+}
+
+func (e *CacheError) Error() string {
+	return "naivehttpcache: cache " + e.Op + " " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *CacheError) Unwrap() error {
+	return e.Err
+}
+
+// WithBackendErrorPolicy sets what happens when cache operations fail, see
+// BackendErrorPolicy.
+func WithBackendErrorPolicy(policy BackendErrorPolicy) Option {
+	return func(o *Options) {
+		o.BackendErrors = policy
+	}
+}
+
+// WithBackendTimeout limits the duration of cache operations.
+func WithBackendTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.BackendTimeout = timeout
+	}
+}
+
+// WithBackendDeadlines makes cache operations return once their contexts are
+// done, even if the cache ignores contexts, see Transport.BackendDeadlines.
+func WithBackendDeadlines() Option {
+	return func(o *Options) {
+		o.BackendDeadlines = true
+	}
+}
+
+// WithBackendErrorHandler sets a function that is called with every failed
+// cache operation, e.g. to count them.
+func WithBackendErrorHandler(fn func(err *CacheError)) Option {
+	return func(o *Options) {
+		o.OnBackendError = fn
+	}
+}
+
+// BackendErrorCount returns the number of cache operations of t that failed,
+// regardless of BackendErrorPolicy.
+func (t *Transport) BackendErrorCount() uint64 {
+	return atomic.LoadUint64(&t.backendErrors)
+}
+
+// cacheGet reads key from the cache. Error is only returned by
+// BackendFailClosed, otherwise failures are misses.
+func (t *Transport) cacheGet(ctx context.Context, key string) ([]byte, bool, error) {
+	if t.WriteBehind > 0 {
+		if val, ok := t.queuedVal(key); ok {
+			return val, true, nil
+		}
+	}
+	if bypass, err := t.bypassBackend("get", key); bypass {
+		return nil, false, err
+	}
+
+	ctx, cancel := t.backendContext(ctx)
+	defer cancel()
+	var val []byte
+	var ok bool
+	err := t.bounded(ctx, func() (err error) {
+		val, ok, err = t.Cache.Get(ctx, key)
+		return err
+	})
+	if err != nil {
+		return nil, false, t.backendError("get", key, err)
+	}
+	t.backendHealthy(true)
+	return val, ok, nil
+}
+
+// cacheSet writes val under key with ttl to the cache. Error is only returned
+// by BackendFailClosed.
+func (t *Transport) cacheSet(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	if bypass, err := t.bypassBackend("set", key); bypass {
+		t.countStore(ctx, false)
+		return err
+	}
+
+	if err := t.trySet(ctx, key, val, ttl); err != nil {
+		t.countStore(ctx, false)
+		return t.backendError("set", key, err)
+	}
+	t.countStore(ctx, true)
+	t.backendHealthy(true)
+	return nil
+}
+
+// trySet writes val under key with ttl to the cache, limited by
+// BackendTimeout, and returns the error of the cache as is.
+func (t *Transport) trySet(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	ctx, cancel := t.backendContext(ctx)
+	defer cancel()
+	return t.bounded(ctx, func() error {
+		return t.Cache.Set(ctx, key, val, ttl)
+	})
+}
+
+// cacheDelete deletes key from the cache. Error is only returned by
+// BackendFailClosed.
+func (t *Transport) cacheDelete(ctx context.Context, key string) error {
+	if t.WriteBehind > 0 {
+		if err := t.cancelWrite(ctx, key); err != nil {
+			return err
+		}
+	}
+	if bypass, err := t.bypassBackend("delete", key); bypass {
+		return err
+	}
+
+	ctx, cancel := t.backendContext(ctx)
+	defer cancel()
+	err := t.bounded(ctx, func() error {
+		return t.Cache.Delete(ctx, key)
+	})
+	if err != nil {
+		return t.backendError("delete", key, err)
+	}
+	t.backendHealthy(true)
+	return nil
+}
+
+// backendContext returns ctx limited by BackendTimeout.
+func (t *Transport) backendContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if t.BackendTimeout > 0 {
+		return context.WithTimeout(ctx, t.BackendTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// bounded calls op, the cache operation with ctx. By BackendDeadlines, it
+// returns the error of ctx as soon as it's done, leaving op to finish in the
+// background; results of op must not be used then.
+func (t *Transport) bounded(ctx context.Context, op func() error) error {
+	if !t.BackendDeadlines || ctx.Done() == nil {
+		return op()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- op()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// backendError records failed operation and returns the error that has to be
+// surfaced according to BackendErrors, if any.
+func (t *Transport) backendError(op, key string, err error) error {
+	atomic.AddUint64(&t.backendErrors, 1)
+	t.backendHealthy(false)
+	cacheErr := &CacheError{Op: op, Key: key, Err: err}
+	if t.OnBackendError != nil {
+		t.OnBackendError(cacheErr)
+	}
+	if t.BackendErrors == BackendFailClosed {
+		return cacheErr
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+var errBackend = errors.New("backend is down")
+
+// failingCache is Cache which operations fail while failing is set.
+type failingCache struct {
+	naivehttpcache.Cache
+	failing bool
+}
+
+func newFailingCache() *failingCache {
+	return &failingCache{
+		Cache:   naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		failing: true,
+	}
+}
+
+func (c *failingCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if c.failing {
+		return nil, false, errBackend
+	}
+	return c.Cache.Get(ctx, key)
+}
+
+func (c *failingCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	if c.failing {
+		return errBackend
+	}
+	return c.Cache.Set(ctx, key, val, ttl)
+}
+
+func (c *failingCache) Delete(ctx context.Context, key string) error {
+	if c.failing {
+		return errBackend
+	}
+	return c.Cache.Delete(ctx, key)
+}
+
+func TestBackendFailOpen(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	cache := newFailingCache()
+	var handled []string
+	transport := naivehttpcache.NewTransport(cache,
+		naivehttpcache.WithBackendErrorHandler(func(err *naivehttpcache.CacheError) {
+			handled = append(handled, err.Op)
+		}),
+	)
+	client := &http.Client{Transport: transport}
+
+	if _, body := mustGet(t, client, ts.URL); body != "ok" {
+		t.Fatalf("expected response from the server; got %q", body)
+	}
+	if n := transport.BackendErrorCount(); n != 2 || len(handled) != 2 || handled[0] != "get" || handled[1] != "set" {
+		t.Fatalf("expected failed get and set; got %d %v", n, handled)
+	}
+}
+
+func TestBackendFailClosed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	cache := newFailingCache()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(cache,
+			naivehttpcache.WithBackendErrorPolicy(naivehttpcache.BackendFailClosed),
+		),
+	}
+
+	var cacheErr *naivehttpcache.CacheError
+	_, err := client.Get(ts.URL)
+	if !errors.As(err, &cacheErr) || cacheErr.Op != "get" || !errors.Is(err, errBackend) {
+		t.Fatalf("expected failed get; got %v", err)
+	}
+
+	// reads work, but writes fail
+	cache.failing = false
+	resp, err := client.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.failing = true
+	defer resp.Body.Close()
+	_, err = ioutil.ReadAll(resp.Body)
+	if !errors.As(err, &cacheErr) || cacheErr.Op != "set" {
+		t.Fatalf("expected failed set; got %v", err)
+	}
+}
+
+// hungCache is MemoryCache which reads hang until release is closed,
+// whatever their contexts say.
+type hungCache struct {
+	*naivehttpcache.MemoryCache
+	release chan struct{}
+}
+
+func (c *hungCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	<-c.release
+	return c.MemoryCache.Get(ctx, key)
+}
+
+func TestBackendDeadlines(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	cache := &hungCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0), release: make(chan struct{})}
+	defer close(cache.release)
+	transport := naivehttpcache.NewTransport(cache,
+		naivehttpcache.WithBackendTimeout(20*time.Millisecond),
+		naivehttpcache.WithBackendDeadlines(),
+	)
+
+	done := make(chan string)
+	go func() {
+		resp, err := (&http.Client{Transport: transport}).Get(ts.URL)
+		if err != nil {
+			done <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		done <- string(body)
+	}()
+	select {
+	case body := <-done:
+		if body != "ok" {
+			t.Fatalf("expected the hung read to be a miss; got %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the hung read to be abandoned")
+	}
+	if transport.BackendErrorCount() != 1 {
+		t.Fatalf("expected the hung read to fail; got %d errors", transport.BackendErrorCount())
+	}
+}
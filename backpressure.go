@@ -0,0 +1,154 @@
+package naivehttpcache
+
+import (
+	"context"
+	"sync"
+)
+
+// WithStoreLimits limits the number of responses that are being stored at a
+// time to stores and the bytes buffered for storing them to bytes, see
+// Transport.MaxConcurrentStores.
+func WithStoreLimits(stores int, bytes int64) Option {
+	return func(o *Options) {
+		o.MaxConcurrentStores = stores
+		o.MaxStoreBytes = bytes
+	}
+}
+
+// ShedStoreCount returns the number of responses that were not stored
+// because of MaxConcurrentStores or MaxStoreBytes.
+func (t *Transport) ShedStoreCount() uint64 {
+	t.storeBudget.mu.Lock()
+	defer t.storeBudget.mu.Unlock()
+	return t.storeBudget.shed
+}
+
+// storeBudget tracks stores in flight for MaxConcurrentStores and
+// MaxStoreBytes.
+type storeBudget struct {
+	mu     sync.Mutex
+	stores int
+	bytes  int64
+	shed   uint64
+}
+
+// storeTicket is a store admitted by admitStore. Nil storeTicket is a store
+// that is not limited.
+type storeTicket struct {
+	t *Transport
+	// bytes is the number of bytes reserved by the store.
+	bytes    int64
+	shed     bool
+	released bool
+	// held is the number of queued writes of WriteBehind that keep bytes
+	// reserved after the release, until they are written.
+	held int
+}
+
+// storeTicketKey is the context key of storeTicket of a store.
+type storeTicketKey struct{}
+
+// withStoreTicket returns ctx of a store with ticket.
+func withStoreTicket(ctx context.Context, ticket *storeTicket) context.Context {
+	if ticket == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, storeTicketKey{}, ticket)
+}
+
+// storeTicketOf returns storeTicket of the store with ctx, nil if it's not
+// limited.
+func storeTicketOf(ctx context.Context) *storeTicket {
+	ticket, _ := ctx.Value(storeTicketKey{}).(*storeTicket)
+	return ticket
+}
+
+// admitStore admits a store of a response, false means that it has to be shed
+// because there are MaxConcurrentStores in flight already. The ticket must be
+// released once the store is done.
+func (t *Transport) admitStore() (*storeTicket, bool) {
+	if t.MaxConcurrentStores <= 0 && t.MaxStoreBytes <= 0 {
+		return nil, true
+	}
+
+	b := &t.storeBudget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t.MaxConcurrentStores > 0 && b.stores >= t.MaxConcurrentStores {
+		b.shed++
+		return nil, false
+	}
+	b.stores++
+	return &storeTicket{t: t}, true
+}
+
+// reserve reserves n more bytes buffered for the store, false means that they
+// don't fit into MaxStoreBytes and the store has to be shed.
+func (k *storeTicket) reserve(n int64) bool {
+	if k == nil {
+		return true
+	}
+
+	b := &k.t.storeBudget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if k.shed || k.released {
+		return false
+	}
+	if k.t.MaxStoreBytes > 0 && b.bytes+n > k.t.MaxStoreBytes {
+		k.shed = true
+		b.shed++
+		return false
+	}
+	b.bytes += n
+	k.bytes += n
+	return true
+}
+
+// release releases the bytes reserved by the store and its slot, it may be
+// called more than once. Bytes that are held stay reserved until unhold.
+func (k *storeTicket) release() {
+	if k == nil {
+		return
+	}
+
+	b := &k.t.storeBudget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if k.released {
+		return
+	}
+	k.released = true
+	if k.held == 0 {
+		b.bytes -= k.bytes
+	}
+	b.stores--
+}
+
+// hold keeps the bytes reserved by the store after its release, while the
+// value it stores waits in the queue of WriteBehind.
+func (k *storeTicket) hold() {
+	if k == nil {
+		return
+	}
+
+	b := &k.t.storeBudget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	k.held++
+}
+
+// unhold undoes hold, releasing the bytes if the store is released already.
+func (k *storeTicket) unhold() {
+	if k == nil {
+		return
+	}
+
+	b := &k.t.storeBudget
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	k.held--
+	if k.held == 0 && k.released {
+		b.bytes -= k.bytes
+	}
+}
@@ -0,0 +1,132 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestStoreLimits(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", len(r.URL.Path))))
+	}))
+	defer ts.Close()
+
+	t.Run("stores", func(t *testing.T) {
+		cache := naivehttpcache.NewMemoryCache(0, 0)
+		transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithStoreLimits(1, 0))
+		client := &http.Client{Transport: transport}
+
+		// the body of /a is being stored while it's not read to the end
+		resp, err := client.Get(ts.URL + "/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustGet(t, client, ts.URL+"/b")
+		if _, err := ioutil.ReadAll(resp.Body); err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		mustGet(t, client, ts.URL+"/c")
+
+		if cache.Len() != 2 || transport.ShedStoreCount() != 1 {
+			t.Fatalf("expected the store of /b to be shed; got %d entries and %d shed", cache.Len(), transport.ShedStoreCount())
+		}
+		if resp, _ := mustGet(t, client, ts.URL+"/b"); resp.Header.Get(naivehttpcache.XFromCache) == "1" {
+			t.Fatal("expected /b not to be cached")
+		}
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		cache := naivehttpcache.NewMemoryCache(0, 0)
+		transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithStoreLimits(0, 10))
+		client := &http.Client{Transport: transport}
+
+		mustGet(t, client, ts.URL+"/too/large/to/store")
+		if _, body := mustGet(t, client, ts.URL+"/small"); body != "xxxxxx" {
+			t.Fatalf("unexpected body %q", body)
+		}
+		if cache.Len() != 1 || transport.ShedStoreCount() != 1 {
+			t.Fatalf("expected the large store to be shed; got %d entries and %d shed", cache.Len(), transport.ShedStoreCount())
+		}
+	})
+
+	t.Run("eager", func(t *testing.T) {
+		cache := naivehttpcache.NewMemoryCache(0, 0)
+		transport := naivehttpcache.NewTransport(cache,
+			naivehttpcache.WithStoreLimits(0, 10),
+			naivehttpcache.WithEagerBuffering(1<<10),
+		)
+		client := &http.Client{Transport: transport}
+
+		if _, body := mustGet(t, client, ts.URL+"/too/large/to/store"); len(body) != len("/too/large/to/store") {
+			t.Fatalf("unexpected body %q", body)
+		}
+		mustGet(t, client, ts.URL+"/small")
+		if cache.Len() != 1 || transport.ShedStoreCount() != 1 {
+			t.Fatalf("expected the large store to be shed; got %d entries and %d shed", cache.Len(), transport.ShedStoreCount())
+		}
+	})
+
+	t.Run("partial", func(t *testing.T) {
+		ranged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(strings.Repeat("x", len(r.URL.Path))))
+		}))
+		defer ranged.Close()
+
+		cache := &blockingCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0), release: make(chan struct{})}
+		transport := naivehttpcache.NewTransport(cache,
+			naivehttpcache.WithStoreLimits(0, 15),
+			naivehttpcache.WithWriteBehind(16, 0),
+			naivehttpcache.WithPartialContent(),
+		)
+		client := &http.Client{Transport: transport}
+
+		// the range covers the whole representation, so it's queued as a
+		// full entry which keeps its bytes reserved
+		req, _ := http.NewRequest(http.MethodGet, ranged.URL+"/aaaaaaaaaa", nil)
+		req.Header.Set("Range", "bytes=0-")
+		if resp, _ := fetch(t, client, req); resp.StatusCode != http.StatusPartialContent {
+			t.Fatalf("expected 206; got %d", resp.StatusCode)
+		}
+		mustGet(t, client, ranged.URL+"/bbbbbbbbbb")
+		if transport.ShedStoreCount() != 1 {
+			t.Fatalf("expected the store of /bbbbbbbbbb to be shed; got %d shed", transport.ShedStoreCount())
+		}
+
+		close(cache.release)
+		transport.Close(context.Background())
+		if cache.Len() != 1 {
+			t.Fatalf("expected the range to be written as a full entry; got %d entries", cache.Len())
+		}
+	})
+
+	t.Run("write behind", func(t *testing.T) {
+		cache := &blockingCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0), release: make(chan struct{})}
+		transport := naivehttpcache.NewTransport(cache,
+			naivehttpcache.WithStoreLimits(0, 15),
+			naivehttpcache.WithWriteBehind(16, 0),
+		)
+		client := &http.Client{Transport: transport}
+
+		// the queued write of /aaaaaaaaaa keeps its bytes reserved
+		mustGet(t, client, ts.URL+"/aaaaaaaaaa")
+		mustGet(t, client, ts.URL+"/bbbbbbbbbb")
+		if transport.ShedStoreCount() != 1 {
+			t.Fatalf("expected the store of /bbbbbbbbbb to be shed; got %d shed", transport.ShedStoreCount())
+		}
+
+		close(cache.release)
+		transport.Close(context.Background())
+		mustGet(t, client, ts.URL+"/cccccccccc")
+		if cache.Len() != 2 || transport.ShedStoreCount() != 1 {
+			t.Fatalf("expected the bytes to be released once written; got %d entries and %d shed", cache.Len(), transport.ShedStoreCount())
+		}
+	})
+}
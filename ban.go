@@ -0,0 +1,162 @@
+package naivehttpcache
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Ban makes entries cached before now (see EntryMeta.CachedAt) for which
+// match returns true invalid, as Varnish bans do. Unlike PurgeFunc, it doesn't
+// need to enumerate the cache: entries are checked against bans when they are
+// looked up, and deleted if they match. Entries stored after the ban are not
+// affected. Both are timed by Clock, not by Date of responses, so clocks of
+// servers don't matter.
+//
+// Bans are kept until ReapBans drops them.
+func (t *Transport) Ban(match func(key string, meta EntryMeta) bool) {
+	t.bans.add(ban{match: match, at: t.now()})
+}
+
+// BanRegexp is Ban for entries URL of which (see KeyURL) matches expr.
+func (t *Transport) BanRegexp(expr string) error {
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return err
+	}
+	t.Ban(func(key string, _ EntryMeta) bool {
+		return re.MatchString(KeyURL(key))
+	})
+	return nil
+}
+
+// WithBanLifetime sets for how long bans are kept, see Transport.BanLifetime.
+func WithBanLifetime(lifetime time.Duration) Option {
+	return func(o *Options) {
+		o.BanLifetime = lifetime
+	}
+}
+
+// ReapBans drops bans that can't match anymore and returns the number of
+// dropped bans. Bans older than BanLifetime are dropped. If the cache
+// implements Walker, banned entries are deleted and all the bans made before
+// the walk are dropped, as no entry is left to check against them. Otherwise
+// bans are only dropped by BanLifetime.
+func (t *Transport) ReapBans(ctx context.Context) (int, error) {
+	dropped := 0
+	if t.BanLifetime > 0 {
+		dropped += t.bans.drop(t.now().Add(-t.BanLifetime))
+	}
+	if t.bans.len() == 0 {
+		return dropped, nil
+	}
+
+	start := t.now()
+	var err error
+	walkErr := t.walkEntries(ctx, func(key string, val []byte) bool {
+		_, err = t.unbanned(ctx, key, val)
+		return err == nil
+	})
+	if err == nil {
+		err = walkErr
+	}
+	if err == ErrNotWalkable {
+		return dropped, nil
+	}
+	if err != nil {
+		return dropped, err
+	}
+	return dropped + t.bans.drop(start), nil
+}
+
+// RunBanReaper reaps bans every interval until ctx is done, see ReapBans.
+// It's meant to be run in its own goroutine.
+func (t *Transport) RunBanReaper(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if _, err := t.ReapBans(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+}
+
+// unbanned reports whether entry val stored under key isn't banned. Banned
+// entries are deleted (unless Mode forbids writes). Values that can't be
+// decoded are not banned.
+func (t *Transport) unbanned(ctx context.Context, key string, val []byte) (bool, error) {
+	if t.bans.len() == 0 {
+		return true, nil
+	}
+	meta, err := t.entryMeta(key, val)
+	if err != nil || !t.bans.match(key, meta) {
+		return true, nil
+	}
+	if t.writes() {
+		if err := t.cacheDelete(ctx, key); err != nil {
+			return false, err
+		}
+		t.emit(EventInvalidate, key, 0)
+	}
+	return false, nil
+}
+
+type ban struct {
+	match func(key string, meta EntryMeta) bool
+	at    time.Time
+}
+
+// banList holds bans ordered by time.
+type banList struct {
+	mu   sync.RWMutex
+	bans []ban
+}
+
+func (l *banList) add(b ban) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.bans = append(l.bans, b)
+}
+
+func (l *banList) len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return len(l.bans)
+}
+
+// match reports whether entry with meta stored under key is banned. Entries
+// without CachedAt are older than any ban.
+func (l *banList) match(key string, meta EntryMeta) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	// later bans cover more entries, so they are checked first
+	for i := len(l.bans) - 1; i >= 0; i-- {
+		b := l.bans[i]
+		if !meta.CachedAt.Before(b.at) {
+			// so are all the earlier ones
+			break
+		}
+		if b.match(key, meta) {
+			return true
+		}
+	}
+	return false
+}
+
+// drop drops bans made before t and returns the number of dropped ones.
+func (l *banList) drop(t time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := 0
+	for n < len(l.bans) && l.bans[n].at.Before(t) {
+		n++
+	}
+	l.bans = append(l.bans[:0:0], l.bans[n:]...)
+	return n
+}
@@ -0,0 +1,112 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestBan(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithClock(clock))
+	client := &http.Client{Transport: transport}
+
+	for _, path := range []string{"/a/1", "/a/2", "/b"} {
+		mustGet(t, client, ts.URL+path)
+	}
+	clock.Advance(time.Second)
+	if err := transport.BanRegexp("/a/"); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Second)
+
+	mustGet(t, client, ts.URL+"/a/1")
+	mustGet(t, client, ts.URL+"/b")
+	if hits["/a/1"] != 2 || hits["/b"] != 1 {
+		t.Fatalf("expected only banned entries to be invalid; got %v", hits)
+	}
+	mustGet(t, client, ts.URL+"/a/1")
+	if hits["/a/1"] != 2 {
+		t.Fatalf("expected entries stored after the ban to be valid; got %d hits", hits["/a/1"])
+	}
+
+	dropped, err := transport.ReapBans(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 1 {
+		t.Fatalf("expected the ban to be dropped; got %d", dropped)
+	}
+	key := transport.CacheKey(httptest.NewRequest(http.MethodGet, ts.URL+"/a/2", nil))
+	if _, ok, _ := cache.Get(context.Background(), key); ok {
+		t.Fatal("expected banned entry to be deleted by ReapBans")
+	}
+}
+
+func TestBanServerClock(t *testing.T) {
+	clock := newFakeClock()
+	hits := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		// the clock of the server is off by an hour
+		skew := time.Hour
+		if r.URL.Path == "/behind" {
+			skew = -skew
+		}
+		w.Header().Set("Date", clock.Now().Add(skew).UTC().Format(http.TimeFormat))
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0), naivehttpcache.WithClock(clock))
+	client := &http.Client{Transport: transport}
+
+	mustGet(t, client, ts.URL+"/ahead")
+	clock.Advance(time.Second)
+	transport.Ban(func(key string, meta naivehttpcache.EntryMeta) bool { return true })
+	clock.Advance(time.Second)
+	mustGet(t, client, ts.URL+"/behind")
+
+	mustGet(t, client, ts.URL+"/ahead")
+	mustGet(t, client, ts.URL+"/behind")
+	if hits["/ahead"] != 2 || hits["/behind"] != 1 {
+		t.Fatalf("expected bans to be timed by the clock of Transport; got %v", hits)
+	}
+}
+
+func TestBanLifetime(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	// the cache can't be walked
+	cache := &ttlCache{Cache: naivehttpcache.NewMemoryCache(0, 0)}
+	transport := naivehttpcache.NewTransport(
+		cache,
+		naivehttpcache.WithClock(clock),
+		naivehttpcache.WithBanLifetime(time.Hour),
+	)
+
+	transport.Ban(func(key string, meta naivehttpcache.EntryMeta) bool { return true })
+	if dropped, err := transport.ReapBans(context.Background()); err != nil || dropped != 0 {
+		t.Fatalf("expected the ban to be kept within BanLifetime; got %d, %v", dropped, err)
+	}
+	clock.Advance(2 * time.Hour)
+	if dropped, err := transport.ReapBans(context.Background()); err != nil || dropped != 1 {
+		t.Fatalf("expected the ban to be dropped after BanLifetime; got %d, %v", dropped, err)
+	}
+}
@@ -0,0 +1,196 @@
+package naivehttpcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CacheItem is a value to store in a cache, see MultiSetter.
+type CacheItem struct {
+	Key string
+	Val []byte
+	// TTL is as ttl of Cache.Set.
+	TTL time.Duration
+}
+
+// MultiSetter is implemented by caches that can write many values at once,
+// e.g. pipelined in a single round trip to the backend. BatchingCache uses it,
+// otherwise values are written one by one.
+type MultiSetter interface {
+	// SetMulti stores values of items under their keys.
+	SetMulti(ctx context.Context, items []CacheItem) error
+}
+
+// SetMulti stores values of items under their keys.
+func (c *MemoryCache) SetMulti(ctx context.Context, items []CacheItem) error {
+	for _, item := range items {
+		if err := c.Set(ctx, item.Key, item.Val, item.TTL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BatchingCache is Cache that coalesces concurrent writes into batches, which
+// are written to Cache at once if it's MultiSetter (and concurrently
+// otherwise), for remote backends where round trips dominate the cost of
+// writes. A batch is written once it holds MaxBatch values or Delay after its
+// first write, whichever comes first. Set returns once its batch is written.
+//
+// Of writes of the same key in a batch, the last one wins, and Delete drops
+// the key from the pending batch or waits for the batch that is being written,
+// so that values never outlive their deletion. Batches are written regardless
+// of contexts of Set, which only tell when to stop waiting for them; timeouts
+// of the backend should be set on Cache.
+type BatchingCache struct {
+	Cache Cache
+	// MaxBatch, if positive, is the maximum number of values in a batch.
+	MaxBatch int
+	// Delay is for how long a batch waits for more values.
+	Delay time.Duration
+
+	mu      sync.Mutex
+	pending *setBatch
+	// writing holds batches that are being written by their keys.
+	writing map[string]*setBatch
+}
+
+// setBatch is a batch of writes of BatchingCache.
+type setBatch struct {
+	items map[string]CacheItem
+	timer *time.Timer
+	// taken is set once the batch is no longer pending.
+	taken bool
+	// errs holds errors of keys once done is closed.
+	errs map[string]error
+	done chan struct{}
+}
+
+// NewBatchingCache returns BatchingCache that writes to cache batches of at
+// most maxBatch values, waiting for at most delay for them.
+func NewBatchingCache(cache Cache, maxBatch int, delay time.Duration) *BatchingCache {
+	return &BatchingCache{Cache: cache, MaxBatch: maxBatch, Delay: delay}
+}
+
+func (c *BatchingCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.Cache.Get(ctx, key)
+}
+
+func (c *BatchingCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	b := c.pending
+	if b == nil {
+		b = &setBatch{items: make(map[string]CacheItem), done: make(chan struct{})}
+		b.timer = time.AfterFunc(c.Delay, func() { c.write(b) })
+		c.pending = b
+	}
+	b.items[key] = CacheItem{Key: key, Val: val, TTL: ttl}
+	full := c.MaxBatch > 0 && len(b.items) >= c.MaxBatch
+	c.mu.Unlock()
+
+	if full {
+		b.timer.Stop()
+		c.write(b)
+	}
+
+	select {
+	case <-b.done:
+		return b.errs[key]
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *BatchingCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	if c.pending != nil {
+		delete(c.pending.items, key)
+	}
+	b := c.writing[key]
+	c.mu.Unlock()
+
+	if b != nil {
+		select {
+		case <-b.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return c.Cache.Delete(ctx, key)
+}
+
+// Walk calls fn with keys of the cache that start with prefix until it
+// returns false. Cache must implement Walker, otherwise ErrNotWalkable is
+// returned.
+func (c *BatchingCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	walker, ok := c.Cache.(Walker)
+	if !ok {
+		return ErrNotWalkable
+	}
+	return walker.Walk(ctx, prefix, fn)
+}
+
+// write writes batch b, unless it's already taken.
+func (c *BatchingCache) write(b *setBatch) {
+	c.mu.Lock()
+	if b.taken {
+		c.mu.Unlock()
+		return
+	}
+	b.taken = true
+	if c.pending == b {
+		c.pending = nil
+	}
+	if c.writing == nil {
+		c.writing = make(map[string]*setBatch)
+	}
+	items := make([]CacheItem, 0, len(b.items))
+	for key, item := range b.items {
+		items = append(items, item)
+		c.writing[key] = b
+	}
+	c.mu.Unlock()
+
+	b.errs = c.setMulti(items)
+
+	c.mu.Lock()
+	for _, item := range items {
+		if c.writing[item.Key] == b {
+			delete(c.writing, item.Key)
+		}
+	}
+	c.mu.Unlock()
+	close(b.done)
+}
+
+// setMulti writes items to Cache and returns errors of their keys.
+func (c *BatchingCache) setMulti(items []CacheItem) map[string]error {
+	ctx := context.Background()
+	errs := make(map[string]error)
+	if setter, ok := c.Cache.(MultiSetter); ok {
+		if err := setter.SetMulti(ctx, items); err != nil {
+			for _, item := range items {
+				errs[item.Key] = err
+			}
+		}
+		return errs
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, item := range items {
+		item := item
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := c.Cache.Set(ctx, item.Key, item.Val, item.TTL); err != nil {
+				mu.Lock()
+				errs[item.Key] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,109 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+// batchCache records batches written to MemoryCache.
+type batchCache struct {
+	*naivehttpcache.MemoryCache
+	mu      sync.Mutex
+	batches []int
+}
+
+func (c *batchCache) SetMulti(ctx context.Context, items []naivehttpcache.CacheItem) error {
+	c.mu.Lock()
+	c.batches = append(c.batches, len(items))
+	c.mu.Unlock()
+	return c.MemoryCache.SetMulti(ctx, items)
+}
+
+func TestBatchingCache(t *testing.T) {
+	ctx := context.Background()
+	set := func(t *testing.T, cache naivehttpcache.Cache, n int) {
+		t.Helper()
+		var wg sync.WaitGroup
+		errs := make(chan error, n)
+		for i := 0; i < n; i++ {
+			i := i
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- cache.Set(ctx, strconv.Itoa(i), []byte("hello"), 0)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("full", func(t *testing.T) {
+		backend := &batchCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0)}
+		set(t, naivehttpcache.NewBatchingCache(backend, 5, time.Hour), 10)
+		if len(backend.batches) != 2 || backend.batches[0] != 5 || backend.batches[1] != 5 {
+			t.Fatalf("expected 2 batches of 5; got %v", backend.batches)
+		}
+		if backend.Len() != 10 {
+			t.Fatalf("expected 10 entries; got %d", backend.Len())
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		backend := &batchCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0)}
+		set(t, naivehttpcache.NewBatchingCache(backend, 0, 50*time.Millisecond), 3)
+		if backend.Len() != 3 {
+			t.Fatalf("expected 3 entries; got %d", backend.Len())
+		}
+		if len(backend.batches) > 2 {
+			t.Fatalf("expected writes to be batched; got %v", backend.batches)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		backend := naivehttpcache.NewMemoryCache(0, 0)
+		cache := naivehttpcache.NewBatchingCache(backend, 0, 50*time.Millisecond)
+		done := make(chan error)
+		go func() { done <- cache.Set(ctx, "a", []byte("hello"), 0) }()
+		// let Set make it into the batch
+		time.Sleep(10 * time.Millisecond)
+		if err := cache.Delete(ctx, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if _, ok, _ := cache.Get(ctx, "a"); ok {
+			t.Fatal("expected deleted value to stay deleted")
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		backend := httpcache.NewMemoryCache()
+		set(t, naivehttpcache.NewBatchingCache(naivehttpcache.FromHTTPCache(backend), 4, time.Hour), 8)
+		for i := 0; i < 8; i++ {
+			if _, ok := backend.Get(strconv.Itoa(i)); !ok {
+				t.Fatalf("expected %d to be stored", i)
+			}
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		cache := naivehttpcache.NewBatchingCache(naivehttpcache.NewMemoryCache(0, 0), 0, time.Hour)
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := cache.Set(ctx, "a", []byte("hello"), 0); err != context.DeadlineExceeded {
+			t.Fatalf("expected DeadlineExceeded; got %v", err)
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package naivehttpcache
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// SeekableBody is implemented by bodies of responses served from the cache.
+type SeekableBody interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+}
+
+// Seekable returns body of resp as SeekableBody, so the cached payload can be
+// re-read or read at random without buffering it once again.
+// False is returned if resp didn't come from the cache or if its body was
+// wrapped, e.g. by transparent decompression or by http.Client with Timeout.
+func Seekable(resp *http.Response) (SeekableBody, bool) {
+	body, ok := resp.Body.(*cachedBody)
+	return body, ok
+}
+
+// cachedBody is a body of a response served from the cache. It implements
+// io.WriterTo (of bytes.Reader), so io.Copy to the network writes the cached
+// payload at once, without copying it through an intermediate buffer.
+type cachedBody struct {
+	*bytes.Reader
+	b []byte
+}
+
+func newCachedBody(b []byte) *cachedBody {
+	return &cachedBody{Reader: bytes.NewReader(b), b: b}
+}
+
+func (*cachedBody) Close() error {
+	return nil
+}
+
+// readBody reads the whole body and closes it. Cached bodies are not copied.
+func readBody(body io.ReadCloser) ([]byte, error) {
+	defer body.Close()
+	if cb, ok := body.(*cachedBody); ok && int64(cb.Len()) == cb.Size() {
+		return cb.b, nil
+	}
+	return ioutil.ReadAll(body)
+}
@@ -0,0 +1,71 @@
+package naivehttpcache_test
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestSeekable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()))
+	httpClient := &http.Client{Transport: transport}
+
+	resp, _ := mustGet(t, httpClient, ts.URL)
+	if _, ok := naivehttpcache.Seekable(resp); ok {
+		t.Fatal("expected response from server to not be seekable")
+	}
+
+	resp, err := httpClient.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, ok := naivehttpcache.Seekable(resp)
+	if !ok {
+		t.Fatal("expected cached response to be seekable")
+	}
+
+	p := make([]byte, 5)
+	if _, err := body.ReadAt(p, 6); err != nil || string(p) != "world" {
+		t.Fatalf("expected world at 6; got %q (%v)", p, err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := body.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := ioutil.ReadAll(body); err != nil || string(b) != "hello world" {
+			t.Fatalf("expected hello world; got %q (%v)", b, err)
+		}
+	}
+}
+
+func TestCachedBodyWriterTo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache())),
+	}
+	mustGet(t, httpClient, ts.URL)
+
+	resp, err := httpClient.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, ok := resp.Body.(io.WriterTo); !ok {
+		t.Fatalf("expected cached body to implement io.WriterTo; got %T", resp.Body)
+	}
+}
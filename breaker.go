@@ -0,0 +1,136 @@
+package naivehttpcache
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is the error of requests that are not sent to the server,
+// because its circuit is open, see Transport.BreakerThreshold.
+var ErrCircuitOpen = errors.New("naivehttpcache: circuit of the origin is open")
+
+// DefaultBreakerCooldown is the default Transport.BreakerCooldown.
+const DefaultBreakerCooldown = 30 * time.Second
+
+// WithCircuitBreaker makes Transport stop sending requests to a host after
+// threshold consecutive failures of it for cooldown, see
+// Transport.BreakerThreshold.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(o *Options) {
+		o.BreakerThreshold = threshold
+		o.BreakerCooldown = cooldown
+	}
+}
+
+// WithCircuitHandler sets a function that is called whenever the circuit of a
+// host opens or closes, e.g. to log it.
+func WithCircuitHandler(fn func(host string, open bool)) Option {
+	return func(o *Options) {
+		o.OnCircuit = fn
+	}
+}
+
+// circuitBreaker holds circuits of hosts that failed lately.
+type circuitBreaker struct {
+	mu    sync.Mutex
+	hosts map[string]*circuit
+}
+
+type circuit struct {
+	// failures is the number of consecutive failures.
+	failures int
+	open     bool
+	// probeAt is when a request may be sent to check the host again.
+	probeAt time.Time
+	// probing is set while such request is in flight.
+	probing bool
+}
+
+func (t *Transport) breakerCooldown() time.Duration {
+	if t.BreakerCooldown > 0 {
+		return t.BreakerCooldown
+	}
+	return DefaultBreakerCooldown
+}
+
+// allowOrigin reports whether a request may be sent to host. Once the circuit
+// of it is open, a single request is let through every cooldown to probe it.
+func (t *Transport) allowOrigin(host string) bool {
+	if t.BreakerThreshold <= 0 {
+		return true
+	}
+
+	b := &t.breaker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.hosts[host]
+	if c == nil || !c.open {
+		return true
+	}
+	if c.probing || t.now().Before(c.probeAt) {
+		return false
+	}
+	c.probing = true
+	return true
+}
+
+// originResult records the outcome of request req to the server. Failures are
+// errors and 5xx responses; requests canceled by their callers don't count.
+func (t *Transport) originResult(req *http.Request, resp *http.Response, err error) {
+	if t.BreakerThreshold <= 0 {
+		return
+	}
+	host := req.URL.Host
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+
+	if err != nil && req.Context().Err() != nil {
+		t.abandonOrigin(host)
+		return
+	}
+
+	b := &t.breaker
+	b.mu.Lock()
+	c := b.hosts[host]
+	changed, open := false, false
+	switch {
+	case !failed:
+		if c != nil {
+			changed = c.open
+			delete(b.hosts, host)
+		}
+	default:
+		if c == nil {
+			if b.hosts == nil {
+				b.hosts = map[string]*circuit{}
+			}
+			c = &circuit{}
+			b.hosts[host] = c
+		}
+		c.failures++
+		c.probing = false
+		if c.open || c.failures >= t.BreakerThreshold {
+			changed = !c.open
+			c.open = true
+			c.probeAt = t.now().Add(t.breakerCooldown())
+		}
+		open = c.open
+	}
+	b.mu.Unlock()
+
+	if changed && t.OnCircuit != nil {
+		t.OnCircuit(host, open)
+	}
+}
+
+// abandonOrigin records that a request allowed by allowOrigin was not sent
+// after all, or that it doesn't tell anything about host.
+func (t *Transport) abandonOrigin(host string) {
+	b := &t.breaker
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.hosts[host]; c != nil {
+		c.probing = false
+	}
+}
@@ -0,0 +1,93 @@
+package naivehttpcache_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	failing := true
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	var changes []bool
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithMaxAge(time.Minute),
+			// failures must reach the breaker rather than the cache
+			naivehttpcache.WithStatusTTLs(map[int]time.Duration{http.StatusServiceUnavailable: 0}),
+			naivehttpcache.WithClock(clock),
+			naivehttpcache.WithCircuitBreaker(2, time.Minute),
+			naivehttpcache.WithCircuitHandler(func(host string, open bool) {
+				changes = append(changes, open)
+			}),
+		),
+	}
+
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	if _, err := client.Get(ts.URL); !errors.Is(err, naivehttpcache.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen; got %v", err)
+	}
+	if requests != 2 {
+		t.Fatalf("expected requests to stop after 2 failures; got %d", requests)
+	}
+
+	failing = false
+	clock.Advance(time.Minute)
+	if resp, body := mustGet(t, client, ts.URL); resp.StatusCode != http.StatusOK || body != "hello" {
+		t.Fatalf("expected probe to pass; got %d %q", resp.StatusCode, body)
+	}
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Fatalf("expected circuit to open and close; got %v", changes)
+	}
+}
+
+func TestCircuitBreakerServesStale(t *testing.T) {
+	failing := false
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithRevalidate(),
+			naivehttpcache.WithClock(clock),
+			naivehttpcache.WithCircuitBreaker(1, time.Minute),
+		),
+	}
+
+	mustGet(t, client, ts.URL)
+	failing = true
+	clock.Advance(2 * time.Minute)
+	// fails, the response from the server is returned as is
+	mustGet(t, client, ts.URL+"/other")
+
+	resp, body := mustGet(t, client, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != "hello" {
+		t.Fatalf("expected stale entry while circuit is open; got %d %q", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,90 @@
+package naivehttpcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gregjones/httpcache"
+)
+
+// Cache stores encoded responses of Transport. Errors are handled according
+// to Transport.BackendErrors.
+type Cache interface {
+	// Get returns the value stored under key, if any.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Set stores val under key. Positive ttl is how long the value is useful
+	// for, the cache may drop it afterwards. Zero means that it's useful for
+	// as long as the cache can keep it.
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration) error
+	// Delete deletes the value stored under key, if any.
+	Delete(ctx context.Context, key string) error
+}
+
+// FromHTTPCache adapts cache of httpcache package (or any other implementing
+// its interface) to Cache. It never fails and ignores contexts and ttls.
+func FromHTTPCache(cache httpcache.Cache) Cache {
+	return httpCache{cache}
+}
+
+// httpCache is Cache on top of httpcache.Cache.
+type httpCache struct {
+	cache httpcache.Cache
+}
+
+func (c httpCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	val, ok := c.cache.Get(key)
+	return val, ok, nil
+}
+
+func (c httpCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	c.cache.Set(key, val)
+	return nil
+}
+
+func (c httpCache) Delete(ctx context.Context, key string) error {
+	c.cache.Delete(key)
+	return nil
+}
+
+// CacheKey returns the key under which response to req is stored in the cache
+// of t.
+func (t *Transport) CacheKey(req *http.Request) string {
+	return t.cacheKey(t.withAcceptEncoding(t.normalize(req)))
+}
+
+// cacheKeyContextKey is the context key of ContextWithCacheKey.
+type cacheKeyContextKey struct{}
+
+// ContextWithCacheKey returns ctx that makes requests with it be cached under
+// key instead of their URL, e.g. when URLs carry ephemeral signatures but the
+// resource is stable. The key is still narrowed down by partitions and such,
+// KeyURL of it returns key. Spaces of key are escaped.
+func ContextWithCacheKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, cacheKeyContextKey{}, strings.ReplaceAll(key, " ", "%20"))
+}
+
+// KeyURL returns URL of the request that key belongs to. Keys may also carry
+// other parts (e.g. a partition), but URL is always the last one.
+func KeyURL(key string) string {
+	return key[strings.LastIndexByte(key, ' ')+1:]
+}
+
+// errNoDate is returned by responseDate for responses without Date header,
+// and for entries that don't tell when they were stored.
+var errNoDate = errors.New("naivehttpcache: no Date header")
+
+// responseDate returns Date of response with header. Besides the preferred
+// format, obsolete ones that HTTP recipients must accept are parsed too.
+func responseDate(header http.Header) (time.Time, error) {
+	date := header.Get("date")
+	if date == "" {
+		return time.Time{}, errNoDate
+	}
+	if t, err := time.Parse(time.RFC1123, date); err == nil {
+		return t, nil
+	}
+	return http.ParseTime(date)
+}
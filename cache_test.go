@@ -0,0 +1,95 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+// ttlCache is naivehttpcache.Cache remembering the last ttl it was given.
+type ttlCache struct {
+	naivehttpcache.Cache
+	ttl time.Duration
+}
+
+func (c *ttlCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	c.ttl = ttl
+	return c.Cache.Set(ctx, key, val, ttl)
+}
+
+func TestCacheTTL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		name string
+		opts []naivehttpcache.Option
+		min  time.Duration
+		max  time.Duration
+	}{
+		{"forever", nil, 0, 0},
+		{"max age", []naivehttpcache.Option{naivehttpcache.WithMaxAge(time.Hour)}, time.Hour - time.Minute, time.Hour},
+		{"revalidate", []naivehttpcache.Option{naivehttpcache.WithMaxAge(time.Hour), naivehttpcache.WithRevalidate()}, 0, 0},
+	} {
+		cache := &ttlCache{Cache: naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache())}
+		client := &http.Client{Transport: naivehttpcache.NewTransport(cache, tc.opts...)}
+		mustGet(t, client, ts.URL)
+		if cache.ttl < tc.min || cache.ttl > tc.max {
+			t.Errorf("%s: expected ttl within [%v, %v]; got %v", tc.name, tc.min, tc.max, cache.ttl)
+		}
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	transport := naivehttpcache.NewTransport(
+		naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithPartition(func(ctx context.Context) string {
+			tenant, _ := ctx.Value(tenantKey{}).(string)
+			return tenant
+		}),
+	)
+
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/a?b=c", nil)
+	req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "acme"))
+	key := transport.CacheKey(req)
+	if key == req.URL.String() {
+		t.Fatalf("expected key to be partitioned; got %q", key)
+	}
+	if got := naivehttpcache.KeyURL(key); got != req.URL.String() {
+		t.Fatalf("expected %q; got %q", req.URL.String(), got)
+	}
+}
+
+func TestContextWithCacheKey(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(
+		naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithMaxAge(time.Minute),
+	)
+	client := &http.Client{Transport: transport}
+
+	ctx := naivehttpcache.ContextWithCacheKey(context.Background(), "avatar 123")
+	for _, signature := range []string{"a", "b"} {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/avatar?signature="+signature, nil)
+		fetch(t, client, req)
+		if key := transport.CacheKey(req); naivehttpcache.KeyURL(key) != "avatar%20123" {
+			t.Fatalf("expected overridden key; got %q", key)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("expected 1 request to the server; got %d", hits)
+	}
+}
@@ -0,0 +1,59 @@
+package naivehttpcache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds parsed Cache-Control directives. Directives without a
+// value are present with an empty value.
+type cacheControl map[string]string
+
+// parseCacheControl parses Cache-Control header(s) of h.
+// It's based on parseCacheControl from httpcache package
+// https://github.com/gregjones/httpcache/blob/901d90724c7919163f472a9812253fb26761123d/httpcache.go#L481
+// but also handles multiple header lines and quoted values.
+func parseCacheControl(h http.Header) cacheControl {
+	return parseDirectives(h.Values("cache-control"))
+}
+
+// parseDirectives parses lines of Cache-Control like header.
+func parseDirectives(lines []string) cacheControl {
+	cc := cacheControl{}
+	for _, line := range lines {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				key := strings.ToLower(strings.TrimSpace(part[:i]))
+				cc[key] = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+			} else {
+				cc[strings.ToLower(part)] = ""
+			}
+		}
+	}
+	return cc
+}
+
+// has reports whether directive is present.
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns value of directive parsed as delta-seconds.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
@@ -0,0 +1,72 @@
+package naivehttpcache
+
+import "net/http"
+
+// Middleware wraps a RoundTripper, e.g. to retry, authenticate or log
+// requests.
+//
+// Where a middleware goes relative to Transport decides what it sees. Client
+// middlewares (see Transport.Wrap) see every request and every response,
+// including those served from the cache (see FromResponse), and anything
+// they change in requests affects cache keys. Origin middlewares (see
+// WithOriginMiddleware) only see requests that Transport sends to the server
+// (misses, revalidations and refreshes), and their changes are invisible to
+// the cache. So, as a rule:
+//
+//   - retries go to the origin, so cached responses are never retried and a
+//     retried request is stored once;
+//   - credentials that identify a user go to the client, so that Partition
+//     and Authorization see them, rather than responses of one user being
+//     stored under keys shared by all of them;
+//   - credentials of the client itself (e.g. signing of requests) go to the
+//     origin, so they don't fragment the cache;
+//   - logging and metrics go to the client to see hits, and to the origin to
+//     see the traffic of the server.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// Chain returns rt wrapped into middlewares, the first one of them being the
+// outermost. Nil rt means http.DefaultTransport. The returned RoundTripper
+// closes idle connections of rt, see Transport.CloseIdleConnections.
+func Chain(rt http.RoundTripper, middlewares ...Middleware) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	wrapped := rt
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		wrapped = middlewares[i](wrapped)
+	}
+	return chain{RoundTripper: wrapped, base: rt}
+}
+
+// WithOriginMiddleware wraps Transport.Transport into middlewares, the first
+// one of them being the outermost, so they only see requests sent to the
+// server, see Middleware. It applies to Transport of WithTransport regardless
+// of the order of options.
+func WithOriginMiddleware(middlewares ...Middleware) Option {
+	return func(o *Options) {
+		o.OriginMiddleware = append(o.OriginMiddleware, middlewares...)
+	}
+}
+
+// Wrap returns t wrapped into client middlewares, the first one of them being
+// the outermost, so they see every request and response of t, see Middleware.
+func (t *Transport) Wrap(middlewares ...Middleware) http.RoundTripper {
+	return Chain(t, middlewares...)
+}
+
+// chain is RoundTripper wrapped into middlewares by Chain.
+type chain struct {
+	http.RoundTripper
+	base http.RoundTripper
+}
+
+// CloseIdleConnections closes idle connections of the wrapped RoundTripper,
+// if it supports that.
+func (c chain) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if ci, ok := c.base.(closeIdler); ok {
+		ci.CloseIdleConnections()
+	}
+}
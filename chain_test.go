@@ -0,0 +1,54 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestMiddleware(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Signature", r.Header.Get("X-Signature"))
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	var seen []string
+	record := func(name string) naivehttpcache.Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				seen = append(seen, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	sign := func(next http.RoundTripper) http.RoundTripper {
+		return roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			req.Header.Set("X-Signature", "signed")
+			return next.RoundTrip(req)
+		})
+	}
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithOriginMiddleware(record("origin"), sign),
+	)
+	client := &http.Client{Transport: transport.Wrap(record("client1"), record("client2"))}
+
+	for i := 0; i < 2; i++ {
+		resp, _ := mustGet(t, client, ts.URL)
+		if sig := resp.Header.Get("X-Signature"); sig != "signed" {
+			t.Fatalf("expected requests to the server to be signed; got %q", sig)
+		}
+	}
+	want := []string{"client1", "client2", "origin", "client1", "client2"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Fatalf("expected middlewares to see %q; got %q", want, seen)
+	}
+	client.CloseIdleConnections()
+}
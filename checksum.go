@@ -0,0 +1,82 @@
+package naivehttpcache
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// CorruptEntryPolicy states what Transport does with cached entries that are
+// corrupt (e.g. truncated by the backend or damaged on disk) or can't be
+// decoded.
+type CorruptEntryPolicy int
+
+const (
+	// CorruptEntryMiss deletes corrupt entries and treats them as misses, so
+	// requests fall through to the network. This is the default.
+	CorruptEntryMiss CorruptEntryPolicy = iota
+	// CorruptEntryFail fails RoundTrip with the error of the entry and keeps
+	// it in the cache.
+	CorruptEntryFail
+)
+
+// WithCorruptEntryPolicy sets what happens to corrupt entries, see
+// CorruptEntryPolicy.
+func WithCorruptEntryPolicy(policy CorruptEntryPolicy) Option {
+	return func(o *Options) {
+		o.CorruptEntries = policy
+	}
+}
+
+// WithCorruptEntryHandler sets a function that is called with keys of corrupt
+// entries and their errors instead of logging them.
+func WithCorruptEntryHandler(fn func(key string, err error)) Option {
+	return func(o *Options) {
+		o.OnCorruptEntry = fn
+	}
+}
+
+// CorruptEntryCount returns the number of entries of t that were found to be
+// corrupt when they were looked up, regardless of CorruptEntries.
+func (t *Transport) CorruptEntryCount() uint64 {
+	return atomic.LoadUint64(&t.corruptEntries)
+}
+
+// intact reports whether entry val stored under key is intact, see
+// verifyEntry and verifyPartialEntry. Corrupt entries are handled by corrupt.
+func (t *Transport) intact(ctx context.Context, key string, val []byte) (bool, error) {
+	if verifyEntry(val) && verifyPartialEntry(val) {
+		return true, nil
+	}
+	return false, t.corrupt(ctx, key, errCorruptEntry)
+}
+
+// decode returns the response to req stored in entry val under key and when
+// it was stored. False means that the entry can't be decoded, see corrupt.
+func (t *Transport) decode(req *http.Request, key string, val []byte) (*http.Response, time.Time, bool, error) {
+	resp, storedAt, err := decodeResponse(val, req)
+	if err != nil {
+		return nil, time.Time{}, false, t.corrupt(req.Context(), key, err)
+	}
+	return resp, storedAt, true, nil
+}
+
+// corrupt records that entry under key is corrupt because of err and returns
+// the error that has to be surfaced according to CorruptEntries, if any.
+func (t *Transport) corrupt(ctx context.Context, key string, err error) error {
+	atomic.AddUint64(&t.corruptEntries, 1)
+	if t.OnCorruptEntry != nil {
+		t.OnCorruptEntry(key, err)
+	} else {
+		log.Printf("naivehttpcache: corrupt cache entry %s: %v", key, err)
+	}
+	if t.CorruptEntries == CorruptEntryFail {
+		return err
+	}
+	if t.writes() {
+		return t.cacheDelete(ctx, key)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestCorruptEntry(t *testing.T) {
+	tsHits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsHits++
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	corrupt := map[string]func(val []byte) []byte{
+		"flipped": func(val []byte) []byte {
+			val = append([]byte(nil), val...)
+			val[len(val)-1] ^= 1
+			return val
+		},
+		"truncated": func(val []byte) []byte {
+			return val[:len(val)-2]
+		},
+	}
+	for name, corrupt := range corrupt {
+		corrupt := corrupt
+		t.Run(name, func(t *testing.T) {
+			tsHits = 0
+			cache := naivehttpcache.NewMemoryCache(0, 0)
+			transport := naivehttpcache.NewTransport(cache,
+				naivehttpcache.WithCorruptEntryHandler(func(key string, err error) {}),
+			)
+			client := &http.Client{Transport: transport}
+
+			mustGet(t, client, ts.URL)
+			key := transport.CacheKey(httptest.NewRequest(http.MethodGet, ts.URL, nil))
+			val, ok, _ := cache.Get(ctx, key)
+			if !ok {
+				t.Fatal("expected the response to be stored")
+			}
+			cache.Set(ctx, key, corrupt(val), 0)
+
+			resp, body := mustGet(t, client, ts.URL)
+			if resp.Header.Get(naivehttpcache.XFromCache) == "1" || body != "hello" || tsHits != 2 {
+				t.Fatalf("expected the corrupt entry to be a miss; got %q", body)
+			}
+			if transport.CorruptEntryCount() != 1 {
+				t.Fatalf("expected 1 corrupt entry; got %d", transport.CorruptEntryCount())
+			}
+			if resp, _ := mustGet(t, client, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+				t.Fatal("expected the entry to be stored again")
+			}
+		})
+	}
+}
+
+func TestUndecodableEntry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	var handled []string
+	transport := naivehttpcache.NewTransport(cache,
+		naivehttpcache.WithCorruptEntryHandler(func(key string, err error) {
+			handled = append(handled, key)
+		}),
+	)
+	client := &http.Client{Transport: transport}
+
+	// neither an entry nor a dumped response
+	cache.Set(ctx, ts.URL, []byte("garbage"), 0)
+	resp, body := mustGet(t, client, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) == "1" || body != "hello" {
+		t.Fatalf("expected the unreadable entry to be a miss; got %q", body)
+	}
+	if len(handled) != 1 || handled[0] != ts.URL || transport.CorruptEntryCount() != 1 {
+		t.Fatalf("expected the unreadable entry to be handled; got %q", handled)
+	}
+	if resp, _ := mustGet(t, client, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected the entry to be replaced")
+	}
+
+	transport.CorruptEntries = naivehttpcache.CorruptEntryFail
+	cache.Set(ctx, ts.URL, []byte("garbage"), 0)
+	if _, err := client.Get(ts.URL); err == nil {
+		t.Fatal("expected the unreadable entry to fail the request")
+	}
+	if _, ok, _ := cache.Get(ctx, ts.URL); !ok {
+		t.Fatal("expected the unreadable entry to be kept")
+	}
+}
+
+func TestCorruptPartialEntry(t *testing.T) {
+	tsHits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsHits++
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte(rangeContent)))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	var handled []string
+	transport := naivehttpcache.NewTransport(cache,
+		naivehttpcache.WithPartialContent(),
+		naivehttpcache.WithCorruptEntryHandler(func(key string, err error) {
+			handled = append(handled, key)
+		}),
+	)
+	client := &http.Client{Transport: transport}
+	get := func() *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("Range", "bytes=0-4")
+		resp, body := fetch(t, client, req)
+		if body != "01234" {
+			t.Fatalf("unexpected body %q", body)
+		}
+		return resp
+	}
+
+	get()
+	key := "partial " + transport.CacheKey(httptest.NewRequest(http.MethodGet, ts.URL, nil))
+	val, ok, _ := cache.Get(ctx, key)
+	if !ok {
+		t.Fatal("expected the range to be stored")
+	}
+	cache.Set(ctx, key, val[:len(val)-2], 0)
+
+	if resp := get(); resp.Header.Get(naivehttpcache.XFromCache) == "1" || tsHits != 2 {
+		t.Fatal("expected the corrupt ranges to be a miss")
+	}
+	if len(handled) != 1 || handled[0] != key || transport.CorruptEntryCount() != 1 {
+		t.Fatalf("expected the corrupt ranges to be handled; got %q", handled)
+	}
+	if resp := get(); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected the range to be stored again")
+	}
+}
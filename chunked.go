@@ -0,0 +1,230 @@
+package naivehttpcache
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// manifestMagic prefixes manifests of values split by ChunkedCache.
+const manifestMagic = "\x89NHK"
+
+// chunkKeyPrefix prefixes keys of chunks of values split by ChunkedCache.
+const chunkKeyPrefix = "chunk="
+
+// ChunkedCache is Cache that splits values larger than ChunkSize into chunks,
+// stored as values of their own, for backends that limit the size of values
+// (e.g. memcached). The original key holds a manifest, which is written after
+// the chunks; values with missing or mismatching chunks (e.g. because some of
+// them were evicted, or a write was interrupted) are misses, and so are
+// corrupt manifests.
+//
+// Chunks of a value that is overwritten or deleted are deleted too, but
+// concurrent writes of the same key may leave chunks behind, which only ttls
+// get rid of. Keys of chunks are never walked.
+type ChunkedCache struct {
+	Cache Cache
+	// ChunkSize is the maximum size of values stored in Cache, manifests
+	// aside. Non-positive means that values are never split.
+	ChunkSize int
+}
+
+// NewChunkedCache returns ChunkedCache that stores values in cache split into
+// chunks of at most chunkSize bytes.
+func NewChunkedCache(cache Cache, chunkSize int) *ChunkedCache {
+	return &ChunkedCache{Cache: cache, ChunkSize: chunkSize}
+}
+
+// chunkManifest describes a value split into chunks.
+type chunkManifest struct {
+	// Generation tells chunks of different writes of the same key apart.
+	Generation string
+	Size       int
+	Chunks     int
+	Checksum   uint32
+}
+
+// encode returns binary representation of m, which ends with the checksum of
+// the rest of it.
+func (m *chunkManifest) encode() []byte {
+	buf := []byte(manifestMagic)
+	buf = appendString(buf, m.Generation)
+	buf = appendUvarint(buf, uint64(m.Size))
+	buf = appendUvarint(buf, uint64(m.Chunks))
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], m.Checksum)
+	buf = append(buf, sum[:]...)
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf))
+	return append(buf, sum[:]...)
+}
+
+// decodeChunkManifest decodes val, false means that it isn't a manifest. Nil
+// manifest is returned for corrupt ones, which are checked against their
+// checksums and chunkSize, so they never make Get allocate or read more than
+// the value takes.
+func decodeChunkManifest(val []byte, chunkSize int) (*chunkManifest, bool) {
+	if !bytes.HasPrefix(val, []byte(manifestMagic)) {
+		return nil, false
+	}
+	if len(val) < len(manifestMagic)+4 {
+		return nil, true
+	}
+	fields, sum := val[:len(val)-4], val[len(val)-4:]
+	if crc32.ChecksumIEEE(fields) != binary.BigEndian.Uint32(sum) {
+		return nil, true
+	}
+	d := entryDecoder{buf: fields[len(manifestMagic):]}
+	m := &chunkManifest{
+		Generation: string(d.bytes()),
+		Size:       int(d.uvarint()),
+		Chunks:     int(d.uvarint()),
+	}
+	if d.err != nil || len(d.buf) != 4 || !m.valid(chunkSize) {
+		return nil, true
+	}
+	m.Checksum = binary.BigEndian.Uint32(d.buf)
+	return m, true
+}
+
+// valid reports whether m may describe a value split into chunks of at most
+// chunkSize bytes, if it's positive. Chunks are never empty.
+func (m *chunkManifest) valid(chunkSize int) bool {
+	if m.Size < 0 || m.Chunks < 0 || m.Chunks > m.Size {
+		return false
+	}
+	return chunkSize <= 0 || m.Size == 0 || (m.Size-1)/chunkSize < m.Chunks
+}
+
+// chunkKey returns the key of chunk i of key written by generation. Like
+// other keys, it ends with the URL.
+func chunkKey(key, generation string, i int) string {
+	return chunkKeyPrefix + generation + "/" + strconv.Itoa(i) + " " + key
+}
+
+func (c *ChunkedCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	val, ok, err := c.Cache.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	m, ok := decodeChunkManifest(val, c.ChunkSize)
+	if !ok {
+		return val, true, nil
+	}
+	if m == nil {
+		return nil, false, nil
+	}
+
+	val = nil
+	if c.ChunkSize > 0 {
+		val = make([]byte, 0, m.Size)
+	}
+	for i := 0; i < m.Chunks; i++ {
+		chunk, ok, err := c.Cache.Get(ctx, chunkKey(key, m.Generation, i))
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		val = append(val, chunk...)
+	}
+	if len(val) != m.Size || crc32.ChecksumIEEE(val) != m.Checksum {
+		return nil, false, nil
+	}
+	return val, true, nil
+}
+
+func (c *ChunkedCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	old, err := c.manifest(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	// small values that look like manifests are split too, so they are not
+	// mistaken for one
+	if c.ChunkSize <= 0 || len(val) <= c.ChunkSize && !bytes.HasPrefix(val, []byte(manifestMagic)) {
+		if err := c.Cache.Set(ctx, key, val, ttl); err != nil {
+			return err
+		}
+		return c.deleteChunks(ctx, key, old)
+	}
+
+	var generation [8]byte
+	if _, err := rand.Read(generation[:]); err != nil {
+		return err
+	}
+	m := &chunkManifest{
+		Generation: hex.EncodeToString(generation[:]),
+		Size:       len(val),
+		Checksum:   crc32.ChecksumIEEE(val),
+	}
+	for start := 0; start < len(val); start += c.ChunkSize {
+		end := start + c.ChunkSize
+		if end > len(val) {
+			end = len(val)
+		}
+		if err := c.Cache.Set(ctx, chunkKey(key, m.Generation, m.Chunks), val[start:end], ttl); err != nil {
+			return err
+		}
+		m.Chunks++
+	}
+	// the manifest makes the chunks visible, so it goes last
+	if err := c.Cache.Set(ctx, key, m.encode(), ttl); err != nil {
+		return err
+	}
+	return c.deleteChunks(ctx, key, old)
+}
+
+func (c *ChunkedCache) Delete(ctx context.Context, key string) error {
+	m, err := c.manifest(ctx, key)
+	if err != nil {
+		return err
+	}
+	// deleting the manifest first makes the value a miss at once
+	if err := c.Cache.Delete(ctx, key); err != nil {
+		return err
+	}
+	return c.deleteChunks(ctx, key, m)
+}
+
+// Walk calls fn with keys of the cache that start with prefix until it
+// returns false, except for keys of chunks. Cache must implement Walker,
+// otherwise ErrNotWalkable is returned.
+func (c *ChunkedCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	walker, ok := c.Cache.(Walker)
+	if !ok {
+		return ErrNotWalkable
+	}
+	return walker.Walk(ctx, prefix, func(key string) bool {
+		if strings.HasPrefix(key, chunkKeyPrefix) {
+			return true
+		}
+		return fn(key)
+	})
+}
+
+// manifest returns the manifest stored under key, if any.
+func (c *ChunkedCache) manifest(ctx context.Context, key string) (*chunkManifest, error) {
+	val, ok, err := c.Cache.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	m, _ := decodeChunkManifest(val, c.ChunkSize)
+	return m, nil
+}
+
+// deleteChunks deletes chunks of key described by m, if any.
+func (c *ChunkedCache) deleteChunks(ctx context.Context, key string, m *chunkManifest) error {
+	if m == nil {
+		return nil
+	}
+	for i := 0; i < m.Chunks; i++ {
+		if err := c.Cache.Delete(ctx, chunkKey(key, m.Generation, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
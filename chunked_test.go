@@ -0,0 +1,144 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+// limitedCache rejects values larger than limit, like memcached does.
+type limitedCache struct {
+	*naivehttpcache.MemoryCache
+	limit int
+}
+
+func (c *limitedCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	if len(val) > c.limit {
+		return errors.New("value too large")
+	}
+	return c.MemoryCache.Set(ctx, key, val, ttl)
+}
+
+// chunkKeys returns keys of chunks stored in cache.
+func chunkKeys(t *testing.T, cache *naivehttpcache.MemoryCache) []string {
+	var keys []string
+	err := cache.Walk(context.Background(), "", func(key string) bool {
+		if strings.HasPrefix(key, "chunk=") {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func TestChunkedCache(t *testing.T) {
+	payload := bytes.Repeat([]byte("0123456789"), 1000)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(payload)
+	}))
+	defer ts.Close()
+
+	memory := naivehttpcache.NewMemoryCache(0, 0)
+	cache := naivehttpcache.NewChunkedCache(&limitedCache{MemoryCache: memory, limit: 1024}, 1024)
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(cache, naivehttpcache.WithBackendErrorPolicy(naivehttpcache.BackendFailClosed)),
+	}
+
+	mustGet(t, client, ts.URL)
+	resp, body := mustGet(t, client, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != string(payload) {
+		t.Fatalf("expected large response to be served from chunks; got %d bytes", len(body))
+	}
+	chunks := chunkKeys(t, memory)
+	if len(chunks) < 10 {
+		t.Fatalf("expected response to be split into chunks; got %q", chunks)
+	}
+
+	walked := 0
+	cache.Walk(context.Background(), "", func(key string) bool {
+		walked++
+		if strings.HasPrefix(key, "chunk=") {
+			t.Errorf("expected chunks not to be walked; got %q", key)
+		}
+		return true
+	})
+	if walked != 1 {
+		t.Fatalf("expected 1 walked key; got %d", walked)
+	}
+
+	// overwriting drops the chunks of the previous value
+	ctx := context.Background()
+	if err := cache.Set(ctx, ts.URL, payload[:2048], 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkKeys(t, memory); len(got) != 2 {
+		t.Fatalf("expected only chunks of the new value; got %q", got)
+	}
+
+	// a lost chunk makes the value a miss
+	memory.Delete(ctx, chunkKeys(t, memory)[0])
+	if _, ok, err := cache.Get(ctx, ts.URL); err != nil || ok {
+		t.Fatalf("expected value with a missing chunk to be a miss; got %v, %v", ok, err)
+	}
+
+	if err := cache.Delete(ctx, ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got := chunkKeys(t, memory); len(got) != 0 {
+		t.Fatalf("expected chunks to be deleted; got %q", got)
+	}
+}
+
+func TestChunkedCacheSmallValues(t *testing.T) {
+	memory := naivehttpcache.NewMemoryCache(0, 0)
+	cache := naivehttpcache.NewChunkedCache(memory, 16)
+	ctx := context.Background()
+
+	for _, val := range []string{"small", "\x89NHK..."} {
+		if err := cache.Set(ctx, "key", []byte(val), 0); err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := cache.Get(ctx, "key")
+		if err != nil || !ok || string(got) != val {
+			t.Fatalf("expected %q; got %q, %v, %v", val, got, ok, err)
+		}
+	}
+}
+
+func TestChunkedCacheCorruptManifest(t *testing.T) {
+	memory := naivehttpcache.NewMemoryCache(0, 0)
+	cache := naivehttpcache.NewChunkedCache(memory, 4)
+	ctx := context.Background()
+	if err := cache.Set(ctx, "key", []byte("0123456789"), 0); err != nil {
+		t.Fatal(err)
+	}
+	manifest, _, _ := memory.Get(ctx, "key")
+
+	// a huge size, with and without a matching checksum of the manifest
+	hostile := append([]byte("\x89NHK"), 0)
+	hostile = append(hostile, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 1, 0, 0, 0, 0)
+	sum := crc32.ChecksumIEEE(hostile)
+	hostile = append(hostile, byte(sum>>24), byte(sum>>16), byte(sum>>8), byte(sum))
+	corrupt := append([]byte(nil), manifest...)
+	corrupt[len(corrupt)-9]++
+
+	for _, val := range [][]byte{hostile, corrupt, []byte("\x89NHK")} {
+		if err := memory.Set(ctx, "key", val, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got, ok, err := cache.Get(ctx, "key"); err != nil || ok {
+			t.Fatalf("expected corrupt manifest %q to be a miss; got %q, %v, %v", val, got, ok, err)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package naivehttpcache
+
+import "time"
+
+// Clock tells the time to Transport. It's used for freshness checks and for
+// dating responses that come without Date header.
+type Clock interface {
+	Now() time.Time
+}
+
+// WithClock makes Transport tell the time with clock instead of the system
+// clock, e.g. to simulate expiry in tests.
+func WithClock(clock Clock) Option {
+	return func(o *Options) {
+		o.Clock = clock
+	}
+}
+
+// now returns the current time of Clock.
+func (t *Transport) now() time.Time {
+	if t.Clock == nil {
+		return time.Now()
+	}
+	return t.Clock.Now()
+}
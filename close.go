@@ -0,0 +1,86 @@
+package naivehttpcache
+
+import (
+	"context"
+	"sync"
+)
+
+// Close shuts t down gracefully: it stops janitors (see RunJanitor),
+// re-warming of HotKeys and prefetches, waits for work in the background
+// (prefetches, re-warms and fills of BackgroundFill) to be done, and writes
+// entries queued by WriteBehind to the cache, or gives up once ctx is done,
+// returning its error. It doesn't close anything else: t remains usable,
+// but it doesn't start work in the background anymore, and entries of
+// responses that are stored afterwards are written synchronously. Close may
+// be called more than once, e.g. to wait for more once ctx is done.
+func (t *Transport) Close(ctx context.Context) error {
+	b := &t.background
+	b.mu.Lock()
+	if b.stop == nil {
+		b.stop = make(chan struct{})
+	}
+	if !b.closed {
+		b.closed = true
+		close(b.stop)
+	}
+	b.mu.Unlock()
+	t.stopRewarm()
+
+	// work in the background may store entries, so that's waited for first
+	if err := waitContext(ctx, &b.work); err != nil {
+		return err
+	}
+	return t.flushWrites(ctx)
+}
+
+// background tracks work that Transport does in the background, for Close.
+type background struct {
+	mu     sync.Mutex
+	closed bool
+	// stop is closed by Close.
+	stop chan struct{}
+	work sync.WaitGroup
+}
+
+// goBackground runs fn in its own goroutine, which Close waits for. False
+// means that t is closed, and fn is not run.
+func (t *Transport) goBackground(fn func()) bool {
+	b := &t.background
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return false
+	}
+	b.work.Add(1)
+	go func() {
+		defer b.work.Done()
+		fn()
+	}()
+	return true
+}
+
+// closedChan returns a channel that is closed once t is closed.
+func (t *Transport) closedChan() <-chan struct{} {
+	b := &t.background
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.stop == nil {
+		b.stop = make(chan struct{})
+	}
+	return b.stop
+}
+
+// waitContext waits for wg, or until ctx is done.
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,55 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestClose(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello, "))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("world"))
+	}))
+	defer ts.Close()
+
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithBackgroundFill(64))
+	janitor := make(chan error)
+	go func() {
+		janitor <- transport.RunJanitor(context.Background(), time.Hour)
+	}()
+
+	resp, err := (&http.Client{Transport: transport}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Read(make([]byte, 1))
+	resp.Body.Close()
+
+	// the fill is still in the background
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := transport.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Close to give up once ctx is done; got %v", err)
+	}
+	if err := <-janitor; err != nil {
+		t.Fatalf("expected the janitor to stop; got %v", err)
+	}
+
+	close(release)
+	if err := transport.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Len() != 1 {
+		t.Fatal("expected the filled entry to be stored by the time Close returns")
+	}
+}
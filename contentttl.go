@@ -0,0 +1,67 @@
+package naivehttpcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// contentTTLHeader is stored with entries which lifetimes were decided by
+// ContentTTLs and holds them, so changes of ContentTTLs don't affect entries
+// that are already stored. It's never returned to the caller.
+const contentTTLHeader = "Naivehttpcache-Ttl"
+
+// ContentTTL is a lifetime of responses which media types match Pattern, see
+// Transport.ContentTTLs.
+type ContentTTL struct {
+	// Pattern is matched against media types as patterns of ContentTypes,
+	// e.g. image/* or application/json.
+	Pattern string
+	TTL     time.Duration
+}
+
+// WithContentTTLs sets for how long responses stay fresh by their media types,
+// the first matching one wins, see Transport.ContentTTLs.
+func WithContentTTLs(ttls ...ContentTTL) Option {
+	return func(o *Options) {
+		o.ContentTTLs = ttls
+	}
+}
+
+// contentTTL returns the lifetime of the first of ContentTTLs matching
+// response with status and header, false means that none matches.
+func (t *Transport) contentTTL(status int, header http.Header) (time.Duration, bool) {
+	if len(t.ContentTTLs) == 0 || status != http.StatusOK {
+		return 0, false
+	}
+	mediaType := mediaType(header)
+	for _, ttl := range t.ContentTTLs {
+		if matchMediaType([]string{ttl.Pattern}, mediaType) {
+			return ttl.TTL, true
+		}
+	}
+	return 0, false
+}
+
+// recordContentTTL records the lifetime of ContentTTLs of response with status
+// in header, which is going to be stored, replacing the one it was stored with
+// before, if any.
+func (t *Transport) recordContentTTL(status int, header http.Header) {
+	header.Del(contentTTLHeader)
+	if ttl, ok := t.contentTTL(status, header); ok {
+		header.Set(contentTTLHeader, ttl.String())
+	}
+}
+
+// recordedTTL returns the lifetime recorded by recordContentTTL in header of
+// cached response, false means that there's none.
+func recordedTTL(header http.Header) (time.Duration, bool) {
+	v := header.Get(contentTTLHeader)
+	if v == "" {
+		return 0, false
+	}
+	ttl, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, false
+	}
+	return ttl, true
+}
@@ -0,0 +1,73 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestContentTTLs(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("content-type", "image/png")
+		case "/json":
+			w.Header().Set("content-type", "application/json; charset=utf-8")
+		case "/html":
+			w.Header().Set("content-type", "text/html")
+		case "/text":
+			w.Header().Set("content-type", "text/plain")
+		}
+		w.Write([]byte("body"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	transport := naivehttpcache.NewTransport(
+		naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithMaxAge(5*time.Minute),
+		naivehttpcache.WithContentTTLs(
+			naivehttpcache.ContentTTL{Pattern: "image/*", TTL: 24 * time.Hour},
+			naivehttpcache.ContentTTL{Pattern: "application/json", TTL: time.Minute},
+			naivehttpcache.ContentTTL{Pattern: "text/html", TTL: 10 * time.Minute},
+			naivehttpcache.ContentTTL{Pattern: "text/*", TTL: 0},
+		),
+		naivehttpcache.WithClock(clock),
+	)
+	client := &http.Client{Transport: transport}
+
+	get := func(path string, expectedHits int) {
+		t.Helper()
+		resp, _ := mustGet(t, client, ts.URL+path)
+		if hits[path] != expectedHits {
+			t.Fatalf("%s: expected %d hits; got %d", path, expectedHits, hits[path])
+		}
+		if v := resp.Header.Get("Naivehttpcache-Ttl"); v != "" {
+			t.Fatalf("%s: expected recorded lifetime not to be returned; got %q", path, v)
+		}
+	}
+
+	for _, path := range []string{"/image", "/json", "/html", "/text"} {
+		get(path, 1)
+	}
+	get("/text", 2)
+
+	clock.Advance(2 * time.Minute)
+	get("/json", 2)
+	get("/html", 1)
+
+	// the lifetimes are recorded when responses are stored
+	transport.ContentTTLs = nil
+	clock.Advance(6 * time.Minute)
+	get("/html", 1)
+	get("/image", 1)
+	clock.Advance(5 * time.Minute)
+	get("/html", 2)
+	get("/image", 1)
+}
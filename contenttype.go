@@ -0,0 +1,60 @@
+package naivehttpcache
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// WithContentTypes makes Transport store only responses which media types
+// match one of patterns, see Transport.ContentTypes.
+func WithContentTypes(patterns ...string) Option {
+	return func(o *Options) {
+		o.ContentTypes = patterns
+	}
+}
+
+// WithSkipContentTypes makes Transport never store responses which media
+// types match one of patterns, see Transport.SkipContentTypes.
+func WithSkipContentTypes(patterns ...string) Option {
+	return func(o *Options) {
+		o.SkipContentTypes = patterns
+	}
+}
+
+// mediaType returns the media type of Content-Type of header, lowercased and
+// without parameters.
+func mediaType(header http.Header) string {
+	mediaType := strings.ToLower(header.Get("content-type"))
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return strings.TrimSpace(mediaType)
+}
+
+// storableContentType reports whether response with header may be stored
+// according to ContentTypes and SkipContentTypes.
+func (t *Transport) storableContentType(header http.Header) bool {
+	if len(t.ContentTypes) == 0 && len(t.SkipContentTypes) == 0 {
+		return true
+	}
+	mediaType := mediaType(header)
+	if matchMediaType(t.SkipContentTypes, mediaType) {
+		return false
+	}
+	return len(t.ContentTypes) == 0 || matchMediaType(t.ContentTypes, mediaType)
+}
+
+// matchMediaType reports whether mediaType matches one of patterns. Invalid
+// patterns match nothing.
+func matchMediaType(patterns []string, mediaType string) bool {
+	if mediaType == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), mediaType); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestContentTypes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if contentType := r.URL.Query().Get("type"); contentType != "" {
+			w.Header().Set("Content-Type", contentType)
+		} else {
+			// keep it from being sniffed
+			w.Header()["Content-Type"] = nil
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithContentTypes("application/json", "image/*", "application/*+json"),
+		naivehttpcache.WithSkipContentTypes("image/svg+xml"),
+	)
+	client := &http.Client{Transport: transport}
+
+	for contentType, stored := range map[string]bool{
+		"application/json; charset=utf-8": true,
+		"Image/PNG":                       true,
+		"application/problem+json":        true,
+		"image/svg+xml":                   false,
+		"text/html":                       false,
+		"":                                false,
+	} {
+		rawurl := ts.URL + "/?type=" + url.QueryEscape(contentType)
+		mustGet(t, client, rawurl)
+		resp, _ := mustGet(t, client, rawurl)
+		if got := resp.Header.Get(naivehttpcache.XFromCache) == "1"; got != stored {
+			t.Errorf("%q: expected stored to be %v; got %v", contentType, stored, got)
+		}
+	}
+}
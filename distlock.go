@@ -0,0 +1,201 @@
+package naivehttpcache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Locker is a lock shared between Transports, possibly of different
+// processes, e.g. on top of SET NX PX of Redis. Transport holds it while
+// fetching the key from the server, so others wait for the entry instead of
+// fetching it too.
+type Locker interface {
+	// TryLock acquires the lock of key for at most ttl, unless it's held
+	// already. Unlock must only release the lock if it's still held by the
+	// caller, i.e. if ttl didn't pass.
+	TryLock(ctx context.Context, key string, ttl time.Duration) (unlock func(), ok bool, err error)
+}
+
+// DefaultLockTimeout is the default Transport.LockTimeout.
+const DefaultLockTimeout = 10 * time.Second
+
+// lockPollInterval is how often Transport checks the cache for the entry (and
+// whether the lock is free) while another one holds its lock.
+const lockPollInterval = 50 * time.Millisecond
+
+// WithLocker makes Transport coalesce fetches of the same key with locker, see
+// Transport.Locker.
+func WithLocker(locker Locker) Option {
+	return func(o *Options) {
+		o.Locker = locker
+	}
+}
+
+// WithStaleWhileLocked makes Transport serve entries that expired no more than
+// maxStaleness ago while their lock is held, see Transport.StaleWhileLocked.
+func WithStaleWhileLocked(maxStaleness time.Duration) Option {
+	return func(o *Options) {
+		o.StaleWhileLocked = maxStaleness
+	}
+}
+
+// WithLockTimeout sets for how long locks of Locker are held and waited for.
+func WithLockTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.LockTimeout = timeout
+	}
+}
+
+// MemoryLocker is Locker of a single process, e.g. for Transports that share
+// a cache or for tests. Zero value is ready to use.
+type MemoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]*memoryLock
+}
+
+type memoryLock struct {
+	expires time.Time
+}
+
+func (l *MemoryLocker) TryLock(ctx context.Context, key string, ttl time.Duration) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if lock, ok := l.locks[key]; ok && now.Before(lock.expires) {
+		return nil, false, nil
+	}
+	if l.locks == nil {
+		l.locks = make(map[string]*memoryLock)
+	}
+	lock := &memoryLock{expires: now.Add(ttl)}
+	l.locks[key] = lock
+
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.locks[key] == lock {
+			delete(l.locks, key)
+		}
+	}, true, nil
+}
+
+// lockTimeout returns effective LockTimeout.
+func (t *Transport) lockTimeout() time.Duration {
+	if t.LockTimeout <= 0 {
+		return DefaultLockTimeout
+	}
+	return t.LockTimeout
+}
+
+// lockFetch acquires the lock of fetching cacheKey. If it's held by someone
+// else, lockFetch waits for them to store the entry and returns it, or for the
+// lock to be released without the entry (e.g. because the response wasn't
+// storable) and acquires it. Otherwise release has to be called once fetched response is stored, or
+// turns out not to be storable. Once waiting times out release is nil and the
+// key has to be fetched anyway. staleResp, if set, is served instead of
+// waiting if StaleWhileLocked allows. outcome is set for returned responses.
+func (t *Transport) lockFetch(req *http.Request, reqCC cacheControl, cacheKey string, staleResp *http.Response, staleAt time.Time, outcome *Outcome) (release func(), resp *http.Response, err error) {
+	timeout := t.lockTimeout()
+	release, err = t.tryLock(req.Context(), cacheKey, timeout)
+	if err != nil || release != nil {
+		return release, nil, err
+	}
+
+	if staleResp != nil && t.StaleWhileLocked > 0 && !t.mustRevalidate(staleResp.Header) {
+		staleness, err := t.staleness(t.meta(staleResp.StatusCode, staleResp.Header, staleAt))
+		if err == nil && staleness <= t.StaleWhileLocked {
+			*outcome = OutcomeStale
+			return nil, t.serveStale(req, staleResp, staleAt, `110 - "Response is Stale"`), nil
+		}
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-req.Context().Done():
+			return nil, nil, req.Context().Err()
+		case <-timer.C:
+			return nil, nil, nil
+		case <-ticker.C:
+		}
+
+		// the lock is tried first: its holder stores the entry before
+		// releasing it, so the entry is found below once the lock is free
+		release, err = t.tryLock(req.Context(), cacheKey, timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		cachedResp, err := t.lockedEntry(req, reqCC, cacheKey)
+		if err != nil || cachedResp != nil {
+			if release != nil {
+				release()
+			}
+			if cachedResp != nil {
+				*outcome = OutcomeHit
+			}
+			return nil, cachedResp, err
+		}
+		if release != nil {
+			return release, nil, nil
+		}
+	}
+}
+
+// tryLock tries to acquire the lock of fetching cacheKey for ttl. Nil release
+// means that it's held by someone else.
+func (t *Transport) tryLock(ctx context.Context, cacheKey string, ttl time.Duration) (release func(), err error) {
+	unlock, ok, err := t.Locker.TryLock(ctx, "lock "+cacheKey, ttl)
+	if err != nil {
+		// the lock is just as much of a backend as the cache is
+		return nil, t.backendError("lock", cacheKey, err)
+	}
+	if !ok {
+		return nil, nil
+	}
+	var once sync.Once
+	return func() { once.Do(unlock) }, nil
+}
+
+// lockedEntry returns the fresh entry of cacheKey served to req, if the holder
+// of its lock stored one.
+func (t *Transport) lockedEntry(req *http.Request, reqCC cacheControl, cacheKey string) (*http.Response, error) {
+	val, ok, err := t.cacheGet(req.Context(), cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		ok, err = t.intact(req.Context(), cacheKey, val)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !ok {
+		return nil, nil
+	}
+	cachedResp, storedAt, ok, err := t.decode(req, cacheKey, val)
+	if err != nil || !ok {
+		return nil, err
+	}
+	if fresh, err := t.fresh(req, reqCC, t.meta(cachedResp.StatusCode, cachedResp.Header, storedAt)); err != nil || !fresh {
+		return nil, nil
+	}
+	return t.serve(req, cachedResp, storedAt), nil
+}
+
+// releasingReadCloser calls release once it's closed.
+type releasingReadCloser struct {
+	io.ReadCloser
+	release func()
+}
+
+func (r *releasingReadCloser) Close() error {
+	defer r.release()
+	return r.ReadCloser.Close()
+}
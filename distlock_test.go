@@ -0,0 +1,175 @@
+package naivehttpcache_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestLocker(t *testing.T) {
+	var hits int32
+	arrived := make(chan struct{})
+	proceed := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 1 {
+			close(arrived)
+			<-proceed
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	// two instances sharing the cache and the lock
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	locker := &naivehttpcache.MemoryLocker{}
+	clients := make([]*http.Client, 2)
+	for i := range clients {
+		clients[i] = &http.Client{
+			Transport: naivehttpcache.NewTransport(cache, naivehttpcache.WithLocker(locker)),
+		}
+	}
+
+	var wg sync.WaitGroup
+	resps := make([]*http.Response, 2)
+	get := func(i int) {
+		defer wg.Done()
+		resp, err := clients[i].Get(ts.URL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer resp.Body.Close()
+		if _, err := ioutil.ReadAll(resp.Body); err != nil {
+			t.Error(err)
+		}
+		resps[i] = resp
+	}
+
+	wg.Add(2)
+	go get(0)
+	<-arrived
+	go get(1)
+	// let the second one find the lock held
+	time.Sleep(100 * time.Millisecond)
+	close(proceed)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&hits); n != 1 {
+		t.Fatalf("expected 1 server hit; got %d", n)
+	}
+	if resps[1] == nil || resps[1].Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected the waiting instance to be served from the cache")
+	}
+}
+
+func TestLockerUnstorable(t *testing.T) {
+	var hits int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("cache-control", "no-store")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	locker := &naivehttpcache.MemoryLocker{}
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		client := &http.Client{Transport: naivehttpcache.NewTransport(cache,
+			naivehttpcache.WithLocker(locker),
+			naivehttpcache.WithLockTimeout(3*time.Second),
+			naivehttpcache.WithRespectNoStore(),
+		)}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := client.Get(ts.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+
+	// the waiting one fetches once the lock is released, not once it times
+	// out
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected unstorable responses not to wait for LockTimeout; took %v", elapsed)
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Fatalf("expected 2 server hits; got %d", n)
+	}
+}
+
+func TestStaleWhileLocked(t *testing.T) {
+	var hits int32
+	arrived := make(chan struct{})
+	proceed := make(chan struct{})
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&hits, 1) == 2 {
+			close(arrived)
+			<-proceed
+		}
+		w.Write([]byte("v" + strconv.Itoa(int(atomic.LoadInt32(&hits)))))
+	}))
+	defer ts.Close()
+
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	locker := &naivehttpcache.MemoryLocker{}
+	clock := newFakeClock()
+	newClient := func(maxStaleness time.Duration) *http.Client {
+		return &http.Client{
+			Transport: naivehttpcache.NewTransport(cache,
+				naivehttpcache.WithMaxAge(time.Minute),
+				naivehttpcache.WithClock(clock),
+				naivehttpcache.WithLocker(locker),
+				naivehttpcache.WithStaleWhileLocked(maxStaleness),
+			),
+		}
+	}
+
+	refresher := newClient(time.Hour)
+	mustGet(t, refresher, ts.URL)
+	// expired a minute ago
+	clock.Advance(2 * time.Minute)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resp, err := refresher.Get(ts.URL)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+	}()
+	<-arrived
+
+	resp, body := mustGet(t, newClient(time.Hour), ts.URL)
+	if body != "v1" || resp.Header.Get("warning") == "" {
+		t.Fatalf("expected stale v1 with warning; got %q", body)
+	}
+
+	// too stale, waits for the refresh
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(proceed)
+	}()
+	if _, body := mustGet(t, newClient(30*time.Second), ts.URL); body != "v2" {
+		t.Fatalf("expected refreshed v2; got %q", body)
+	}
+	<-done
+}
@@ -0,0 +1,174 @@
+package naivehttpcache
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// EncodingMode states how Content-Encoding of responses is treated when they
+// are stored.
+type EncodingMode int
+
+const (
+	// EncodingAsIs stores whatever underlying transport returned: decoded body
+	// if it transparently decompressed the response, encoded one otherwise.
+	// This is the default.
+	EncodingAsIs EncodingMode = iota
+	// EncodingDecoded stores decoded bodies with encoding headers removed.
+	// Responses in encodings that can't be decoded (only gzip and deflate can
+	// be) are not stored.
+	EncodingDecoded
+	// EncodingVerbatim stores encoded bytes exactly as the server sent them.
+	// Transparent decompression is done by Transport itself then, both for
+	// responses from the server and from the cache, for requests that didn't
+	// ask for a particular encoding.
+	EncodingVerbatim
+)
+
+// contentEncoding returns normalized Content-Encoding of header.
+func contentEncoding(header http.Header) string {
+	return strings.ToLower(strings.TrimSpace(header.Get("content-encoding")))
+}
+
+// decodable reports whether body of response with header can be decoded.
+func decodable(header http.Header) bool {
+	switch contentEncoding(header) {
+	case "", "identity", "gzip", "x-gzip", "deflate":
+		return true
+	}
+	return false
+}
+
+// decoder returns reader of decoded content read from r encoded with encoding.
+func decoder(r io.Reader, encoding string) (io.Reader, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(r)
+	case "deflate":
+		return zlib.NewReader(r)
+	}
+	return r, nil
+}
+
+// wantsTransparentDecoding reports whether req leaves the choice of encoding
+// to the transport, the same way http.Transport decides to request gzip.
+func wantsTransparentDecoding(req *http.Request) bool {
+	return req.Header.Get("accept-encoding") == "" && req.Header.Get("range") == ""
+}
+
+// decodeTransparently replaces gzip encoded body of resp with a decoded one,
+// the same way http.Transport does it.
+func decodeTransparently(resp *http.Response) {
+	if enc := contentEncoding(resp.Header); enc != "gzip" && enc != "x-gzip" {
+		return
+	}
+	resp.Header = resp.Header.Clone()
+	resp.Header.Del("content-encoding")
+	resp.Header.Del("content-length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	resp.Body = &gzipReadCloser{body: resp.Body}
+}
+
+// gzipReadCloser lazily decompresses body on first read, just like gzipReader
+// in net/http.
+type gzipReadCloser struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	zerr error
+}
+
+func (r *gzipReadCloser) Read(p []byte) (n int, err error) {
+	if r.zr == nil {
+		if r.zerr == nil {
+			r.zr, r.zerr = gzip.NewReader(r.body)
+		}
+		if r.zerr != nil {
+			return 0, r.zerr
+		}
+	}
+	return r.zr.Read(p)
+}
+
+func (r *gzipReadCloser) Close() error {
+	return r.body.Close()
+}
+
+// AcceptEncodingMode states how Accept-Encoding header of requests is treated.
+type AcceptEncodingMode int
+
+const (
+	// AcceptEncodingAsIs passes the header to the server as is and doesn't
+	// take it into account for cache keys. This is the default.
+	AcceptEncodingAsIs AcceptEncodingMode = iota
+	// AcceptEncodingNormalize normalizes the header (lowercases codings, drops
+	// refused ones and duplicates, sorts the rest) and mixes it into cache key,
+	// so "gzip, br" and "br, gzip" requests share entries, but requests for
+	// different encodings don't.
+	AcceptEncodingNormalize
+	// AcceptEncodingStrip removes the header, leaving compression to the
+	// underlying transport, so all requests share entries.
+	AcceptEncodingStrip
+)
+
+// normalizeAcceptEncoding returns normalized value of Accept-Encoding header.
+func normalizeAcceptEncoding(value string) string {
+	seen := map[string]bool{}
+	var codings []string
+	for _, part := range strings.Split(value, ",") {
+		coding := strings.ToLower(strings.TrimSpace(part))
+		params := ""
+		if i := strings.IndexByte(coding, ';'); i >= 0 {
+			coding, params = strings.TrimSpace(coding[:i]), strings.Replace(coding[i:], " ", "", -1)
+		}
+		if coding == "" || seen[coding] {
+			continue
+		}
+		seen[coding] = true
+		switch params {
+		case ";q=0", ";q=0.0", ";q=0.00", ";q=0.000":
+			// refused coding is the same as not mentioned one, unless it's the
+			// identity or a wildcard
+			if coding != "identity" && coding != "*" {
+				continue
+			}
+		case ";q=1", ";q=1.0", ";q=1.00", ";q=1.000":
+			params = ""
+		}
+		codings = append(codings, coding+params)
+	}
+	sort.Strings(codings)
+	return strings.Join(codings, ", ")
+}
+
+// withAcceptEncoding returns req with Accept-Encoding header treated according
+// to t.AcceptEncoding.
+func (t *Transport) withAcceptEncoding(req *http.Request) *http.Request {
+	value := req.Header.Get("accept-encoding")
+	if value == "" {
+		return req
+	}
+
+	switch t.AcceptEncoding {
+	case AcceptEncodingNormalize:
+		normalized := normalizeAcceptEncoding(value)
+		if normalized == value {
+			return req
+		}
+		req = req.Clone(req.Context())
+		if normalized == "" {
+			req.Header.Del("accept-encoding")
+		} else {
+			req.Header.Set("accept-encoding", normalized)
+		}
+	case AcceptEncodingStrip:
+		req = req.Clone(req.Context())
+		req.Header.Del("accept-encoding")
+	}
+
+	return req
+}
@@ -0,0 +1,141 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newGzipServer(t *testing.T) *httptest.Server {
+	encoded := gzipped(t, "hello")
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(encoded)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+}
+
+func TestEncodingDecoded(t *testing.T) {
+	ts := newGzipServer(t)
+	defer ts.Close()
+
+	cache := httpcache.NewMemoryCache()
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache), naivehttpcache.WithEncoding(naivehttpcache.EncodingDecoded)),
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, body := fetch(t, httpClient, req)
+		fromCache := resp.Header.Get(naivehttpcache.XFromCache) == "1"
+		switch {
+		case !fromCache && resp.Header.Get("Content-Encoding") != "gzip":
+			t.Fatal("expected server response to be encoded")
+		case fromCache && (resp.Header.Get("Content-Encoding") != "" || body != "hello"):
+			t.Fatalf("expected decoded cached response; got %q", body)
+		}
+	}
+}
+
+func TestEncodingVerbatim(t *testing.T) {
+	ts := newGzipServer(t)
+	defer ts.Close()
+
+	cache := httpcache.NewMemoryCache()
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache), naivehttpcache.WithEncoding(naivehttpcache.EncodingVerbatim)),
+	}
+
+	// transparently decoded both from server and from cache
+	for i := 0; i < 2; i++ {
+		resp, body := mustGet(t, httpClient, ts.URL)
+		if body != "hello" || !resp.Uncompressed {
+			t.Fatalf("request %d: expected transparently decoded response; got %q", i, body)
+		}
+	}
+
+	cached, _ := cache.Get(ts.URL)
+	if !bytes.Contains(cached, gzipped(t, "hello")) {
+		t.Fatalf("expected encoded bytes to be stored; got %q", cached)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, body := fetch(t, httpClient, req)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != string(gzipped(t, "hello")) {
+		t.Fatalf("expected encoded cached response; got %q", body)
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      naivehttpcache.AcceptEncodingMode
+		fromCache []bool
+	}{
+		{"as is", naivehttpcache.AcceptEncodingAsIs, []bool{false, true, true}},
+		{"normalize", naivehttpcache.AcceptEncodingNormalize, []bool{false, true, false}},
+		{"strip", naivehttpcache.AcceptEncodingStrip, []bool{false, true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen []string
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = append(seen, r.Header.Get("Accept-Encoding"))
+			}))
+			defer ts.Close()
+
+			httpClient := &http.Client{
+				Transport: naivehttpcache.NewTransport(
+					naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+					naivehttpcache.WithAcceptEncoding(tt.mode),
+				),
+			}
+
+			for i, acceptEncoding := range []string{"gzip, br", "BR, gzip;q=1, deflate;q=0", "identity"} {
+				req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+				req.Header.Set("Accept-Encoding", acceptEncoding)
+				resp, _ := fetch(t, httpClient, req)
+				if fromCache := resp.Header.Get(naivehttpcache.XFromCache) == "1"; fromCache != tt.fromCache[i] {
+					t.Fatalf("%q: expected from cache %t; got %t", acceptEncoding, tt.fromCache[i], fromCache)
+				}
+			}
+
+			switch tt.mode {
+			case naivehttpcache.AcceptEncodingNormalize:
+				if seen[0] != "br, gzip" {
+					t.Fatalf("expected normalized header to be sent; got %q", seen[0])
+				}
+			case naivehttpcache.AcceptEncodingStrip:
+				// http.Transport asks for gzip on its own
+				if seen[0] != "gzip" {
+					t.Fatalf("expected header to be left to transport; got %q", seen[0])
+				}
+			}
+		})
+	}
+}
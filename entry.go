@@ -0,0 +1,387 @@
+package naivehttpcache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// entryMagic prefixes encoded entries. Values without it are responses dumped
+// with httputil.DumpResponse by older versions of the package.
+const entryMagic = "\x89NHC"
+
+// Fields of encoded entry. Each field is encoded as its tag, length and data;
+// unknown fields are skipped when decoding, so new ones can be added freely.
+// Body must always be the last one.
+const (
+	entryFieldStatus     = 1
+	entryFieldStatusCode = 2
+	entryFieldProto      = 3
+	entryFieldHeader     = 4
+	entryFieldStoredAt   = 5
+	entryFieldChecksum   = 6
+	entryFieldCachedAt   = 7
+	entryFieldBody       = 15
+)
+
+var errCorruptEntry = errors.New("naivehttpcache: corrupt cache entry")
+
+// entry is a cached response. Its headers are stored structurally and its body
+// as raw bytes, so hits don't have to parse HTTP messages.
+type entry struct {
+	Status     string
+	StatusCode int
+	ProtoMajor int
+	ProtoMinor int
+	Header     http.Header
+	// StoredAt is the date of the response (see Transport.dated), zero for
+	// entries stored by versions of the package that set Date header instead.
+	StoredAt time.Time
+	// CachedAt is when the entry was written to the cache by the clock of
+	// Transport, zero for entries stored by versions of the package that
+	// didn't record it.
+	CachedAt time.Time
+	// Body references the decoded value, it must not be modified.
+	Body []byte
+}
+
+// newEntry returns entry of resp, body of which is read from body.
+func newEntry(resp *http.Response, body io.Reader) (*entry, error) {
+	e := &entry{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		ProtoMajor: resp.ProtoMajor,
+		ProtoMinor: resp.ProtoMinor,
+		Header:     resp.Header,
+	}
+
+	// bodies passed to onEOF are *bytes.Reader, size of which is known
+	if r, ok := body.(interface{ Len() int }); ok {
+		e.Body = make([]byte, r.Len())
+		if _, err := io.ReadFull(body, e.Body); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+
+	var err error
+	e.Body, err = ioutil.ReadAll(body)
+	return e, err
+}
+
+// complete reports whether the body of e is as long as its Content-Length
+// header says, if there's one.
+func (e *entry) complete() bool {
+	return lengthMatches(e.Header.Get("content-length"), len(e.Body))
+}
+
+// lengthMatches reports whether body of size matches Content-Length value
+// contentLength, if it's not empty.
+func lengthMatches(contentLength string, size int) bool {
+	if contentLength == "" {
+		return true
+	}
+	n, err := strconv.ParseInt(contentLength, 10, 64)
+	return err == nil && n == int64(size)
+}
+
+// isEntry reports whether val is an encoded entry.
+func isEntry(val []byte) bool {
+	return bytes.HasPrefix(val, []byte(entryMagic))
+}
+
+// encode returns binary representation of e.
+func (e *entry) encode() []byte {
+	keys := make([]string, 0, len(e.Header))
+	for k := range e.Header {
+		keys = append(keys, k)
+	}
+	// sorted keys make encoding deterministic
+	sort.Strings(keys)
+
+	var header []byte
+	header = appendUvarint(header, uint64(len(keys)))
+	for _, k := range keys {
+		header = appendString(header, k)
+		header = appendUvarint(header, uint64(len(e.Header[k])))
+		for _, v := range e.Header[k] {
+			header = appendString(header, v)
+		}
+	}
+
+	// 128 bytes are enough for tags, lengths and numeric fields
+	buf := make([]byte, 0, len(entryMagic)+len(e.Status)+len(header)+len(e.Body)+128)
+	buf = append(buf, entryMagic...)
+	buf = appendField(buf, entryFieldStatus, []byte(e.Status))
+	buf = appendField(buf, entryFieldStatusCode, appendUvarint(nil, uint64(e.StatusCode)))
+	buf = appendField(buf, entryFieldProto, appendUvarint(appendUvarint(nil, uint64(e.ProtoMajor)), uint64(e.ProtoMinor)))
+	buf = appendField(buf, entryFieldHeader, header)
+	if !e.StoredAt.IsZero() {
+		buf = appendField(buf, entryFieldStoredAt, appendUvarint(nil, uint64(e.StoredAt.UnixNano())))
+	}
+	if !e.CachedAt.IsZero() {
+		buf = appendField(buf, entryFieldCachedAt, appendUvarint(nil, uint64(e.CachedAt.UnixNano())))
+	}
+	// the checksum covers all the other fields, so it's computed as if it
+	// was not there
+	body := appendUvarint(appendUvarint(nil, entryFieldBody), uint64(len(e.Body)))
+	sum := crc32.Update(crc32.ChecksumIEEE(buf[len(entryMagic):]), crc32.IEEETable, body)
+	sum = crc32.Update(sum, crc32.IEEETable, e.Body)
+	var sumBytes [4]byte
+	binary.BigEndian.PutUint32(sumBytes[:], sum)
+	buf = appendField(buf, entryFieldChecksum, sumBytes[:])
+	buf = append(buf, body...)
+	return append(buf, e.Body...)
+}
+
+// verifyEntry reports whether val, if it's an encoded entry, is intact: it's
+// not truncated, matches its checksum and its body is as long as its
+// Content-Length says. Entries stored by versions of the package that didn't
+// checksum them are not checked against checksums, values that are not
+// entries are not checked at all.
+func verifyEntry(val []byte) bool {
+	if !isEntry(val) {
+		return true
+	}
+	fields := val[len(entryMagic):]
+	d := entryDecoder{buf: fields}
+	var sum, header, body []byte
+	var sumStart, sumEnd int
+	for len(d.buf) > 0 && d.err == nil {
+		start := len(fields) - len(d.buf)
+		tag := d.uvarint()
+		data := d.bytes()
+		switch tag {
+		case entryFieldChecksum:
+			sum = data
+			sumStart, sumEnd = start, len(fields)-len(d.buf)
+		case entryFieldHeader:
+			header = data
+		case entryFieldBody:
+			body = data
+		}
+	}
+	if d.err != nil {
+		return false
+	}
+	if !lengthMatches(entryHeaderValue(header, "Content-Length"), len(body)) {
+		return false
+	}
+	if sum == nil {
+		return true
+	}
+	if len(sum) != 4 {
+		return false
+	}
+	actual := crc32.Update(crc32.ChecksumIEEE(fields[:sumStart]), crc32.IEEETable, fields[sumEnd:])
+	return actual == binary.BigEndian.Uint32(sum)
+}
+
+// entryCachedAt returns CachedAt of encoded entry val without decoding the
+// whole entry, zero if it's not known.
+func entryCachedAt(val []byte) time.Time {
+	if !isEntry(val) {
+		return time.Time{}
+	}
+	d := entryDecoder{buf: val[len(entryMagic):]}
+	for len(d.buf) > 0 && d.err == nil {
+		tag := d.uvarint()
+		data := d.bytes()
+		if d.err == nil && tag == entryFieldCachedAt {
+			fd := entryDecoder{buf: data}
+			if at := fd.uvarint(); fd.err == nil {
+				return time.Unix(0, int64(at))
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// entryHeaderValue returns the first value of key in header field data of an
+// encoded entry, without decoding the whole header.
+func entryHeaderValue(data []byte, key string) string {
+	d := entryDecoder{buf: data}
+	n := d.uvarint()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		k := d.bytes()
+		vn := d.uvarint()
+		for j := uint64(0); j < vn && d.err == nil; j++ {
+			v := d.bytes()
+			if j == 0 && string(k) == key {
+				return string(v)
+			}
+		}
+	}
+	return ""
+}
+
+// decodeEntry decodes entry encoded by entry.encode. Body of the result
+// references val.
+func decodeEntry(val []byte) (*entry, error) {
+	if !isEntry(val) {
+		return nil, errCorruptEntry
+	}
+	d := entryDecoder{buf: val[len(entryMagic):]}
+	e := &entry{}
+	for len(d.buf) > 0 && d.err == nil {
+		tag := d.uvarint()
+		data := d.bytes()
+		if d.err != nil {
+			break
+		}
+
+		fd := entryDecoder{buf: data}
+		switch tag {
+		case entryFieldStatus:
+			e.Status = string(data)
+		case entryFieldStatusCode:
+			e.StatusCode = int(fd.uvarint())
+		case entryFieldProto:
+			e.ProtoMajor = int(fd.uvarint())
+			e.ProtoMinor = int(fd.uvarint())
+		case entryFieldHeader:
+			n := fd.uvarint()
+			e.Header = make(http.Header, n)
+			for i := uint64(0); i < n && fd.err == nil; i++ {
+				k := string(fd.bytes())
+				vn := fd.uvarint()
+				if fd.err != nil || vn > uint64(len(fd.buf)) {
+					fd.err = errCorruptEntry
+					break
+				}
+				vv := make([]string, vn)
+				for j := range vv {
+					vv[j] = string(fd.bytes())
+				}
+				e.Header[k] = vv
+			}
+		case entryFieldStoredAt:
+			e.StoredAt = time.Unix(0, int64(fd.uvarint()))
+		case entryFieldCachedAt:
+			e.CachedAt = time.Unix(0, int64(fd.uvarint()))
+		case entryFieldBody:
+			e.Body = data
+		}
+		if fd.err != nil {
+			d.err = fd.err
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if e.Header == nil {
+		e.Header = http.Header{}
+	}
+	return e, nil
+}
+
+// response returns response to req made out of e.
+func (e *entry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         fmt.Sprintf("HTTP/%d.%d", e.ProtoMajor, e.ProtoMinor),
+		ProtoMajor:    e.ProtoMajor,
+		ProtoMinor:    e.ProtoMinor,
+		Header:        e.Header,
+		Body:          newCachedBody(e.Body),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// decodeResponse returns response to req stored in val, which is either an
+// encoded entry or a response dumped by older versions of the package, and
+// when it was stored. Responses decoded from the same val are independent of
+// each other, only their bodies read val.
+func decodeResponse(val []byte, req *http.Request) (*http.Response, time.Time, error) {
+	if !isEntry(val) {
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(val)), req)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		body, err := readBody(resp.Body)
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		resp.Body = newCachedBody(body)
+		resp.ContentLength = int64(len(body))
+		return resp, storedAt(time.Time{}, resp.Header), nil
+	}
+	e, err := decodeEntry(val)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return e.response(req), storedAt(e.StoredAt, e.Header), nil
+}
+
+// storedAt returns at, unless it's zero because the entry with header was
+// stored by an older version of the package, which set Date header of
+// responses instead. Zero is returned if there's none.
+func storedAt(at time.Time, header http.Header) time.Time {
+	if !at.IsZero() {
+		return at
+	}
+	date, _ := responseDate(header)
+	return date
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+func appendField(buf []byte, tag uint64, data []byte) []byte {
+	buf = appendUvarint(buf, tag)
+	buf = appendUvarint(buf, uint64(len(data)))
+	return append(buf, data...)
+}
+
+// entryDecoder reads values appended by append* functions, remembering the
+// first error.
+type entryDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *entryDecoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.err = errCorruptEntry
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *entryDecoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)) {
+		d.err = errCorruptEntry
+		return nil
+	}
+	b := d.buf[:n:n]
+	d.buf = d.buf[n:]
+	return b
+}
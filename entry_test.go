@@ -0,0 +1,133 @@
+package naivehttpcache_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestLegacyEntry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("unexpected server hit")
+	}))
+	defer ts.Close()
+
+	// responses were stored with httputil.DumpResponse before
+	cache := httpcache.NewMemoryCache()
+	cache.Set(ts.URL, []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\nX-Legacy: 1\r\n\r\nhello"))
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache)),
+	}
+	resp, body := mustGet(t, httpClient, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "1" || resp.Header.Get("X-Legacy") != "1" || body != "hello" {
+		t.Fatalf("expected legacy entry to be served; got %q", body)
+	}
+}
+
+func TestEntryRoundTrip(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Multi", "1")
+		w.Header().Add("X-Multi", "2")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache())),
+	}
+	mustGet(t, httpClient, ts.URL)
+	resp, body := mustGet(t, httpClient, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != "hello" {
+		t.Fatalf("expected cached hello; got %q", body)
+	}
+	if got := resp.Header.Values("X-Multi"); len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Fatalf("expected multi-value header to be preserved; got %q", got)
+	}
+	if resp.Status != "200 OK" || resp.ProtoMajor != 1 || resp.ProtoMinor != 1 || resp.ContentLength != 5 {
+		t.Fatalf("unexpected status line or length: %q %d.%d %d", resp.Status, resp.ProtoMajor, resp.ProtoMinor, resp.ContentLength)
+	}
+}
+
+func TestEntryKeepsHeader(t *testing.T) {
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+	mustGet(t, httpClient, ts.URL)
+	resp, _ := mustGet(t, httpClient, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected cached response")
+	}
+	if v := resp.Header.Get("date"); v != "" {
+		t.Fatalf("expected Date header not to be added to the stored response; got %q", v)
+	}
+
+	clock.Advance(2 * time.Minute)
+	resp, _ = mustGet(t, httpClient, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "" {
+		t.Fatal("expected undated response to expire since it was stored")
+	}
+}
+
+func TestEntryContentLength(t *testing.T) {
+	// the body is cut short, but Content-Length is all that tells it
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				Header:        http.Header{"Content-Length": {"10"}},
+				Body:          ioutil.NopCloser(strings.NewReader("hello")),
+				ContentLength: -1,
+				Request:       req,
+			}, nil
+		})),
+	)
+	httpClient := &http.Client{Transport: transport}
+	mustGet(t, httpClient, "http://example.com/")
+	if resp, _ := mustGet(t, httpClient, "http://example.com/"); resp.Header.Get(naivehttpcache.XFromCache) == "1" {
+		t.Fatal("expected truncated body not to be stored")
+	}
+
+	// entries stored without checksums are still checked
+	field := func(tag byte, data []byte) []byte {
+		return append([]byte{tag, byte(len(data))}, data...)
+	}
+	header := append([]byte{1, byte(len("Content-Length"))}, "Content-Length"...)
+	header = append(header, 1, 2, '1', '0')
+	val := []byte("\x89NHC")
+	val = append(val, field(2, []byte{200})...)
+	val = append(val, field(4, header)...)
+	val = append(val, field(15, []byte("hello"))...)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello, world"))
+	}))
+	defer ts.Close()
+	cache := httpcache.NewMemoryCache()
+	cache.Set(ts.URL, val)
+	httpClient = &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache),
+			naivehttpcache.WithCorruptEntryHandler(func(key string, err error) {}),
+		),
+	}
+	if resp, body := mustGet(t, httpClient, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) == "1" || body != "hello, world" {
+		t.Fatalf("expected truncated entry not to be served; got %q", body)
+	}
+}
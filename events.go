@@ -0,0 +1,117 @@
+package naivehttpcache
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is the type of Event.
+type EventType int
+
+const (
+	// EventHit means that a request was served from the cache, see
+	// Event.Outcome for how.
+	EventHit EventType = iota
+	// EventMiss means that a request went to the server.
+	EventMiss
+	// EventStore means that an entry (or ranges of it) was stored.
+	EventStore
+	// EventEvict means that an entry was deleted because it expired, either by
+	// a lookup or by Sweep. Evictions made by the backend on its own are not
+	// reported.
+	EventEvict
+	// EventInvalidate means that an entry was purged.
+	EventInvalidate
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventHit:
+		return "hit"
+	case EventMiss:
+		return "miss"
+	case EventStore:
+		return "store"
+	case EventEvict:
+		return "evict"
+	case EventInvalidate:
+		return "invalidate"
+	}
+	return "unknown"
+}
+
+// Event is an activity of the cache, see Transport.Events.
+type Event struct {
+	Type EventType
+	// Key is the key of the entry.
+	Key string
+	// Outcome is the outcome of the request of EventHit and EventMiss.
+	Outcome Outcome
+	// Time is when the event happened, by Transport.Clock.
+	Time time.Time
+}
+
+// DefaultEventBuffer is the default Transport.EventBuffer.
+const DefaultEventBuffer = 256
+
+// WithEventBuffer sets the number of events buffered by the channel of
+// Transport.Events.
+func WithEventBuffer(size int) Option {
+	return func(o *Options) {
+		o.EventBuffer = size
+	}
+}
+
+// Events returns the channel of events of t. Events are only emitted once it's
+// called, and it returns the same channel every time. The channel is never
+// closed; when its buffer is full the oldest event is dropped, so slow readers
+// never block requests. Requests are reported once their round trips return, so
+// e.g. a response may be stored before its miss is reported.
+func (t *Transport) Events() <-chan Event {
+	t.events.mu.Lock()
+	defer t.events.mu.Unlock()
+	if t.events.ch == nil {
+		size := t.EventBuffer
+		if size <= 0 {
+			size = DefaultEventBuffer
+		}
+		t.events.ch = make(chan Event, size)
+	}
+	return t.events.ch
+}
+
+// eventStream is the channel of Transport.Events.
+type eventStream struct {
+	mu sync.Mutex
+	ch chan Event
+}
+
+// subscribed reports whether Events was called, so events have to be emitted.
+func (t *Transport) subscribed() bool {
+	t.events.mu.Lock()
+	defer t.events.mu.Unlock()
+	return t.events.ch != nil
+}
+
+// emit sends event of type typ on key to Events, dropping the oldest one if
+// the channel is full.
+func (t *Transport) emit(typ EventType, key string, outcome Outcome) {
+	t.events.mu.Lock()
+	defer t.events.mu.Unlock()
+	if t.events.ch == nil {
+		return
+	}
+	event := Event{Type: typ, Key: key, Outcome: outcome, Time: t.now()}
+	for {
+		select {
+		case t.events.ch <- event:
+			return
+		default:
+		}
+		// emitters hold the lock, so only readers may free the slot meanwhile
+		select {
+		case <-t.events.ch:
+		default:
+		}
+	}
+}
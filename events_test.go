@@ -0,0 +1,76 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestEvents(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("cache-control", "max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0))
+	client := &http.Client{Transport: transport}
+	events := transport.Events()
+	if transport.Events() != events {
+		t.Fatal("expected the same channel")
+	}
+
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	if err := transport.Purge(context.Background(), ts.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []naivehttpcache.EventType{
+		naivehttpcache.EventMiss,
+		naivehttpcache.EventStore,
+		naivehttpcache.EventHit,
+		naivehttpcache.EventInvalidate,
+	}
+	for _, typ := range expected {
+		event := <-events
+		if event.Type != typ || naivehttpcache.KeyURL(event.Key) != ts.URL {
+			t.Fatalf("expected %v of %s; got %v of %s", typ, ts.URL, event.Type, event.Key)
+		}
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expected no more events; got %v", event.Type)
+	default:
+	}
+}
+
+func TestEventsDropOldest(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(
+		naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithEventBuffer(1),
+	)
+	client := &http.Client{Transport: transport}
+	events := transport.Events()
+
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	if event := <-events; event.Type != naivehttpcache.EventHit || event.Outcome != naivehttpcache.OutcomeHit {
+		t.Fatalf("expected the latest hit; got %v (%v)", event.Type, event.Outcome)
+	}
+	select {
+	case event := <-events:
+		t.Fatalf("expected older events to be dropped; got %v", event.Type)
+	default:
+	}
+}
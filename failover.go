@@ -0,0 +1,260 @@
+package naivehttpcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultProbeInterval is how often FailoverCache checks whether its primary
+// cache recovered by default.
+const DefaultProbeInterval = 5 * time.Second
+
+// FailoverCache is Cache that uses Primary, and Secondary (e.g. MemoryCache)
+// once Primary fails or times out, until it recovers. Failed operations are
+// retried on Secondary right away. While failed over, Primary is checked every
+// ProbeInterval, with Ping if it's Pinger and by the next operation otherwise.
+//
+// Values stored on Secondary are not moved to Primary once it recovers, they
+// serve as a fallback until they expire. Delete deletes from both caches; keys
+// that can't be deleted from Primary while it's failed are deleted from it
+// once it's used again.
+type FailoverCache struct {
+	Primary   Cache
+	Secondary Cache
+	// Timeout, if positive, is the timeout of operations of Primary, after
+	// which they are considered failed.
+	Timeout time.Duration
+	// ProbeInterval is how often Primary is checked once it failed,
+	// non-positive means DefaultProbeInterval.
+	ProbeInterval time.Duration
+
+	mu       sync.Mutex
+	failed   bool
+	probeAt  time.Time
+	probing  bool
+	counters FailoverStats
+	// undeleted holds keys that were deleted while Primary was failed, but
+	// not from Primary.
+	undeleted map[string]bool
+}
+
+// FailoverStats counts operations of FailoverCache.
+type FailoverStats struct {
+	// Primary and Secondary are the numbers of operations served by the
+	// caches.
+	Primary   uint64
+	Secondary uint64
+	// Failovers is the number of times Primary failed.
+	Failovers uint64
+	// FailedOver is set while operations are served by Secondary.
+	FailedOver bool
+}
+
+// NewFailoverCache returns FailoverCache that uses primary, and secondary
+// while primary fails or its operations take longer than timeout.
+func NewFailoverCache(primary, secondary Cache, timeout time.Duration) *FailoverCache {
+	return &FailoverCache{Primary: primary, Secondary: secondary, Timeout: timeout}
+}
+
+// Stats returns counters of operations of c.
+func (c *FailoverCache) Stats() FailoverStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.counters
+	stats.FailedOver = c.failed
+	return stats
+}
+
+// Tiers returns Primary and Secondary.
+func (c *FailoverCache) Tiers() []Tier {
+	return []Tier{{Name: "primary", Cache: c.Primary}, {Name: "secondary", Cache: c.Secondary}}
+}
+
+func (c *FailoverCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if c.isUndeleted(key) {
+		if err := c.Delete(ctx, key); err != nil {
+			return nil, false, err
+		}
+	}
+	r, _ := c.do(ctx, func(ctx context.Context, cache Cache) cacheResult {
+		val, ok, err := cache.Get(ctx, key)
+		return cacheResult{val: val, ok: ok, err: err}
+	})
+	return r.val, r.ok, r.err
+}
+
+func (c *FailoverCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	r, primary := c.do(ctx, func(ctx context.Context, cache Cache) cacheResult {
+		return cacheResult{err: cache.Set(ctx, key, val, ttl)}
+	})
+	if primary && r.err == nil {
+		c.setUndeleted(key, false)
+	}
+	return r.err
+}
+
+func (c *FailoverCache) Delete(ctx context.Context, key string) error {
+	del := func(ctx context.Context, cache Cache) cacheResult {
+		return cacheResult{err: cache.Delete(ctx, key)}
+	}
+	r, primary := c.do(ctx, del)
+	if primary {
+		if r.err == nil {
+			c.setUndeleted(key, false)
+		}
+		// so the value isn't served once Primary fails again
+		c.Secondary.Delete(ctx, key)
+		return r.err
+	}
+
+	// the value must not come back from Primary once it recovers, so it's
+	// deleted from it too, as far as it's possible
+	err := c.primary(ctx, del).err
+	if ctx.Err() == nil {
+		c.served(err)
+	}
+	c.setUndeleted(key, err != nil)
+	return r.err
+}
+
+// Walk calls fn with keys of both caches that start with prefix until it
+// returns false. If neither of them implements Walker, ErrNotWalkable is
+// returned.
+func (c *FailoverCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	return NewReplicatedCache(c.Primary, c.Secondary).Walk(ctx, prefix, fn)
+}
+
+// do runs op with Primary, or with Secondary if Primary is failed or fails,
+// and reports whether Primary served it.
+func (c *FailoverCache) do(ctx context.Context, op func(ctx context.Context, cache Cache) cacheResult) (cacheResult, bool) {
+	if c.usePrimary() {
+		r := c.primary(ctx, op)
+		if r.err != nil && ctx.Err() != nil {
+			// not a failure of Primary, the operation was given up on
+			return r, true
+		}
+		c.served(r.err)
+		if r.err == nil {
+			return r, true
+		}
+	}
+
+	c.mu.Lock()
+	c.counters.Secondary++
+	c.mu.Unlock()
+	return op(ctx, c.Secondary), false
+}
+
+// primary runs op with Primary, bounded by Timeout.
+func (c *FailoverCache) primary(ctx context.Context, op func(ctx context.Context, cache Cache) cacheResult) cacheResult {
+	if c.Timeout <= 0 {
+		return op(ctx, c.Primary)
+	}
+
+	opCtx, cancel := context.WithTimeout(ctx, c.Timeout)
+	defer cancel()
+	// op may not respect its context, so it isn't waited for
+	result := make(chan cacheResult, 1)
+	go func() {
+		result <- op(opCtx, c.Primary)
+	}()
+	select {
+	case r := <-result:
+		return r
+	case <-opCtx.Done():
+		return cacheResult{err: opCtx.Err()}
+	}
+}
+
+// isUndeleted reports whether key has to be deleted from Primary, which is used
+// again, before it's read.
+func (c *FailoverCache) isUndeleted(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.failed && c.undeleted[key]
+}
+
+// setUndeleted records whether key has to be deleted from Primary.
+func (c *FailoverCache) setUndeleted(key string, undeleted bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !undeleted {
+		delete(c.undeleted, key)
+		return
+	}
+	if c.undeleted == nil {
+		c.undeleted = make(map[string]bool)
+	}
+	c.undeleted[key] = true
+}
+
+// usePrimary reports whether an operation has to use Primary.
+func (c *FailoverCache) usePrimary() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.failed {
+		return true
+	}
+	if now := time.Now(); !now.Before(c.probeAt) && !c.probing {
+		c.probeAt = now.Add(c.probeInterval())
+		pinger, ok := c.Primary.(Pinger)
+		if !ok {
+			// this very operation probes Primary
+			return true
+		}
+		c.probing = true
+		go c.probe(pinger)
+	}
+	return false
+}
+
+// probe checks whether Primary recovered with pinger.
+func (c *FailoverCache) probe(pinger Pinger) {
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	err := pinger.Ping(ctx)
+
+	c.mu.Lock()
+	c.probing = false
+	c.mu.Unlock()
+	if err == nil {
+		c.recovered()
+	}
+}
+
+// served records the result of an operation of Primary, which failed with
+// err unless it's nil.
+func (c *FailoverCache) served(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err == nil {
+		c.counters.Primary++
+		c.failed = false
+		return
+	}
+	if !c.failed {
+		c.counters.Failovers++
+	}
+	c.failed = true
+	c.probeAt = time.Now().Add(c.probeInterval())
+}
+
+// recovered records that Primary recovered.
+func (c *FailoverCache) recovered() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failed = false
+}
+
+func (c *FailoverCache) probeInterval() time.Duration {
+	if c.ProbeInterval > 0 {
+		return c.ProbeInterval
+	}
+	return DefaultProbeInterval
+}
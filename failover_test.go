@@ -0,0 +1,124 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestFailoverCache(t *testing.T) {
+	ctx := context.Background()
+	primary := newFailingCache()
+	primary.failing = false
+	secondary := naivehttpcache.NewMemoryCache(0, 0)
+	cache := naivehttpcache.NewFailoverCache(primary, secondary, 0)
+	cache.ProbeInterval = 50 * time.Millisecond
+
+	if err := cache.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := primary.Get(ctx, "a"); !ok {
+		t.Fatal("expected the value to be stored in the primary")
+	}
+
+	primary.failing = true
+	if err := cache.Set(ctx, "b", []byte("2"), 0); err != nil {
+		t.Fatalf("expected failures of the primary to be tolerated; got %v", err)
+	}
+	if val, ok, err := cache.Get(ctx, "b"); err != nil || !ok || string(val) != "2" {
+		t.Fatalf("expected the value to be read from the secondary; got %q, %v, %v", val, ok, err)
+	}
+	stats := cache.Stats()
+	if want := (naivehttpcache.FailoverStats{Primary: 1, Secondary: 2, Failovers: 1, FailedOver: true}); stats != want {
+		t.Fatalf("expected %+v; got %+v", want, stats)
+	}
+
+	// the primary isn't used until it's probed
+	primary.failing = false
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Fatal("expected the value to be read from the secondary")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Fatal("expected the primary to recover")
+	}
+	if stats := cache.Stats(); stats.FailedOver || stats.Primary != 2 {
+		t.Fatalf("expected the primary to serve operations again; got %+v", stats)
+	}
+
+	if err := cache.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := secondary.Get(ctx, "b"); ok {
+		t.Fatal("expected the value to be deleted from the secondary too")
+	}
+}
+
+func TestFailoverCacheDelete(t *testing.T) {
+	ctx := context.Background()
+	primary := newFailingCache()
+	primary.failing = false
+	secondary := naivehttpcache.NewMemoryCache(0, 0)
+	cache := naivehttpcache.NewFailoverCache(primary, secondary, 0)
+	cache.ProbeInterval = 50 * time.Millisecond
+
+	for _, key := range []string{"a", "b"} {
+		if err := cache.Set(ctx, key, []byte("1"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// purged while the primary is down
+	primary.failing = true
+	if err := cache.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if !cache.Stats().FailedOver {
+		t.Fatal("expected to fail over")
+	}
+	primary.failing = false
+	if _, ok, _ := primary.Get(ctx, "a"); !ok {
+		t.Fatal("expected the primary to still hold the value")
+	}
+
+	// purged while failed over, but the primary is back already
+	if err := cache.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := primary.Get(ctx, "b"); ok {
+		t.Fatal("expected the value to be deleted from the primary")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	for _, key := range []string{"a", "b"} {
+		if _, ok, err := cache.Get(ctx, key); err != nil || ok {
+			t.Fatalf("%s: expected the purged value not to come back; got %v, %v", key, ok, err)
+		}
+	}
+	if cache.Stats().FailedOver {
+		t.Fatal("expected the primary to recover")
+	}
+}
+
+func TestFailoverCacheTimeout(t *testing.T) {
+	ctx := context.Background()
+	primary := &hungCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0), release: make(chan struct{})}
+	defer close(primary.release)
+	secondary := naivehttpcache.NewMemoryCache(0, 0)
+	cache := naivehttpcache.NewFailoverCache(primary, secondary, 20*time.Millisecond)
+
+	if _, ok, err := cache.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("expected timeouts of the primary to be tolerated; got %v, %v", ok, err)
+	}
+	if err := cache.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := secondary.Get(ctx, "a"); !ok {
+		t.Fatal("expected the value to be stored in the secondary")
+	}
+	if stats := cache.Stats(); stats.Failovers != 1 || !stats.FailedOver {
+		t.Fatalf("expected a failover; got %+v", stats)
+	}
+}
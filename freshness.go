@@ -0,0 +1,66 @@
+package naivehttpcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// Decision is the verdict of FreshnessPolicy on a cached response.
+type Decision int
+
+const (
+	// Fresh responses are served from the cache.
+	Fresh Decision = iota
+	// Stale responses are refreshed from the server (or revalidated, or
+	// served if refreshing fails, depending on options of Transport).
+	Stale
+)
+
+// EntryMeta describes a cached response to FreshnessPolicy.
+type EntryMeta struct {
+	// StatusCode is the status code of the cached response.
+	StatusCode int
+	// Header is the header of the cached response.
+	Header http.Header
+	// Date is when the response was generated (or stored, if it came without
+	// Date header).
+	Date time.Time
+	// CachedAt is when the entry was written to the cache, by Transport.Clock
+	// rather than by the clock of the server. It's only set for matchers of
+	// Transport.Ban, and it's zero for entries stored by versions of the
+	// package that didn't record it.
+	CachedAt time.Time
+	// Now is the current time of Transport.Clock.
+	Now time.Time
+}
+
+// Age returns how long ago the response was generated.
+func (m EntryMeta) Age() time.Duration {
+	return m.Now.Sub(m.Date)
+}
+
+// FreshnessPolicy decides whether cached responses to requests are fresh.
+// Setting it replaces the freshness rules of Transport: MaxAge, Shared,
+// Expires and directives of requests.
+type FreshnessPolicy interface {
+	Freshness(req *http.Request, meta EntryMeta) Decision
+}
+
+// MaxAgePolicy is FreshnessPolicy that keeps every response fresh for the
+// given duration, just like Transport.MaxAge does.
+type MaxAgePolicy time.Duration
+
+func (p MaxAgePolicy) Freshness(req *http.Request, meta EntryMeta) Decision {
+	if meta.Age() > time.Duration(p) {
+		return Stale
+	}
+	return Fresh
+}
+
+// WithFreshnessPolicy makes Transport decide freshness of cached responses
+// with policy, see FreshnessPolicy.
+func WithFreshnessPolicy(policy FreshnessPolicy) Option {
+	return func(o *Options) {
+		o.Freshness = policy
+	}
+}
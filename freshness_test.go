@@ -0,0 +1,76 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+// realtimePolicy keeps responses fresh unless request asks for realtime data.
+type realtimePolicy struct{}
+
+func (realtimePolicy) Freshness(req *http.Request, meta naivehttpcache.EntryMeta) naivehttpcache.Decision {
+	if req.Header.Get("x-realtime") != "" {
+		return naivehttpcache.Stale
+	}
+	return naivehttpcache.Fresh
+}
+
+func TestFreshnessPolicy(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("v" + strconv.Itoa(hits)))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithFreshnessPolicy(realtimePolicy{}),
+			// replaced by the policy
+			naivehttpcache.WithMaxAge(time.Nanosecond),
+		),
+	}
+
+	mustGet(t, client, ts.URL)
+	if _, body := mustGet(t, client, ts.URL); body != "v1" {
+		t.Fatalf("expected fresh v1; got %q", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("x-realtime", "1")
+	if _, body := fetch(t, client, req); body != "v2" {
+		t.Fatalf("expected v2 from the server; got %q", body)
+	}
+}
+
+func TestMaxAgePolicy(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("v" + strconv.Itoa(hits)))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithFreshnessPolicy(naivehttpcache.MaxAgePolicy(time.Minute)),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	mustGet(t, client, ts.URL)
+	if _, body := mustGet(t, client, ts.URL); body != "v1" {
+		t.Fatalf("expected fresh v1; got %q", body)
+	}
+	clock.Advance(2 * time.Minute)
+	if _, body := mustGet(t, client, ts.URL); body != "v2" {
+		t.Fatalf("expected v2 from the server; got %q", body)
+	}
+}
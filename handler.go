@@ -0,0 +1,174 @@
+package naivehttpcache
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Handler returns middleware that caches responses of next in cache, using
+// the same policies as Transport does for outbound requests. Requests are
+// keyed by their Host and RequestURI.
+// WithTransport option is meaningless here and is ignored.
+func Handler(next http.Handler, cache Cache, opts ...Option) http.Handler {
+	// full slice expression makes append copy opts instead of writing into
+	// the caller's array
+	opts = append(opts[:len(opts):len(opts)], WithTransport(handlerTransport{next}))
+	return &handler{transport: NewTransport(cache, opts...)}
+}
+
+type handler struct {
+	transport *Transport
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := r.Clone(r.Context())
+	req.URL.Host = r.Host
+	req.URL.Scheme = "http"
+	if r.TLS != nil {
+		req.URL.Scheme = "https"
+	}
+
+	resp, err := h.transport.RoundTrip(req)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer resp.Body.Close()
+
+	header := w.Header()
+	for k, vv := range resp.Header {
+		header[k] = vv
+	}
+	if resp.ContentLength >= 0 && header.Get("content-length") == "" {
+		header.Set("content-length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	// responses of unknown length may be streams, they are flushed as they go
+	flusher, ok := w.(http.Flusher)
+	if !ok || resp.ContentLength >= 0 {
+		io.Copy(w, resp.Body)
+		return
+	}
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// handlerTransport is http.RoundTripper that serves requests with a handler.
+type handlerTransport struct {
+	handler http.Handler
+}
+
+// RoundTrip runs the handler in a separate goroutine and returns response as
+// soon as its header is written, body is streamed to the caller through a
+// pipe.
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	w := &pipeResponseWriter{
+		req:    req,
+		header: http.Header{},
+		pr:     pr,
+		pw:     pw,
+		ready:  make(chan *http.Response, 1),
+	}
+
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				err := fmt.Errorf("naivehttpcache: handler panic: %v", p)
+				w.fail(err)
+				pw.CloseWithError(err)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+			pw.Close()
+		}()
+		t.handler.ServeHTTP(w, req)
+	}()
+
+	select {
+	case resp := <-w.ready:
+		if resp == nil {
+			return nil, w.err
+		}
+		return resp, nil
+	case <-req.Context().Done():
+		pr.CloseWithError(req.Context().Err())
+		return nil, req.Context().Err()
+	}
+}
+
+// pipeResponseWriter is http.ResponseWriter writing body into a pipe.
+type pipeResponseWriter struct {
+	req    *http.Request
+	header http.Header
+	pr     *io.PipeReader
+	pw     *io.PipeWriter
+	// ready receives the response once header is written, or nil on failure.
+	ready       chan *http.Response
+	once        sync.Once
+	wroteHeader bool
+	err         error
+}
+
+func (w *pipeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *pipeResponseWriter) WriteHeader(statusCode int) {
+	w.once.Do(func() {
+		w.wroteHeader = true
+		contentLength := int64(-1)
+		if v := w.header.Get("content-length"); v != "" {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				contentLength = n
+			}
+		}
+		w.ready <- &http.Response{
+			Status:        strconv.Itoa(statusCode) + " " + http.StatusText(statusCode),
+			StatusCode:    statusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        w.header.Clone(),
+			ContentLength: contentLength,
+			Body:          w.pr,
+			Request:       w.req,
+		}
+	})
+}
+
+func (w *pipeResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.header.Get("content-type") == "" {
+			w.header.Set("content-type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.pw.Write(p)
+}
+
+// Flush is a no-op, writes are passed to the reader as they are.
+func (w *pipeResponseWriter) Flush() {}
+
+// fail makes RoundTrip return err, if header isn't written yet.
+func (w *pipeResponseWriter) fail(err error) {
+	w.once.Do(func() {
+		w.err = err
+		w.ready <- nil
+	})
+}
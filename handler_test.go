@@ -0,0 +1,66 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestHandler(t *testing.T) {
+	hits := 0
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		w.Header().Set("X-Hit", strconv.Itoa(hits))
+		w.Write([]byte("hello " + r.URL.Path))
+	})
+
+	ts := httptest.NewServer(naivehttpcache.Handler(next, naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithMaxAge(time.Hour),
+		naivehttpcache.WithRespectNoStore(),
+	))
+	defer ts.Close()
+
+	tests := []struct {
+		path      string
+		fromCache bool
+		hit       string
+	}{
+		{"/a", false, "1"},
+		{"/a", true, "1"},
+		{"/b", false, "2"},
+		{"/private", false, "3"},
+		{"/private", false, "4"},
+	}
+	for _, tt := range tests {
+		resp, body := mustGet(t, http.DefaultClient, ts.URL+tt.path)
+		if body != "hello "+tt.path {
+			t.Fatalf("%s: unexpected body %q", tt.path, body)
+		}
+		if fromCache := resp.Header.Get(naivehttpcache.XFromCache) == "1"; fromCache != tt.fromCache {
+			t.Fatalf("%s: expected from cache %t; got %t", tt.path, tt.fromCache, fromCache)
+		}
+		if got := resp.Header.Get("X-Hit"); got != tt.hit {
+			t.Fatalf("%s: expected X-Hit %s; got %s", tt.path, tt.hit, got)
+		}
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	ts := httptest.NewServer(naivehttpcache.Handler(next, naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache())))
+	defer ts.Close()
+
+	if resp, _ := mustGet(t, http.DefaultClient, ts.URL); resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected 500; got %d", resp.StatusCode)
+	}
+}
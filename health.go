@@ -0,0 +1,118 @@
+package naivehttpcache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Pinger is implemented by caches that can tell whether their backend is
+// healthy, see Transport.HealthCheckInterval.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ErrBackendUnhealthy is the error of cache operations that are skipped
+// because the backend is unhealthy, see Transport.HealthCheckInterval.
+var ErrBackendUnhealthy = errors.New("naivehttpcache: cache backend is unhealthy")
+
+// WithHealthCheckInterval makes Transport bypass the cache once its backend
+// fails, until a health check passes, see Transport.HealthCheckInterval.
+func WithHealthCheckInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.HealthCheckInterval = interval
+	}
+}
+
+// WithBackendHealthHandler sets a function that is called whenever the
+// backend becomes unhealthy or healthy again, e.g. to log it.
+func WithBackendHealthHandler(fn func(healthy bool)) Option {
+	return func(o *Options) {
+		o.OnBackendHealth = fn
+	}
+}
+
+// BackendBypassCount returns the number of cache operations of t that were
+// skipped because the backend was unhealthy.
+func (t *Transport) BackendBypassCount() uint64 {
+	t.health.mu.Lock()
+	defer t.health.mu.Unlock()
+	return t.health.bypassed
+}
+
+// backendHealth is the health of the cache backend.
+type backendHealth struct {
+	mu        sync.Mutex
+	unhealthy bool
+	// checkAt is when the backend may be checked again.
+	checkAt time.Time
+	// pinging is set while Ping is in flight.
+	pinging  bool
+	bypassed uint64
+}
+
+// bypassBackend reports whether cache operation op on key has to be skipped,
+// because the backend is unhealthy. The error is only returned by
+// BackendFailClosed.
+func (t *Transport) bypassBackend(op, key string) (bool, error) {
+	if t.HealthCheckInterval <= 0 {
+		return false, nil
+	}
+
+	h := &t.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.unhealthy {
+		return false, nil
+	}
+	if now := t.now(); !now.Before(h.checkAt) && !h.pinging {
+		h.checkAt = now.Add(t.HealthCheckInterval)
+		pinger, ok := t.Cache.(Pinger)
+		if !ok {
+			// this very operation checks the health
+			return false, nil
+		}
+		h.pinging = true
+		go t.ping(pinger)
+	}
+
+	h.bypassed++
+	if t.BackendErrors == BackendFailClosed {
+		return true, &CacheError{Op: op, Key: key, Err: ErrBackendUnhealthy}
+	}
+	return true, nil
+}
+
+// ping checks the health of the backend with pinger.
+func (t *Transport) ping(pinger Pinger) {
+	ctx, cancel := t.backendContext(context.Background())
+	defer cancel()
+	err := pinger.Ping(ctx)
+
+	t.health.mu.Lock()
+	t.health.pinging = false
+	t.health.mu.Unlock()
+	t.backendHealthy(err == nil)
+}
+
+// backendHealthy records whether the last operation of the backend succeeded.
+func (t *Transport) backendHealthy(healthy bool) {
+	if t.HealthCheckInterval <= 0 {
+		return
+	}
+
+	h := &t.health
+	h.mu.Lock()
+	changed := h.unhealthy == healthy
+	h.unhealthy = !healthy
+	if !healthy {
+		h.checkAt = t.now().Add(t.HealthCheckInterval)
+	}
+	h.mu.Unlock()
+
+	if changed && t.OnBackendHealth != nil {
+		t.OnBackendHealth(healthy)
+	}
+}
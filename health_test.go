@@ -0,0 +1,82 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+// pingingCache is failingCache that implements naivehttpcache.Pinger.
+type pingingCache struct {
+	*failingCache
+}
+
+func (c pingingCache) Ping(ctx context.Context) error {
+	_, _, err := c.Get(ctx, "ping")
+	return err
+}
+
+func TestHealthCheck(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	for _, pinger := range []bool{false, true} {
+		failing := newFailingCache()
+		var cache naivehttpcache.Cache = failing
+		if pinger {
+			cache = pingingCache{failing}
+		}
+
+		clock := newFakeClock()
+		var mu sync.Mutex
+		var changes []bool
+		transport := naivehttpcache.NewTransport(cache,
+			naivehttpcache.WithHealthCheckInterval(time.Minute),
+			naivehttpcache.WithClock(clock),
+			naivehttpcache.WithBackendHealthHandler(func(healthy bool) {
+				mu.Lock()
+				changes = append(changes, healthy)
+				mu.Unlock()
+			}),
+		)
+		client := &http.Client{Transport: transport}
+
+		// get fails, set is bypassed
+		mustGet(t, client, ts.URL)
+		mustGet(t, client, ts.URL)
+		if errors, bypassed := transport.BackendErrorCount(), transport.BackendBypassCount(); errors != 1 || bypassed != 3 {
+			t.Fatalf("pinger %v: expected 1 error and 3 bypasses; got %d and %d", pinger, errors, bypassed)
+		}
+
+		failing.failing = false
+		clock.Advance(time.Minute)
+		mustGet(t, client, ts.URL)
+		for i := 0; i < 100; i++ {
+			mu.Lock()
+			n := len(changes)
+			mu.Unlock()
+			if n == 2 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		mu.Lock()
+		if len(changes) != 2 || changes[0] || !changes[1] {
+			t.Fatalf("pinger %v: expected backend to become unhealthy and healthy again; got %v", pinger, changes)
+		}
+		mu.Unlock()
+
+		mustGet(t, client, ts.URL)
+		if resp, _ := mustGet(t, client, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+			t.Fatalf("pinger %v: expected the cache to be used again", pinger)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package naivehttpcache
+
+import (
+	"sync"
+	"time"
+)
+
+// WithRefreshInterval makes Transport refresh every key at most once per
+// interval, see Transport.RefreshInterval.
+func WithRefreshInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.RefreshInterval = interval
+	}
+}
+
+// refreshLimiter remembers when keys were refreshed last time.
+type refreshLimiter struct {
+	mu   sync.Mutex
+	last map[string]time.Time
+	// sweepAt is the size of last at which refreshes that are over are
+	// forgotten.
+	sweepAt int
+}
+
+// minSweepAt is the minimum refreshLimiter.sweepAt.
+const minSweepAt = 1024
+
+// allow reports whether key may be refreshed now, that is if it wasn't
+// refreshed during the last interval, and records the refresh if so.
+func (l *refreshLimiter) allow(key string, now time.Time, interval time.Duration) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if last, ok := l.last[key]; ok && now.Sub(last) < interval {
+		return false
+	}
+
+	if l.last == nil {
+		l.last = make(map[string]time.Time)
+	}
+	if len(l.last) >= l.sweepAt {
+		for k, last := range l.last {
+			if now.Sub(last) >= interval {
+				delete(l.last, k)
+			}
+		}
+		l.sweepAt = 2 * len(l.last)
+		if l.sweepAt < minSweepAt {
+			l.sweepAt = minSweepAt
+		}
+	}
+	l.last[key] = now
+	return true
+}
@@ -0,0 +1,58 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestRefreshInterval(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if hits > 1 {
+			// refreshes are not stored (see StatusTTLs below), so the entry
+			// stays expired
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		w.Write([]byte("v" + strconv.Itoa(hits)))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithRefreshInterval(10*time.Second),
+			naivehttpcache.WithStatusTTLs(map[int]time.Duration{http.StatusServiceUnavailable: 0}),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	mustGet(t, client, ts.URL)
+	clock.Advance(2 * time.Minute)
+
+	if _, body := mustGet(t, client, ts.URL); body != "v2" {
+		t.Fatalf("expected refresh from the server; got %q", body)
+	}
+	for i := 0; i < 3; i++ {
+		resp, body := mustGet(t, client, ts.URL)
+		if body != "v1" || resp.Header.Get("warning") == "" {
+			t.Fatalf("expected stale v1 with warning; got %q", body)
+		}
+	}
+
+	clock.Advance(10 * time.Second)
+	if _, body := mustGet(t, client, ts.URL); body != "v3" {
+		t.Fatalf("expected refresh from the server; got %q", body)
+	}
+	if hits != 3 {
+		t.Fatalf("expected 3 server hits; got %d", hits)
+	}
+}
@@ -0,0 +1,136 @@
+package naivehttpcache
+
+import (
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// asciiURL returns u with internationalized labels of the host converted to
+// punycode, so both forms of the host share entries. u is returned as is if
+// the host is ASCII already.
+func asciiURL(u *url.URL) *url.URL {
+	if isASCII(u.Host) {
+		return u
+	}
+	host := asciiHost(u.Hostname())
+	if port := u.Port(); port != "" {
+		host += ":" + port
+	}
+	ascii := *u
+	ascii.Host = host
+	return &ascii
+}
+
+// asciiHost converts non-ASCII labels of host to their lowercased punycode
+// form, as IDNA does (but without the rest of its mapping). Labels that can't
+// be converted are left alone.
+func asciiHost(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if isASCII(label) || !utf8.ValidString(label) {
+			continue
+		}
+		labels[i] = "xn--" + punycode(strings.ToLower(label))
+	}
+	return strings.Join(labels, ".")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// Parameters of punycode, see RFC 3492 section 5.
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// punycode encodes label as described in RFC 3492 section 6.3.
+func punycode(label string) string {
+	runes := []rune(label)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	if basic > 0 {
+		out = append(out, '-')
+	}
+
+	n, delta, bias := rune(punycodeInitialN), 0, punycodeInitialBias
+	for handled := basic; handled < len(runes); {
+		// the next code point to insert is the smallest one not handled yet
+		m := rune(utf8.MaxRune)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (handled + 1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punycodeBase; ; k += punycodeBase {
+				t := k - bias
+				if t < punycodeTMin {
+					t = punycodeTMin
+				} else if t > punycodeTMax {
+					t = punycodeTMax
+				}
+				if q < t {
+					break
+				}
+				out = append(out, punycodeDigit(t+(q-t)%(punycodeBase-t)))
+				q = (q - t) / (punycodeBase - t)
+			}
+			out = append(out, punycodeDigit(q))
+			bias = punycodeAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out)
+}
+
+func punycodeAdapt(delta, points int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / points
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+func punycodeDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
@@ -0,0 +1,31 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestInternationalizedHostKey(t *testing.T) {
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0))
+
+	for _, tt := range []struct {
+		url   string
+		ascii string
+	}{
+		{"https://bücher.example/x", "https://xn--bcher-kva.example/x"},
+		{"https://BÜCHER.example:8443/x", "https://xn--bcher-kva.example:8443/x"},
+		{"https://münchen.例え.jp/", "https://xn--mnchen-3ya.xn--r8jz45g.jp/"},
+		{"https://日本語.jp/", "https://xn--wgv71a119e.jp/"},
+		{"https://xn--bcher-kva.example/x", "https://xn--bcher-kva.example/x"},
+	} {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key := transport.CacheKey(req); key != tt.ascii {
+			t.Errorf("%s: expected key %q; got %q", tt.url, tt.ascii, key)
+		}
+	}
+}
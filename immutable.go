@@ -0,0 +1,45 @@
+package naivehttpcache
+
+import "net/http"
+
+// WithImmutable makes Transport trust Cache-Control: immutable of responses,
+// see Transport.Immutable.
+func WithImmutable() Option {
+	return func(o *Options) {
+		o.Immutable = true
+	}
+}
+
+// WithImmutableForever makes Transport trust Cache-Control: immutable of
+// responses and keep ones without a lifetime of their own fresh forever, see
+// Transport.ImmutableForever.
+func WithImmutableForever() Option {
+	return func(o *Options) {
+		o.Immutable = true
+		o.ImmutableForever = true
+	}
+}
+
+// immutable reports whether response with header is immutable, as far as t is
+// concerned.
+func (t *Transport) immutable(header http.Header) bool {
+	return t.Immutable && parseCacheControl(header).has("immutable")
+}
+
+// lookupImmutable is lookup for requests asking to revalidate cached
+// responses, which only returns fresh immutable ones.
+func (t *Transport) lookupImmutable(req *http.Request, cacheKey string) ([]byte, bool, error) {
+	val, ok, err := t.cacheGet(req.Context(), cacheKey)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	resp, storedAt, ok, err := t.decode(req, cacheKey, val)
+	if err != nil || !ok || !t.immutable(resp.Header) {
+		return nil, false, err
+	}
+	fresh, err := t.fresh(req, nil, t.meta(resp.StatusCode, resp.Header, storedAt))
+	if err != nil || !fresh {
+		return nil, false, nil
+	}
+	return val, true, nil
+}
@@ -0,0 +1,91 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestImmutable(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		if r.URL.Path == "/app.123.js" {
+			w.Header().Set("cache-control", "max-age=60, immutable")
+		} else {
+			w.Header().Set("cache-control", "max-age=60")
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithSharedCache(),
+			naivehttpcache.WithRequestCacheControl(),
+			naivehttpcache.WithImmutable(),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	reload := func(path string) {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.Header.Set("cache-control", "no-cache")
+		fetch(t, client, req)
+	}
+	for _, path := range []string{"/app.123.js", "/index.html"} {
+		mustGet(t, client, ts.URL+path)
+		reload(path)
+	}
+	if hits["/app.123.js"] != 1 || hits["/index.html"] != 2 {
+		t.Fatalf("expected only mutable response to be revalidated on reload; got %v", hits)
+	}
+
+	clock.Advance(time.Minute + time.Second)
+	if resp, _ := mustGet(t, client, ts.URL+"/app.123.js"); resp.Header.Get(naivehttpcache.XFromCache) == "1" {
+		t.Fatal("expected immutable response to become stale at the end of its lifetime")
+	}
+}
+
+func TestImmutableForever(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/app.123.js":
+			w.Header().Set("cache-control", "immutable")
+		case "/app.456.js":
+			w.Header().Set("cache-control", "max-age=60, immutable")
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithSharedCache(),
+			naivehttpcache.WithImmutableForever(),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	paths := []string{"/app.123.js", "/app.456.js", "/index.html"}
+	for _, path := range paths {
+		mustGet(t, client, ts.URL+path)
+	}
+	clock.Advance(time.Hour)
+	for _, path := range paths {
+		mustGet(t, client, ts.URL+path)
+	}
+	if hits["/app.123.js"] != 1 || hits["/app.456.js"] != 2 || hits["/index.html"] != 2 {
+		t.Fatalf("expected only immutable response without a lifetime to stay fresh; got %v", hits)
+	}
+}
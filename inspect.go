@@ -0,0 +1,82 @@
+package naivehttpcache
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// EntryInfo describes an entry of the cache. Its Header is the one that would
+// be served, and its Date is zero if the entry doesn't tell when it was stored.
+type EntryInfo struct {
+	EntryMeta
+	// Key is the key of the entry.
+	Key string
+	// Size is the size of the stored body.
+	Size int64
+	// Fresh tells whether the entry is fresh, as lookups would see it
+	// (directives of requests aside).
+	Fresh bool
+	// Expires is when the entry stops being fresh, zero if never or if it's
+	// up to Transport.Freshness.
+	Expires time.Time
+}
+
+// Inspect describes the entry of GET request to rawurl with ctx (which may be
+// needed for the partition). False means that there's no such entry, or that
+// it's corrupt or banned, which is handled as lookups handle it.
+func (t *Transport) Inspect(ctx context.Context, rawurl string) (EntryInfo, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return EntryInfo{}, false, err
+	}
+	return t.InspectRequest(req)
+}
+
+// InspectRequest describes the entry of req.
+func (t *Transport) InspectRequest(req *http.Request) (EntryInfo, bool, error) {
+	key := t.CacheKey(req)
+	val, ok, err := t.cacheGet(req.Context(), key)
+	if err != nil || !ok {
+		return EntryInfo{}, false, err
+	}
+	val, ok, err = t.usable(req.Context(), key, val)
+	if err != nil || !ok {
+		return EntryInfo{}, false, err
+	}
+	info, err := t.inspect(req, key, val)
+	if err != nil {
+		return EntryInfo{}, false, err
+	}
+	return info, true, nil
+}
+
+// inspect describes entry val stored under key for req.
+func (t *Transport) inspect(req *http.Request, key string, val []byte) (EntryInfo, error) {
+	// bodies of entries are not copied by decoding, so there's no need in a
+	// special decoder for the rest
+	resp, storedAt, err := decodeResponse(val, req)
+	if err != nil {
+		return EntryInfo{}, err
+	}
+
+	info := EntryInfo{
+		EntryMeta: t.meta(resp.StatusCode, resp.Header, storedAt),
+		Key:       key,
+		Size:      resp.ContentLength,
+	}
+	// undated entries are described anyway, as far as they can be
+	info.Fresh, err = t.fresh(req, nil, info.EntryMeta)
+	if err != nil && err != errNoDate {
+		return EntryInfo{}, err
+	}
+	if t.Freshness == nil && !storedAt.IsZero() {
+		if lifetime, ok := t.lifetime(info.EntryMeta); ok {
+			info.Expires = storedAt.Add(lifetime)
+		}
+	}
+	t.stripHeaders(resp)
+	delStoredHeaders(resp.Header)
+	info.Header = resp.Header
+	return info, nil
+}
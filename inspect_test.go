@@ -0,0 +1,103 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestInspect(t *testing.T) {
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("etag", `"v1"`)
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	transport := naivehttpcache.NewTransport(
+		naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithClock(clock),
+	)
+	ctx := context.Background()
+
+	if _, ok, err := transport.Inspect(ctx, ts.URL); ok || err != nil {
+		t.Fatalf("expected no entry; got %v, %v", ok, err)
+	}
+
+	stored := clock.Now()
+	mustGet(t, &http.Client{Transport: transport}, ts.URL)
+	clock.Advance(2 * time.Minute)
+
+	info, ok, err := transport.Inspect(ctx, ts.URL)
+	if err != nil || !ok {
+		t.Fatalf("expected an entry; got %v, %v", ok, err)
+	}
+	switch {
+	case info.Key != ts.URL:
+		t.Errorf("expected key %q; got %q", ts.URL, info.Key)
+	case info.StatusCode != http.StatusOK || info.Size != 5 || info.Header.Get("etag") != `"v1"`:
+		t.Errorf("expected 200 of 5 bytes with etag; got %+v", info)
+	case info.Fresh:
+		t.Error("expected entry to be stale")
+	case info.Age() < 2*time.Minute || info.Age() > 2*time.Minute+time.Second:
+		t.Errorf("expected age of 2m; got %v", info.Age())
+	case !info.Expires.Equal(info.Date.Add(time.Minute)) || info.Date.After(stored):
+		t.Errorf("expected expiry a minute after %v; got %v", info.Date, info.Expires)
+	}
+}
+
+func TestInspectStored(t *testing.T) {
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/plain")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	ctx := context.Background()
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	clock := newFakeClock()
+	transport := naivehttpcache.NewTransport(cache,
+		naivehttpcache.WithClock(clock),
+		naivehttpcache.WithContentTTLs(naivehttpcache.ContentTTL{Pattern: "text/plain", TTL: time.Minute}),
+		naivehttpcache.WithCorruptEntryHandler(func(key string, err error) {}),
+	)
+	client := &http.Client{Transport: transport}
+	key := transport.CacheKey(httptest.NewRequest(http.MethodGet, ts.URL, nil))
+
+	mustGet(t, client, ts.URL)
+	info, ok, err := transport.Inspect(ctx, ts.URL)
+	if err != nil || !ok {
+		t.Fatalf("expected an entry; got %v, %v", ok, err)
+	}
+	if !info.Fresh || info.Header.Get("Naivehttpcache-Ttl") != "" {
+		t.Fatalf("expected fresh entry without internal headers; got %+v", info)
+	}
+
+	// dumped by older versions of the package, without Date
+	cache.Set(ctx, key, []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nhello"), 0)
+	info, ok, err = transport.Inspect(ctx, ts.URL)
+	if err != nil || !ok || !info.Date.IsZero() || info.Size != 5 {
+		t.Fatalf("expected undated entry to be described; got %+v, %v, %v", info, ok, err)
+	}
+
+	// a truncated entry of the current format
+	mustGet(t, client, ts.URL+"?other")
+	val, _, _ := cache.Get(ctx, transport.CacheKey(httptest.NewRequest(http.MethodGet, ts.URL+"?other", nil)))
+	cache.Set(ctx, key, val[:len(val)-2], 0)
+	if _, ok, err := transport.Inspect(ctx, ts.URL); ok || err != nil || transport.CorruptEntryCount() != 1 {
+		t.Fatalf("expected corrupt entry to be missing; got %v, %v", ok, err)
+	}
+
+	mustGet(t, client, ts.URL)
+	clock.Advance(time.Second)
+	transport.Ban(func(key string, meta naivehttpcache.EntryMeta) bool { return true })
+	if _, ok, err := transport.Inspect(ctx, ts.URL); ok || err != nil {
+		t.Fatalf("expected banned entry to be missing; got %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,106 @@
+package naivehttpcache
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sweep deletes entries of the cache that can't be served anymore, not even
+// stale, as lookups of them would. It returns the number of deleted entries.
+// Transports with Revalidate, StaleIfError or RefreshInterval serve entries
+// however stale they are, so nothing is swept for them, unless StaleGrace
+// bounds it.
+func (t *Transport) Sweep(ctx context.Context) (int, error) {
+	deleted := 0
+	var err error
+	walkErr := t.walkEntries(ctx, func(key string, val []byte) bool {
+		if !t.sweepable(key, val) {
+			return true
+		}
+		if err = t.cacheDelete(ctx, key); err != nil {
+			return false
+		}
+		t.emit(EventEvict, key, 0)
+		deleted++
+		return true
+	})
+	if err == nil {
+		err = walkErr
+	}
+	return deleted, err
+}
+
+// RunJanitor sweeps the cache every interval until ctx is done, or until t is
+// closed, see Sweep and Close. It's meant to be run in its own goroutine.
+func (t *Transport) RunJanitor(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	closed := t.closedChan()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-closed:
+			return nil
+		case <-ticker.C:
+		}
+		if _, err := t.Sweep(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+}
+
+// sweepable reports whether entry val stored under key can't be served
+// anymore. Values that can't be decoded are left alone.
+func (t *Transport) sweepable(key string, val []byte) bool {
+	meta, err := t.entryMeta(key, val)
+	if err != nil {
+		return false
+	}
+	req, err := http.NewRequest(http.MethodGet, KeyURL(key), nil)
+	if err != nil {
+		return false
+	}
+	return t.expired(req, meta)
+}
+
+// entryMeta describes entry val stored under key, which is either a full or a
+// partial one. Date and CachedAt are zero if they are not known.
+func (t *Transport) entryMeta(key string, val []byte) (EntryMeta, error) {
+	if strings.HasPrefix(key, partialKey("")) {
+		entry, err := decodePartialEntry(val)
+		if err != nil {
+			return EntryMeta{}, err
+		}
+		return t.partialMeta(entry), nil
+	}
+	resp, storedAt, err := decodeResponse(val, nil)
+	if err != nil {
+		return EntryMeta{}, err
+	}
+	meta := t.meta(resp.StatusCode, resp.Header, storedAt)
+	meta.CachedAt = entryCachedAt(val)
+	return meta, nil
+}
+
+// expired reports whether cached response described by meta to req can't be
+// served anymore, not even stale.
+func (t *Transport) expired(req *http.Request, meta EntryMeta) bool {
+	fresh, err := t.fresh(req, nil, meta)
+	if err != nil || fresh {
+		return false
+	}
+	if t.keepsStale() && t.StaleGrace > 0 {
+		return t.pastGrace(meta)
+	}
+	if t.Revalidate || t.StaleIfError || t.RefreshInterval > 0 {
+		return false
+	}
+	if t.StaleWhileLocked > 0 && !t.mustRevalidate(meta.Header) {
+		staleness, err := t.staleness(meta)
+		return err == nil && staleness > t.StaleWhileLocked
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestSweep(t *testing.T) {
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	clock := newFakeClock()
+	transport := naivehttpcache.NewTransport(cache,
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithClock(clock),
+	)
+	client := &http.Client{Transport: transport}
+
+	mustGet(t, client, ts.URL+"/a")
+	clock.Advance(30 * time.Second)
+	mustGet(t, client, ts.URL+"/b")
+	clock.Advance(45 * time.Second)
+
+	deleted, err := transport.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 || cache.Len() != 1 {
+		t.Fatalf("expected expired /a to be swept; got %d deleted and %d left", deleted, cache.Len())
+	}
+	if resp, _ := mustGet(t, client, ts.URL+"/b"); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected fresh /b to be kept")
+	}
+
+	transport = naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()))
+	if _, err := transport.Sweep(context.Background()); err != naivehttpcache.ErrNotWalkable {
+		t.Fatalf("expected ErrNotWalkable; got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package naivehttpcache
+
+import "sync"
+
+// keyLocks is a set of mutexes by key, created on demand and dropped once
+// nobody holds or waits for them. Zero value is ready to use.
+type keyLocks struct {
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mu sync.Mutex
+	// refs is the number of holders and waiters, guarded by keyLocks.mu.
+	refs int
+}
+
+// lock locks key, waiting for the current holder if there is one.
+func (l *keyLocks) lock(key string) (unlock func()) {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = map[string]*keyLock{}
+	}
+	kl, ok := l.locks[key]
+	if !ok {
+		kl = &keyLock{}
+		l.locks[key] = kl
+	}
+	kl.refs++
+	l.mu.Unlock()
+
+	kl.mu.Lock()
+	return l.unlocker(key, kl)
+}
+
+// tryLock locks key unless it's already held (or waited for) by someone else.
+func (l *keyLocks) tryLock(key string) (unlock func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.locks[key]; ok {
+		return nil, false
+	}
+	if l.locks == nil {
+		l.locks = map[string]*keyLock{}
+	}
+	kl := &keyLock{refs: 1}
+	// nobody else knows about kl yet, so this never blocks
+	kl.mu.Lock()
+	l.locks[key] = kl
+	return l.unlocker(key, kl), true
+}
+
+func (l *keyLocks) unlocker(key string, kl *keyLock) func() {
+	return func() {
+		kl.mu.Unlock()
+		l.mu.Lock()
+		kl.refs--
+		if kl.refs == 0 {
+			delete(l.locks, key)
+		}
+		l.mu.Unlock()
+	}
+}
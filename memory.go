@@ -0,0 +1,229 @@
+package naivehttpcache
+
+import (
+	"container/heap"
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// EvictReason states why MemoryCache evicted an entry.
+type EvictReason int
+
+const (
+	// EvictBytes means that the entry didn't fit into MaxBytes.
+	EvictBytes EvictReason = iota
+	// EvictEntries means that the entry didn't fit into MaxEntries.
+	EvictEntries
+	// EvictExpired means that ttl of the entry passed.
+	EvictExpired
+)
+
+// MemoryCache is Cache that keeps entries in memory and evicts least recently
+// used ones once it's over its limits. Entries with ttls are removed once they
+// expire, by the first operation that follows (or by RemoveExpired). Zero
+// MemoryCache is unlimited and ready to use. Fields must not be changed once
+// it's in use.
+type MemoryCache struct {
+	// MaxBytes, if positive, is the maximum summary size of keys and values.
+	MaxBytes int64
+	// MaxEntries, if positive, is the maximum number of entries.
+	MaxEntries int
+	// OnEvict, if set, is called with keys of evicted entries. It must not
+	// use the cache.
+	OnEvict func(key string, reason EvictReason)
+	// Clock tells the time for ttls. If nil, the system clock is used.
+	Clock Clock
+
+	mu sync.Mutex
+	// lru holds entries, the most recently used ones are at the front.
+	lru   *list.List
+	items map[string]*list.Element
+	bytes int64
+	// expiring holds entries with ttls, the one to expire first on top.
+	expiring expiryHeap
+}
+
+// memoryEntry is an element of MemoryCache.lru.
+type memoryEntry struct {
+	key     string
+	val     []byte
+	expires time.Time
+	// index is the index in MemoryCache.expiring, if expires is set.
+	index int
+}
+
+func (e *memoryEntry) size() int64 {
+	return int64(len(e.key) + len(e.val))
+}
+
+// NewMemoryCache returns MemoryCache limited to maxBytes and maxEntries,
+// non-positive values mean no limit.
+func NewMemoryCache(maxBytes int64, maxEntries int) *MemoryCache {
+	return &MemoryCache{MaxBytes: maxBytes, MaxEntries: maxEntries}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*memoryEntry)
+	c.lru.MoveToFront(el)
+	return e.val, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	e := &memoryEntry{key: key, val: val}
+	if ttl > 0 {
+		e.expires = c.now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(e)
+	return nil
+}
+
+// set stores e as the most recently used entry, it must be called with mu
+// held.
+func (c *MemoryCache) set(e *memoryEntry) {
+	if c.lru == nil {
+		c.lru = list.New()
+		c.items = make(map[string]*list.Element)
+	}
+	c.removeExpired()
+	if el, ok := c.items[e.key]; ok {
+		c.remove(el)
+	}
+	if c.MaxBytes > 0 && e.size() > c.MaxBytes {
+		// it would evict everything and still wouldn't fit
+		return
+	}
+
+	c.items[e.key] = c.lru.PushFront(e)
+	c.bytes += e.size()
+	if !e.expires.IsZero() {
+		heap.Push(&c.expiring, e)
+	}
+
+	for c.MaxBytes > 0 && c.bytes > c.MaxBytes {
+		c.evict(c.lru.Back(), EvictBytes)
+	}
+	for c.MaxEntries > 0 && c.lru.Len() > c.MaxEntries {
+		c.evict(c.lru.Back(), EvictEntries)
+	}
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+// Len returns the number of entries in the cache.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return 0
+	}
+	c.removeExpired()
+	return c.lru.Len()
+}
+
+// Bytes returns the summary size of keys and values in the cache.
+func (c *MemoryCache) Bytes() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return 0
+	}
+	c.removeExpired()
+	return c.bytes
+}
+
+// RemoveExpired removes entries which ttls passed and returns their number.
+// Operations of the cache do that anyway, it's only needed to release memory
+// of caches that are idle.
+func (c *MemoryCache) RemoveExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return 0
+	}
+	return c.removeExpired()
+}
+
+// removeExpired is RemoveExpired for callers holding mu.
+func (c *MemoryCache) removeExpired() int {
+	n := 0
+	now := c.now()
+	for len(c.expiring) > 0 && !now.Before(c.expiring[0].expires) {
+		c.evict(c.items[c.expiring[0].key], EvictExpired)
+		n++
+	}
+	return n
+}
+
+// evict removes el and reports it to OnEvict.
+func (c *MemoryCache) evict(el *list.Element, reason EvictReason) {
+	c.remove(el)
+	if c.OnEvict != nil {
+		c.OnEvict(el.Value.(*memoryEntry).key, reason)
+	}
+}
+
+func (c *MemoryCache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*memoryEntry)
+	delete(c.items, e.key)
+	c.bytes -= e.size()
+	if !e.expires.IsZero() {
+		heap.Remove(&c.expiring, e.index)
+	}
+}
+
+func (c *MemoryCache) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// expiryHeap is heap.Interface of entries ordered by expiry.
+type expiryHeap []*memoryEntry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	e := x.(*memoryEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return e
+}
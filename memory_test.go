@@ -0,0 +1,115 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestMemoryCacheMaxEntries(t *testing.T) {
+	ctx := context.Background()
+	evicted := map[string]naivehttpcache.EvictReason{}
+	cache := naivehttpcache.NewMemoryCache(0, 2)
+	cache.OnEvict = func(key string, reason naivehttpcache.EvictReason) {
+		evicted[key] = reason
+	}
+
+	cache.Set(ctx, "a", []byte("1"), 0)
+	cache.Set(ctx, "b", []byte("2"), 0)
+	// a is used more recently than b now
+	cache.Get(ctx, "a")
+	cache.Set(ctx, "c", []byte("3"), 0)
+
+	if _, ok, _ := cache.Get(ctx, "b"); ok {
+		t.Fatal("expected least recently used b to be evicted")
+	}
+	if reason, ok := evicted["b"]; !ok || reason != naivehttpcache.EvictEntries || len(evicted) != 1 {
+		t.Fatalf("expected b to be evicted for the count; got %v", evicted)
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok, _ := cache.Get(ctx, key); !ok {
+			t.Fatalf("expected %s to be kept", key)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Fatalf("expected 2 entries; got %d", cache.Len())
+	}
+}
+
+func TestMemoryCacheMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	cache := naivehttpcache.NewMemoryCache(10, 0)
+
+	cache.Set(ctx, "a", []byte("1234"), 0)
+	cache.Set(ctx, "b", []byte("1234"), 0)
+	cache.Set(ctx, "c", []byte("1234"), 0)
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Fatal("expected a to be evicted")
+	}
+	if cache.Bytes() != 10 {
+		t.Fatalf("expected 10 bytes; got %d", cache.Bytes())
+	}
+
+	// too large to fit at all
+	cache.Set(ctx, "d", []byte("1234567890"), 0)
+	if _, ok, _ := cache.Get(ctx, "d"); ok || cache.Len() != 2 {
+		t.Fatal("expected d not to be stored")
+	}
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	cache := &naivehttpcache.MemoryCache{Clock: clock}
+
+	cache.Set(ctx, "a", []byte("1"), time.Minute)
+	if _, ok, _ := cache.Get(ctx, "a"); !ok {
+		t.Fatal("expected a to be alive")
+	}
+	clock.Advance(time.Minute)
+	if _, ok, _ := cache.Get(ctx, "a"); ok || cache.Len() != 0 {
+		t.Fatal("expected a to expire")
+	}
+
+	// expired entries are removed without being asked for
+	var evicted []string
+	cache.OnEvict = func(key string, reason naivehttpcache.EvictReason) {
+		if reason != naivehttpcache.EvictExpired {
+			t.Errorf("expected %s to expire; got reason %d", key, reason)
+		}
+		evicted = append(evicted, key)
+	}
+	cache.Set(ctx, "b", []byte("1"), 2*time.Minute)
+	cache.Set(ctx, "c", []byte("1"), time.Minute)
+	cache.Set(ctx, "d", []byte("1"), 0)
+	clock.Advance(2 * time.Minute)
+	if n := cache.RemoveExpired(); n != 2 || len(evicted) != 2 || evicted[0] != "c" || evicted[1] != "b" {
+		t.Fatalf("expected c and b to expire in order; got %d %v", n, evicted)
+	}
+	if cache.Len() != 1 || cache.Bytes() != 2 {
+		t.Fatalf("expected only d to be left; got %d entries", cache.Len())
+	}
+}
+
+func TestMemoryCacheTransport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	cache := naivehttpcache.NewMemoryCache(0, 1)
+	client := &http.Client{Transport: naivehttpcache.NewTransport(cache)}
+
+	mustGet(t, client, ts.URL+"/a")
+	mustGet(t, client, ts.URL+"/b")
+	if resp, _ := mustGet(t, client, ts.URL+"/b"); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected /b to be cached")
+	}
+	if resp, _ := mustGet(t, client, ts.URL+"/a"); resp.Header.Get(naivehttpcache.XFromCache) != "" {
+		t.Fatal("expected /a to be evicted")
+	}
+}
@@ -0,0 +1,226 @@
+package naivehttpcache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Outcome is how RoundTrip served a request.
+type Outcome int
+
+const (
+	// OutcomeMiss means that the response came from the server.
+	OutcomeMiss Outcome = iota
+	// OutcomeHit means that a fresh response was served from the cache.
+	OutcomeHit
+	// OutcomeRevalidated means that an expired response was revalidated with
+	// the server and served from the cache.
+	OutcomeRevalidated
+	// OutcomeStale means that an expired response was served from the cache
+	// as is (e.g. because the server failed).
+	OutcomeStale
+	// OutcomeBypass means that the request was not cacheable (e.g. it's not
+	// GET) and went straight to the server.
+	OutcomeBypass
+
+	numOutcomes = iota
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeMiss:
+		return "miss"
+	case OutcomeHit:
+		return "hit"
+	case OutcomeRevalidated:
+		return "revalidated"
+	case OutcomeStale:
+		return "stale"
+	case OutcomeBypass:
+		return "bypass"
+	}
+	return "unknown"
+}
+
+// LatencyBuckets are upper bounds of buckets of latency histograms in Metrics.
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	2 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram is a latency histogram.
+type Histogram struct {
+	// Counts holds the number of observations per bucket of LatencyBuckets,
+	// the last one is for observations over all of them.
+	Counts []uint64
+	// Count and Sum are the number and the sum of all observations.
+	Count uint64
+	Sum   time.Duration
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	if h.Counts == nil {
+		h.Counts = make([]uint64, len(LatencyBuckets)+1)
+	}
+	i := 0
+	for i < len(LatencyBuckets) && d > LatencyBuckets[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+// Mean returns the mean of observations.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Metrics are the metrics of RoundTrip of Transport. Latency is the time it
+// takes RoundTrip to return, bodies are not accounted. Requests that Transport
+// makes itself in the background (e.g. prefetches) are not accounted either.
+type Metrics struct {
+	// Latency holds latencies by Outcome of successful round trips.
+	Latency [numOutcomes]Histogram
+	// Errors is the number of failed round trips.
+	Errors uint64
+	// Stores is the number of writes of entries to the cache, StoreErrors is
+	// the number of them that failed, were skipped because the backend was
+	// unhealthy or were dropped by WriteBehind.
+	Stores      uint64
+	StoreErrors uint64
+	// CacheBytes is the number of bytes of bodies served from the cache.
+	// OriginBytes is the number of bytes of bodies of responses of the server
+	// read through Transport.
+	CacheBytes  uint64
+	OriginBytes uint64
+}
+
+// Count returns the number of successful round trips with outcome.
+func (m Metrics) Count(outcome Outcome) uint64 {
+	return m.Latency[outcome].Count
+}
+
+// HitRatio returns the share of cacheable requests that were served from the
+// cache, fresh, revalidated or stale.
+func (m Metrics) HitRatio() float64 {
+	hits := m.Count(OutcomeHit) + m.Count(OutcomeRevalidated) + m.Count(OutcomeStale)
+	total := hits + m.Count(OutcomeMiss)
+	if total == 0 {
+		return 0
+	}
+	return float64(hits) / float64(total)
+}
+
+// WithObserver sets a function that is called with the outcome and latency
+// of every successful round trip, e.g. to export them, see Transport.Observer.
+func WithObserver(fn func(outcome Outcome, latency time.Duration)) Option {
+	return func(o *Options) {
+		o.Observer = fn
+	}
+}
+
+// Metrics returns the metrics of t so far.
+func (t *Transport) Metrics() Metrics {
+	t.metrics.mu.Lock()
+	defer t.metrics.mu.Unlock()
+
+	m := t.metrics.m
+	for i := range m.Latency {
+		m.Latency[i].Counts = append([]uint64(nil), m.Latency[i].Counts...)
+	}
+	m.Stores = atomic.LoadUint64(&t.stores)
+	m.StoreErrors = atomic.LoadUint64(&t.storeErrors)
+	m.CacheBytes = atomic.LoadUint64(&t.cacheBytes)
+	m.OriginBytes = atomic.LoadUint64(&t.originBytes)
+	return m
+}
+
+// countStore counts a write of an entry to the cache with ctx, which failed
+// unless ok. Writes of requests made in the background are not counted.
+func (t *Transport) countStore(ctx context.Context, ok bool) {
+	if inBackground(ctx) {
+		return
+	}
+	if ok {
+		atomic.AddUint64(&t.stores, 1)
+	} else {
+		atomic.AddUint64(&t.storeErrors, 1)
+	}
+}
+
+// countBody makes bytes of the body of resp served with outcome counted by
+// CacheBytes or OriginBytes. Bodies served from the cache as they are stored
+// are counted at once, others as they are read. Bodies of upgraded
+// connections are not counted, they must reach the caller as they are.
+func (t *Transport) countBody(resp *http.Response, outcome Outcome) {
+	counter := &t.originBytes
+	if outcome != OutcomeMiss && outcome != OutcomeBypass {
+		counter = &t.cacheBytes
+	}
+	switch body := resp.Body.(type) {
+	case nil:
+	case *cachedBody:
+		atomic.AddUint64(counter, uint64(body.Len()))
+	default:
+		if resp.StatusCode != http.StatusSwitchingProtocols && body != http.NoBody {
+			resp.Body = &countingReadCloser{ReadCloser: body, n: counter}
+		}
+	}
+}
+
+// countingReadCloser is ReadCloser that adds the number of bytes read to n.
+type countingReadCloser struct {
+	io.ReadCloser
+	n *uint64
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddUint64(r.n, uint64(n))
+	return n, err
+}
+
+// metrics collects Metrics.
+type metrics struct {
+	mu sync.Mutex
+	m  Metrics
+}
+
+// observe records round trip that started at start.
+func (t *Transport) observe(outcome Outcome, start time.Time, err error) {
+	latency := time.Since(start)
+
+	t.metrics.mu.Lock()
+	if err != nil {
+		t.metrics.m.Errors++
+	} else {
+		t.metrics.m.Latency[outcome].observe(latency)
+	}
+	t.metrics.mu.Unlock()
+
+	if err == nil {
+		t.trackHitRatio(outcome)
+	}
+	if err == nil && t.Observer != nil {
+		t.Observer(outcome, latency)
+	}
+}
@@ -0,0 +1,105 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestMetrics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("if-none-match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("etag", `"v1"`)
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	observed := map[naivehttpcache.Outcome]int{}
+	transport := naivehttpcache.NewTransport(
+		naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithRevalidate(),
+		naivehttpcache.WithClock(clock),
+		naivehttpcache.WithObserver(func(outcome naivehttpcache.Outcome, latency time.Duration) {
+			observed[outcome]++
+		}),
+	)
+	client := &http.Client{Transport: transport}
+
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	clock.Advance(2 * time.Minute)
+	mustGet(t, client, ts.URL)
+	client.Post(ts.URL, "text/plain", nil)
+
+	m := transport.Metrics()
+	for outcome, expected := range map[naivehttpcache.Outcome]uint64{
+		naivehttpcache.OutcomeMiss:        1,
+		naivehttpcache.OutcomeHit:         2,
+		naivehttpcache.OutcomeRevalidated: 1,
+		naivehttpcache.OutcomeBypass:      1,
+	} {
+		if got := m.Count(outcome); got != expected {
+			t.Errorf("expected %d %s; got %d", expected, outcome, got)
+		}
+		if got := observed[outcome]; uint64(got) != expected {
+			t.Errorf("expected %d observed %s; got %d", expected, outcome, got)
+		}
+	}
+	if ratio := m.HitRatio(); ratio != 0.75 {
+		t.Errorf("expected hit ratio of 0.75; got %v", ratio)
+	}
+
+	var buckets uint64
+	for _, n := range m.Latency[naivehttpcache.OutcomeHit].Counts {
+		buckets += n
+	}
+	if buckets != 2 {
+		t.Errorf("expected 2 hit latencies; got %d", buckets)
+	}
+}
+
+func TestMetricsStoresAndBytes(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	cache := newFailingCache()
+	cache.failing = false
+	transport := naivehttpcache.NewTransport(cache,
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithBackendErrorHandler(func(err *naivehttpcache.CacheError) {}),
+	)
+	client := &http.Client{Transport: transport}
+
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	cache.failing = true
+	mustGet(t, client, ts.URL+"/other")
+	if err := transport.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	m := transport.Metrics()
+	if m.Stores != 1 || m.StoreErrors != 1 {
+		t.Errorf("expected 1 store and 1 store error; got %d and %d", m.Stores, m.StoreErrors)
+	}
+	if m.CacheBytes != 10 {
+		t.Errorf("expected 10 bytes from cache; got %d", m.CacheBytes)
+	}
+	if m.OriginBytes != 10 {
+		t.Errorf("expected 10 bytes from origin; got %d", m.OriginBytes)
+	}
+}
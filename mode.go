@@ -0,0 +1,101 @@
+package naivehttpcache
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Mode states how Transport uses the cache and the network.
+type Mode int
+
+const (
+	// ModeDefault serves fresh entries from the cache and stores responses
+	// that came from the network. This is the default.
+	ModeDefault Mode = iota
+	// ModeRecord sends every request to the network and stores every
+	// response to it (of any status, regardless of freshness and policies),
+	// so it can be replayed later with ModeReplay. Only event streams and
+	// partial responses (without PartialContent) are not recorded.
+	ModeRecord
+	// ModeReplay serves responses only from the cache, as they are (fresh or
+	// not), and never touches the network. Requests that are not in the cache
+	// fail with ErrCacheMiss.
+	ModeReplay
+	// ModeReadOnly serves entries from the cache as ModeDefault does, but
+	// never writes to it: responses from the network are not stored and
+	// expired entries are not deleted or refreshed. It's meant for caches that
+	// are shared as pre-built artifacts and must not be mutated.
+	ModeReadOnly
+	// ModeWriteOnly sends every request to the network, as ModeRecord does,
+	// but stores only the responses that ModeDefault would store. It's meant
+	// for jobs that prime a shared cache and must not be served stale data
+	// themselves.
+	ModeWriteOnly
+)
+
+// ErrCacheMiss is returned by Transport in ModeReplay for requests that are
+// not in the cache.
+var ErrCacheMiss = errors.New("naivehttpcache: request is not in the cache")
+
+// WithMode sets the mode of Transport, see Mode.
+func WithMode(mode Mode) Option {
+	return func(o *Options) {
+		o.Mode = mode
+	}
+}
+
+// replay serves req out of the cache, see ModeReplay.
+func (t *Transport) replay(req *http.Request, reqCC cacheControl, cacheKey string) (*http.Response, error) {
+	rangeReq := req.Header.Get("range") != ""
+
+	cachedVal, ok, err := t.lookup(req, reqCC, cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	var cachedResp *http.Response
+	var storedAt time.Time
+	if ok {
+		cachedResp, storedAt, ok, err = t.decode(req, cacheKey, cachedVal)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ok {
+		if !rangeReq || cachedResp.StatusCode != http.StatusOK {
+			return t.serve(req, cachedResp, storedAt), nil
+		}
+
+		rangeResp, ok, err := rangeResponse(req, cachedResp)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return t.serve(req, rangeResp, storedAt), nil
+		}
+		// the range can't be served, but servers are free to ignore Range
+		// and so do we. rangeResponse consumed the body.
+		cachedResp, _, err = decodeResponse(cachedVal, req)
+		if err != nil {
+			return nil, err
+		}
+		return t.serve(req, cachedResp, storedAt), nil
+	}
+
+	if t.PartialContent && rangeReq {
+		partialResp, ok, err := t.servePartial(req, reqCC, cacheKey)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return partialResp, nil
+		}
+	}
+
+	return nil, ErrCacheMiss
+}
+
+// writes reports whether Mode allows RoundTrip to write to the cache.
+func (t *Transport) writes() bool {
+	return t.Mode != ModeReplay && t.Mode != ModeReadOnly
+}
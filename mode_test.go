@@ -0,0 +1,146 @@
+package naivehttpcache_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestRecordReplay(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("cache-control", "no-store")
+		w.Write([]byte("v" + strconv.Itoa(hits)))
+	}))
+	defer ts.Close()
+
+	cache := httpcache.NewMemoryCache()
+	recorder := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache),
+			naivehttpcache.WithMode(naivehttpcache.ModeRecord),
+			naivehttpcache.WithSafeDefaults(),
+		),
+	}
+
+	// record mode always goes to the server and records everything
+	for i := 1; i <= 2; i++ {
+		if _, body := mustGet(t, recorder, ts.URL); body != "v"+strconv.Itoa(i) {
+			t.Fatalf("expected v%d; got %q", i, body)
+		}
+	}
+	mustGet(t, recorder, ts.URL+"/missing")
+
+	ts.Close()
+
+	player := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache),
+			naivehttpcache.WithMode(naivehttpcache.ModeReplay),
+		),
+	}
+
+	resp, body := mustGet(t, player, ts.URL)
+	if body != "v2" || resp.Header.Get(naivehttpcache.XFromCache) == "" {
+		t.Fatalf("expected v2 from cache; got %q", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("range", "bytes=1-")
+	if resp, body := fetch(t, player, req); resp.StatusCode != http.StatusPartialContent || body != "2" {
+		t.Fatalf("expected 206 with %q; got %d with %q", "2", resp.StatusCode, body)
+	}
+
+	if resp, _ := mustGet(t, player, ts.URL+"/missing"); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected recorded 404; got %d", resp.StatusCode)
+	}
+
+	_, err := player.Get(ts.URL + "/unknown")
+	if !errors.Is(err, naivehttpcache.ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss; got %v", err)
+	}
+	_, err = player.Post(ts.URL, "text/plain", nil)
+	if !errors.Is(err, naivehttpcache.ErrCacheMiss) {
+		t.Fatalf("expected ErrCacheMiss for POST; got %v", err)
+	}
+}
+
+func TestReadOnlyMode(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("v" + strconv.Itoa(hits)))
+	}))
+	defer ts.Close()
+
+	cache := httpcache.NewMemoryCache()
+	mustGet(t, &http.Client{Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache))}, ts.URL+"/a")
+
+	clock := newFakeClock()
+	transport := naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache),
+		naivehttpcache.WithMode(naivehttpcache.ModeReadOnly),
+		naivehttpcache.WithMaxAge(time.Hour),
+		naivehttpcache.WithClock(clock),
+	)
+	client := &http.Client{Transport: transport}
+
+	if _, body := mustGet(t, client, ts.URL+"/a"); body != "v1" {
+		t.Fatalf("expected cached v1; got %q", body)
+	}
+	for i := 2; i <= 3; i++ {
+		if _, body := mustGet(t, client, ts.URL+"/b"); body != "v"+strconv.Itoa(i) {
+			t.Fatalf("expected v%d from the server; got %q", i, body)
+		}
+	}
+
+	// expired entries are not deleted either
+	clock.Advance(2 * time.Hour)
+	mustGet(t, client, ts.URL+"/a")
+	if _, ok := cache.Get(ts.URL + "/a"); !ok {
+		t.Fatal("expected expired entry to be kept")
+	}
+}
+
+func TestWriteOnlyMode(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path == "/private" {
+			w.Header().Set("cache-control", "private")
+		}
+		w.Write([]byte("v" + strconv.Itoa(hits)))
+	}))
+	defer ts.Close()
+
+	cache := httpcache.NewMemoryCache()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache),
+			naivehttpcache.WithMode(naivehttpcache.ModeWriteOnly),
+			naivehttpcache.WithRespectNoStore(),
+		),
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, body := mustGet(t, client, ts.URL); body != "v"+strconv.Itoa(i) {
+			t.Fatalf("expected v%d from the server; got %q", i, body)
+		}
+	}
+	mustGet(t, client, ts.URL+"/private")
+
+	reader := &http.Client{Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache))}
+	if _, body := mustGet(t, reader, ts.URL); body != "v2" {
+		t.Fatalf("expected the latest response to be stored; got %q", body)
+	}
+	if _, ok := cache.Get(ts.URL + "/private"); ok {
+		t.Fatal("expected private response not to be stored")
+	}
+}
@@ -0,0 +1,105 @@
+package naivehttpcache
+
+import "context"
+
+// MultiGetter is implemented by caches that can read many keys at once, e.g.
+// in a single round trip to the backend. Operations that read many entries
+// (see Sweep) use it, otherwise keys are read one by one.
+type MultiGetter interface {
+	// GetMulti returns values stored under keys, keys that are not stored
+	// are missing from the result.
+	GetMulti(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+// GetMulti returns values stored under keys.
+func (c *MemoryCache) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.removeExpired()
+	vals := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		el, ok := c.items[key]
+		if !ok {
+			continue
+		}
+		c.lru.MoveToFront(el)
+		vals[key] = el.Value.(*memoryEntry).val
+	}
+	return vals, nil
+}
+
+// walkBatch is the number of keys walkEntries reads at once.
+const walkBatch = 64
+
+// cacheGetMulti reads keys from the cache, at once if it's MultiGetter. Error
+// is only returned by BackendFailClosed, otherwise failures are misses.
+func (t *Transport) cacheGetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	getter, ok := t.Cache.(MultiGetter)
+	if !ok || len(keys) == 0 {
+		vals := make(map[string][]byte, len(keys))
+		for _, key := range keys {
+			val, ok, err := t.cacheGet(ctx, key)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				vals[key] = val
+			}
+		}
+		return vals, nil
+	}
+
+	// failures are attributed to the first key
+	if bypass, err := t.bypassBackend("get", keys[0]); bypass {
+		return nil, err
+	}
+	ctx, cancel := t.backendContext(ctx)
+	defer cancel()
+	var vals map[string][]byte
+	err := t.bounded(ctx, func() (err error) {
+		vals, err = getter.GetMulti(ctx, keys)
+		return err
+	})
+	if err != nil {
+		return nil, t.backendError("get", keys[0], err)
+	}
+	t.backendHealthy(true)
+	return vals, nil
+}
+
+// walkEntries calls fn with keys and values of all entries of the cache until
+// it returns false. Values are read in batches, see MultiGetter. The cache
+// must implement Walker, otherwise ErrNotWalkable is returned.
+func (t *Transport) walkEntries(ctx context.Context, fn func(key string, val []byte) bool) error {
+	var batch []string
+	var err error
+	stopped := false
+	flush := func() bool {
+		var vals map[string][]byte
+		vals, err = t.cacheGetMulti(ctx, batch)
+		if err != nil {
+			return false
+		}
+		for _, key := range batch {
+			if val, ok := vals[key]; ok && !fn(key, val) {
+				stopped = true
+				return false
+			}
+		}
+		batch = batch[:0]
+		return true
+	}
+
+	walkErr := t.Walk(ctx, "", func(key string) bool {
+		batch = append(batch, key)
+		return len(batch) < walkBatch || flush()
+	})
+	if walkErr != nil {
+		return walkErr
+	}
+	if err == nil && !stopped && len(batch) > 0 {
+		flush()
+	}
+	return err
+}
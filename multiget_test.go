@@ -0,0 +1,80 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+// multiCache counts reads of MemoryCache.
+type multiCache struct {
+	*naivehttpcache.MemoryCache
+	gets, multis int
+}
+
+func (c *multiCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	c.gets++
+	return c.MemoryCache.Get(ctx, key)
+}
+
+func (c *multiCache) GetMulti(ctx context.Context, keys []string) (map[string][]byte, error) {
+	c.multis++
+	return c.MemoryCache.GetMulti(ctx, keys)
+}
+
+// walkCache hides GetMulti of the cache.
+type walkCache struct {
+	naivehttpcache.Cache
+	naivehttpcache.Walker
+}
+
+func TestGetMulti(t *testing.T) {
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	sweep := func(t *testing.T, cache naivehttpcache.Cache) {
+		t.Helper()
+		clock := newFakeClock()
+		transport := naivehttpcache.NewTransport(cache,
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithClock(clock),
+		)
+		client := &http.Client{Transport: transport}
+		for i := 0; i < 100; i++ {
+			mustGet(t, client, fmt.Sprintf("%s/%d", ts.URL, i))
+		}
+		clock.Advance(2 * time.Minute)
+
+		deleted, err := transport.Sweep(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted != 100 {
+			t.Fatalf("expected all entries to be swept; got %d", deleted)
+		}
+	}
+
+	t.Run("batched", func(t *testing.T) {
+		cache := &multiCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0)}
+		sweep(t, cache)
+		// lookups of the requests are the only single reads
+		if cache.multis != 2 || cache.gets != 100 {
+			t.Fatalf("expected entries to be read in 2 batches; got %d batches and %d reads", cache.multis, cache.gets-100)
+		}
+	})
+
+	t.Run("fallback", func(t *testing.T) {
+		memory := naivehttpcache.NewMemoryCache(0, 0)
+		sweep(t, walkCache{memory, memory})
+		if memory.Len() != 0 {
+			t.Fatalf("expected the cache to be empty; got %d entries", memory.Len())
+		}
+	})
+}
@@ -1,38 +1,480 @@
 package naivehttpcache
 
 import (
-	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
-
-	"github.com/gregjones/httpcache"
 )
 
 // XFromCache is the header added to responses that are returned from the cache.
-// Re-exported from httpcache package for convenience.
-const XFromCache = httpcache.XFromCache
+// It's the same header as in httpcache package.
+const XFromCache = "X-From-Cache"
+
+// XCachedAt is the header added to responses that are returned from the cache,
+// it holds the date of the cached response (see EntryMeta.Date), so the
+// headers that came from the server don't have to be altered to tell it.
+// ResponseInfo tells the same.
+const XCachedAt = "X-Cached-At"
 
 // Transport is an implementation of http.RoundTripper that will return values from a cache
 // where possible (avoiding a network request).
 // Transport is based on Transport from httpcache package
 // https://github.com/gregjones/httpcache/blob/901d90724c7919163f472a9812253fb26761123d/httpcache.go#L99
 type Transport struct {
+	// backendErrors counts failed cache operations, droppedWrites counts
+	// dropped writes of WriteBehind and corruptEntries counts entries that
+	// failed verification, the rest are counters of Metrics. They are the
+	// first fields to be 64-bit aligned for atomic operations.
+	backendErrors  uint64
+	droppedWrites  uint64
+	corruptEntries uint64
+	stores         uint64
+	storeErrors    uint64
+	cacheBytes     uint64
+	originBytes    uint64
+
 	// The RoundTripper interface actually used to make requests.
 	// If nil, http.DefaultTransport is used.
 	Transport http.RoundTripper
-	Cache     httpcache.Cache
+	Cache     Cache
 	// MaxAge states how long cached response can be used.
 	// Values <= 0 will be ignored.
 	MaxAge time.Duration
+	// Expires makes responses without MaxAge expire according to their
+	// Expires header instead of being cached forever.
+	Expires bool
+	// Shared makes Transport act as a shared cache (e.g. inside of a multi-user
+	// gateway): responses without MaxAge stay fresh according to their s-maxage,
+	// or max-age, directive and responses that are private to a user (marked
+	// private or answering authorized requests without explicit permission) are
+	// not stored.
+	Shared bool
+	// Partition, if set, is called with the request context and its result is
+	// mixed into the cache key, so responses are never shared between partitions
+	// (e.g. tenants or users). Empty partition means the shared key.
+	Partition func(ctx context.Context) string
+	// SkipSetCookie prevents storing responses that carry Set-Cookie header,
+	// which otherwise could leak one user's session to another.
+	SkipSetCookie bool
+	// Authorization states what to do with requests that carry Authorization
+	// header.
+	Authorization AuthorizationPolicy
+	// RespectNoStore prevents storing responses marked with no-store or
+	// private Cache-Control directives.
+	RespectNoStore bool
+	// RequestCacheControl makes Transport honor Cache-Control directives of
+	// requests: no-cache skips the lookup and refreshes the entry from the
+	// server, no-store prevents storing, max-stale and min-fresh adjust
+	// freshness check against MaxAge.
+	RequestCacheControl bool
+	// PartialContent makes Transport store 206 (Partial Content) responses as
+	// ranges, serve range requests out of them and upgrade them to a full
+	// entry once all ranges are present.
+	PartialContent bool
+	// Revalidate makes Transport keep expired entries and refresh them with
+	// conditional requests instead of deleting them up front: on 304 (Not
+	// Modified) headers of the entry are updated and stored body is served,
+	// cacheable responses replace the entry and failed refreshes keep it
+	// intact.
+	Revalidate bool
+	// StaleIfError makes Transport keep expired entries and serve them when
+	// refreshing fails with an error or 5xx response, unless they must be
+	// revalidated. Such responses carry Warning: 111 header.
+	StaleIfError bool
+	// Encoding states how Content-Encoding of responses is treated when they
+	// are stored.
+	Encoding EncodingMode
+	// AcceptEncoding states how Accept-Encoding header of requests is treated.
+	AcceptEncoding AcceptEncodingMode
+	// StreamingThreshold is the maximum number of bytes of responses without
+	// Content-Length that are buffered for caching, larger ones are treated
+	// as streams and are not stored. Zero means DefaultStreamingThreshold,
+	// negative - no limit.
+	// Event streams (text/event-stream and multipart/x-mixed-replace) are
+	// never stored.
+	StreamingThreshold int64
+	// EagerBuffering, if positive, makes Transport read up to that many bytes
+	// of response body and store it before returning the response, so it gets
+	// cached even if the caller doesn't read the body to the end. Bodies that
+	// don't fit are cached lazily, as usual.
+	EagerBuffering int64
+	// MaxBodySize, if positive, is the maximum number of bytes of bodies that
+	// are stored. Larger responses are passed through: with Content-Length
+	// they are not copied at all, without it the copy is dropped as soon as
+	// it grows past the limit.
+	MaxBodySize int64
+	// ReleaseOnCancel makes Transport drop the copies of bodies being cached
+	// as soon as contexts of their requests are done, instead of once bodies
+	// are closed. Either way, bodies that are not read to the end (or are read
+	// to the end after the context is done, as they may be truncated) are
+	// never stored.
+	ReleaseOnCancel bool
+	// BackgroundFill, if positive, makes Transport read bodies that are closed
+	// before EOF to the end in the background, so they still get cached for
+	// the next requests. Only bodies of up to BackgroundFill bytes are read
+	// this way, and only until contexts of their requests are done.
+	BackgroundFill int64
+	// ResumeFills, together with PartialContent, makes Transport store the
+	// start of responses which download was interrupted (as long as they can
+	// be requested by ranges and have validators), and request just the rest
+	// of them with Range and If-Range next time.
+	ResumeFills bool
+	// ParallelChunkSize, if positive, makes Transport request responses to
+	// be stored by ranges of that many bytes: the first one is requested as
+	// usual and, if the server supports ranges, the rest ones are fetched
+	// ParallelFetches at a time, ahead of the reader. Responses are returned
+	// to the caller as full ones.
+	ParallelChunkSize int64
+	// ParallelFetches is the number of chunks that are fetched (or wait to
+	// be read) at a time, DefaultParallelFetches if not positive.
+	ParallelFetches int
+	// Mode states how the cache and the network are used, see Mode.
+	Mode Mode
+	// BackendErrors states what happens when cache operations fail, see
+	// BackendErrorPolicy.
+	BackendErrors BackendErrorPolicy
+	// BackendTimeout, if positive, limits the duration of cache operations.
+	BackendTimeout time.Duration
+	// OnBackendError, if set, is called with every failed cache operation,
+	// regardless of BackendErrors.
+	OnBackendError func(err *CacheError)
+	// Clock tells the time. If nil, the system clock is used.
+	Clock Clock
+	// Freshness, if set, decides whether cached responses are fresh instead
+	// of MaxAge, Shared, Expires and directives of requests.
+	Freshness FreshnessPolicy
+	// RefreshInterval, if positive, protects the server from hot keys: once
+	// an expired entry is refreshed, other requests for it are served the
+	// expired entry (with Warning: 110 header) until the interval passes,
+	// unless it must be revalidated or the request is a range one.
+	RefreshInterval time.Duration
+	// Locker, if set, coalesces fetches of the same key between Transports
+	// sharing the cache: while one of them fetches the key, others wait for
+	// it to be stored (up to LockTimeout) instead of fetching it too. Range
+	// requests and modes other than ModeDefault are not coalesced.
+	Locker Locker
+	// LockTimeout is for how long locks of Locker are held and waited for.
+	// Zero means DefaultLockTimeout.
+	LockTimeout time.Duration
+	// StaleWhileLocked, if positive, makes Transport serve expired entries
+	// (with Warning: 110 header) instead of waiting for Locker, as long as
+	// they expired no more than StaleWhileLocked ago and don't have to be
+	// revalidated.
+	StaleWhileLocked time.Duration
+	// Redirects states for how long redirect responses stay fresh, see
+	// RedirectPolicy. Its lifetimes take precedence over MaxAge.
+	Redirects RedirectPolicy
+	// Observer, if set, is called with the outcome and latency of every
+	// successful round trip, in addition to collecting them into Metrics.
+	// Round trips that Transport makes itself (e.g. prefetches) are not
+	// observed.
+	Observer func(outcome Outcome, latency time.Duration)
+	// HealthCheckInterval, if positive, makes Transport bypass the cache (as
+	// if it failed, but without waiting for it) once an operation of it
+	// fails. Every interval the backend is checked again, with Ping if the
+	// cache implements Pinger or with the next operation otherwise.
+	HealthCheckInterval time.Duration
+	// OnBackendHealth, if set, is called whenever the backend becomes
+	// unhealthy or healthy again.
+	OnBackendHealth func(healthy bool)
+	// EventBuffer is the number of events buffered by the channel of Events,
+	// DefaultEventBuffer if not positive.
+	EventBuffer int
+	// StoreTransform, if set, is called with a copy of every response before
+	// it's stored, to modify its status or header (e.g. to strip Set-Cookie).
+	// The copy's header can be modified freely, its body must not be touched.
+	// It only affects the stored entry, not the response being returned.
+	StoreTransform func(resp *http.Response)
+	// ServeTransform, if set, is called with every response served from the
+	// cache (including stale and revalidated ones) before it's returned, to
+	// modify it (e.g. to inject headers). resp.Request is the request being
+	// served. The stored entry is not affected.
+	ServeTransform func(resp *http.Response)
+	// NormalizeRequest, if set, rewrites every request (e.g. lowercases its
+	// host or strips client specific headers) before it's used for anything,
+	// both for the cache key and for the request to the server. As any
+	// RoundTripper, it must not modify req, but return a modified copy (or req
+	// itself if there's nothing to change).
+	NormalizeRequest func(req *http.Request) *http.Request
+	// Immutable makes Transport trust Cache-Control: immutable of responses.
+	// While fresh, they are served even to requests asking to revalidate them
+	// (with no-cache or min-fresh, see RequestCacheControl). They still
+	// become stale at the end of their lifetime.
+	Immutable bool
+	// ImmutableForever, together with Immutable, makes immutable responses
+	// without a lifetime of their own (Surrogate-Control, s-maxage or max-age
+	// of Shared, Expires) never become stale, even if MaxAge is set.
+	ImmutableForever bool
+	// StaleGrace, if positive, bounds for how long expired entries are served
+	// stale or revalidated (by Revalidate, StaleIfError, RefreshInterval and
+	// StaleWhileLocked). Entries expired more than StaleGrace ago are treated
+	// as if they were not cached at all. Otherwise they are kept forever.
+	StaleGrace time.Duration
+	// BreakerThreshold, if positive, is the number of consecutive failures
+	// (errors or 5xx responses) of a host after which its circuit opens:
+	// requests to it are not sent for BreakerCooldown, stale entries are
+	// served to them if there are ones, otherwise they fail with
+	// ErrCircuitOpen. Then a single request is sent to probe the host, which
+	// closes the circuit if it succeeds.
+	BreakerThreshold int
+	// BreakerCooldown is for how long circuits stay open before they are
+	// probed, DefaultBreakerCooldown if not positive.
+	BreakerCooldown time.Duration
+	// OnCircuit, if set, is called whenever the circuit of a host opens or
+	// closes.
+	OnCircuit func(host string, open bool)
+	// RateLimiter, if set, limits the rate of requests to the server. Only
+	// requests that actually go to the server wait for it, hits are never
+	// limited.
+	RateLimiter RateLimiter
+	// OnLowHitRatio, if set, is called with the hit ratio (see
+	// Metrics.HitRatio) of the last HitRatioWindow cacheable requests once it
+	// drops below HitRatioThreshold (e.g. because the cache was wiped). It's
+	// called again only after the ratio recovers and drops again.
+	OnLowHitRatio     func(ratio float64)
+	HitRatioWindow    int
+	HitRatioThreshold float64
+	// MaxTTL, if positive, caps for how long responses stay fresh, whatever
+	// MaxAge, Freshness, headers of responses or directives of requests say.
+	// Responses that would never expire otherwise expire after MaxTTL too.
+	MaxTTL time.Duration
+	// MinTTL, if positive, makes responses stay fresh for at least MinTTL,
+	// even if headers of responses say they expire sooner (e.g. max-age=0).
+	// It's a naive override meant for origins that don't know better; MaxTTL
+	// still caps it, and whether responses are stored at all is not affected.
+	MinTTL time.Duration
+	// TTLHeader, if set, is the name of a header (e.g. X-Naive-Cache-TTL) in
+	// which the server tells for how many seconds a response stays fresh. It
+	// takes precedence over MaxAge and other headers of the response, but
+	// not over MinTTL and MaxTTL. The header is stored, but never returned
+	// to the caller.
+	TTLHeader string
+	// SurrogateControl makes Transport obey Surrogate-Control header of
+	// responses the way CDNs do: its max-age and no-store directives take
+	// precedence over Cache-Control, which is meant for end clients then. The
+	// header is stored, but never returned to the caller.
+	SurrogateControl bool
+	// BanLifetime, if positive, is for how long bans (see Ban) are kept. It
+	// should be at least as long as entries are kept in the cache, otherwise
+	// banned entries come back once their ban is dropped. Caches that
+	// implement Walker don't need it, see ReapBans.
+	BanLifetime time.Duration
+	// WriteBehind, if positive, makes Transport write entries to the cache
+	// in the background, through a queue of at most WriteBehind entries, so
+	// slow backends don't delay reading the end of bodies. Entries are served
+	// out of the queue until they are written. Writes that don't fit into the
+	// queue are dropped, failed ones are retried up to WriteRetries times and
+	// handled as by BackendFailOpen. See Close.
+	WriteBehind  int
+	WriteRetries int
+	// MaxConcurrentStores, if positive, is the maximum number of responses
+	// that are being stored at a time, from the response until its body is
+	// written to the cache. MaxStoreBytes, if positive, is the maximum number
+	// of bytes of bodies buffered for storing them, including ones queued by
+	// WriteBehind. Responses over the limits are passed through without being
+	// stored, see ShedStoreCount.
+	MaxConcurrentStores int
+	MaxStoreBytes       int64
+	// CorruptEntries states what happens to cached entries that are corrupt
+	// or can't be decoded, see CorruptEntryPolicy.
+	CorruptEntries CorruptEntryPolicy
+	// OnCorruptEntry, if set, is called with keys of corrupt entries and
+	// their errors, regardless of CorruptEntries. Otherwise they are logged
+	// with the standard logger.
+	OnCorruptEntry func(key string, err error)
+	// UndatedEntries states what happens to cached entries that don't tell
+	// when they were stored, see UndatedEntryPolicy.
+	UndatedEntries UndatedEntryPolicy
+	// BackendDeadlines makes cache operations return as soon as their
+	// contexts are done (by BackendTimeout or by requests they are made for),
+	// even if the cache doesn't honor contexts, so a hung backend can't hold
+	// requests past their deadlines. The operations are left to finish in
+	// the background.
+	BackendDeadlines bool
+	// StoreTimeout limits the duration of stores made once bodies of
+	// responses are read. They carry values of contexts of their requests,
+	// but not their cancellation, as requests may be done before stores are.
+	// Zero means DefaultStoreTimeout, negative - no limit.
+	StoreTimeout time.Duration
+	// ContentTypes, if set, are patterns (as of path.Match, e.g. image/* or
+	// application/*+json) of media types of responses that are stored, others
+	// (as well as responses without Content-Type) are not. SkipContentTypes
+	// are patterns of media types of responses that are never stored, they
+	// take precedence. Event streams are never stored either way.
+	ContentTypes     []string
+	SkipContentTypes []string
+	// PrefetchDepth, if positive, makes Transport fetch URLs of Link headers
+	// with rel=preload or rel=next of responses (cached or not) into the cache
+	// in the background, so that following requests hit. Links of prefetched
+	// responses are followed up to PrefetchDepth levels deep. Only links to
+	// the origin of the request are followed, with headers of the request
+	// (minus Range and conditional ones) and values of its context (e.g. for
+	// Partition), bounded by StoreTimeout. PrefetchConcurrency limits the
+	// number of prefetches at a time (non-positive means
+	// DefaultPrefetchConcurrency), links found beyond it are skipped.
+	PrefetchDepth       int
+	PrefetchConcurrency int
+	// NextPage, if set, predicts the URL of the page following resp to req of
+	// a paginated API (nil if there is none, see DefaultNextPage), which is
+	// then prefetched as by PrefetchDepth, so that it's a hit once the client
+	// asks for it. It's only called for responses of requests that are not
+	// prefetches themselves.
+	NextPage func(req *http.Request, resp *http.Response) *url.URL
+	// HotKeys, if positive, makes Transport count requests of keys and
+	// refresh the HotKeys most requested ones in the background once they
+	// are about to expire, RewarmAhead (DefaultRewarmAhead if non-positive)
+	// before they do, with the first request of them that was counted. Rounds
+	// of refreshes run every RewarmAhead/2 (see RewarmHotKeys) until Close,
+	// and counts halve every round, so that keys that are no longer requested
+	// cool down. Expiration is as by Freshness, or the rules that it replaces.
+	HotKeys     int
+	RewarmAhead time.Duration
+	// StatusTTLs, if set, holds for how long responses with specific status
+	// codes stay fresh. Its lifetimes take precedence over Redirects,
+	// TTLHeader, MaxAge and headers of responses, but not over MinTTL and
+	// MaxTTL (and Freshness replaces them). Non-positive lifetimes make
+	// responses with their status codes never stored, e.g. to keep errors
+	// from replacing cached responses.
+	StatusTTLs map[int]time.Duration
+	// ContentTTLs, if set, holds for how long 200 (OK) responses stay fresh
+	// by their media types, the first matching one wins. The lifetime is
+	// decided when a response is stored and recorded with it, so changing
+	// ContentTTLs only affects responses stored afterwards. Its lifetimes
+	// take precedence over Redirects, TTLHeader, MaxAge and headers of
+	// responses, but not over StatusTTLs, MinTTL and MaxTTL (and Freshness
+	// replaces them). Non-positive lifetimes make matching responses never
+	// stored.
+	ContentTTLs []ContentTTL
+
+	// storeLocks coordinate writes of the same key.
+	storeLocks keyLocks
+	// refreshes limits refreshes of keys to RefreshInterval.
+	refreshes refreshLimiter
+	// metrics collects Metrics.
+	metrics metrics
+	// health is the health of the cache backend.
+	health backendHealth
+	// events is the channel of Events.
+	events eventStream
+	// breaker holds circuits of hosts, see BreakerThreshold.
+	breaker circuitBreaker
+	// hitRatio tracks the hit ratio for OnLowHitRatio.
+	hitRatio hitRatioWindow
+	// bans holds bans, see Ban.
+	bans banList
+	// writeQueue is the queue of WriteBehind.
+	writeQueue writeQueue
+	// storeBudget tracks stores for MaxConcurrentStores and MaxStoreBytes.
+	storeBudget storeBudget
+	// prefetches tracks prefetches of PrefetchDepth.
+	prefetches prefetches
+	// hotKeys tracks requested keys for HotKeys.
+	hotKeys hotKeys
+	// background tracks work in the background for Close.
+	background background
 }
 
+// DefaultStreamingThreshold is the default Transport.StreamingThreshold.
+const DefaultStreamingThreshold = 32 << 20
+
+// AuthorizationPolicy states how requests with Authorization header are cached.
+type AuthorizationPolicy int
+
+const (
+	// AuthorizationIgnore caches authorized requests as any other request,
+	// ignoring the credential. This is the default.
+	AuthorizationIgnore AuthorizationPolicy = iota
+	// AuthorizationBypass sends authorized requests straight to the underlying
+	// transport, without looking into or writing to the cache.
+	AuthorizationBypass
+	// AuthorizationPartition mixes a hash of the credential into the cache key,
+	// so responses are only served to requests with the same credential.
+	AuthorizationPartition
+)
+
 type Options struct {
-	MaxAge    time.Duration
-	Transport http.RoundTripper
+	MaxAge              time.Duration
+	Expires             bool
+	Shared              bool
+	Transport           http.RoundTripper
+	Partition           func(ctx context.Context) string
+	SkipSetCookie       bool
+	Authorization       AuthorizationPolicy
+	RespectNoStore      bool
+	RequestCacheControl bool
+	PartialContent      bool
+	Revalidate          bool
+	StaleIfError        bool
+	Encoding            EncodingMode
+	AcceptEncoding      AcceptEncodingMode
+	StreamingThreshold  int64
+	EagerBuffering      int64
+	MaxBodySize         int64
+	ReleaseOnCancel     bool
+	BackgroundFill      int64
+	ResumeFills         bool
+	ParallelChunkSize   int64
+	ParallelFetches     int
+	Mode                Mode
+	BackendErrors       BackendErrorPolicy
+	BackendTimeout      time.Duration
+	OnBackendError      func(err *CacheError)
+	Clock               Clock
+	Freshness           FreshnessPolicy
+	RefreshInterval     time.Duration
+	Locker              Locker
+	LockTimeout         time.Duration
+	StaleWhileLocked    time.Duration
+	Redirects           RedirectPolicy
+	Observer            func(outcome Outcome, latency time.Duration)
+	HealthCheckInterval time.Duration
+	OnBackendHealth     func(healthy bool)
+	EventBuffer         int
+	StoreTransform      func(resp *http.Response)
+	ServeTransform      func(resp *http.Response)
+	NormalizeRequest    func(req *http.Request) *http.Request
+	Immutable           bool
+	ImmutableForever    bool
+	StaleGrace          time.Duration
+	BreakerThreshold    int
+	BreakerCooldown     time.Duration
+	OnCircuit           func(host string, open bool)
+	RateLimiter         RateLimiter
+	OnLowHitRatio       func(ratio float64)
+	HitRatioWindow      int
+	HitRatioThreshold   float64
+	MaxTTL              time.Duration
+	MinTTL              time.Duration
+	TTLHeader           string
+	SurrogateControl    bool
+	BanLifetime         time.Duration
+	WriteBehind         int
+	WriteRetries        int
+	MaxConcurrentStores int
+	MaxStoreBytes       int64
+	CorruptEntries      CorruptEntryPolicy
+	OnCorruptEntry      func(key string, err error)
+	UndatedEntries      UndatedEntryPolicy
+	BackendDeadlines    bool
+	StoreTimeout        time.Duration
+	ContentTypes        []string
+	SkipContentTypes    []string
+	OriginMiddleware    []Middleware
+	PrefetchDepth       int
+	PrefetchConcurrency int
+	NextPage            func(req *http.Request, resp *http.Response) *url.URL
+	HotKeys             int
+	RewarmAhead         time.Duration
+	StatusTTLs          map[int]time.Duration
+	ContentTTLs         []ContentTTL
 }
 
 type Option func(*Options)
@@ -43,22 +485,267 @@ func WithMaxAge(maxAge time.Duration) Option {
 	}
 }
 
+// WithMaxTTL caps for how long responses stay fresh, see Transport.MaxTTL.
+func WithMaxTTL(maxTTL time.Duration) Option {
+	return func(o *Options) {
+		o.MaxTTL = maxTTL
+	}
+}
+
+// WithMinTTL makes responses stay fresh for at least minTTL, see
+// Transport.MinTTL.
+func WithMinTTL(minTTL time.Duration) Option {
+	return func(o *Options) {
+		o.MinTTL = minTTL
+	}
+}
+
+// WithExpires makes Transport use Expires header of responses for freshness
+// when MaxAge is not set.
+func WithExpires() Option {
+	return func(o *Options) {
+		o.Expires = true
+	}
+}
+
+// WithSharedCache makes Transport act as a shared cache, see Transport.Shared.
+func WithSharedCache() Option {
+	return func(o *Options) {
+		o.Shared = true
+	}
+}
+
 func WithTransport(transport http.RoundTripper) Option {
 	return func(o *Options) {
 		o.Transport = transport
 	}
 }
 
-func NewTransport(cache httpcache.Cache, opts ...Option) *Transport {
+// WithPartition makes cache keys depend on the partition derived from request
+// context by fn, e.g. tenant or user ID.
+func WithPartition(fn func(ctx context.Context) string) Option {
+	return func(o *Options) {
+		o.Partition = fn
+	}
+}
+
+// WithSkipSetCookie makes Transport refuse to store responses with Set-Cookie.
+func WithSkipSetCookie() Option {
+	return func(o *Options) {
+		o.SkipSetCookie = true
+	}
+}
+
+// WithAuthorizationPolicy sets policy for requests with Authorization header.
+func WithAuthorizationPolicy(policy AuthorizationPolicy) Option {
+	return func(o *Options) {
+		o.Authorization = policy
+	}
+}
+
+// WithRespectNoStore makes Transport refuse to store responses with
+// Cache-Control: no-store or private. It's a minimal safety valve, the rest of
+// Cache-Control is still ignored.
+func WithRespectNoStore() Option {
+	return func(o *Options) {
+		o.RespectNoStore = true
+	}
+}
+
+// WithRequestCacheControl makes Transport honor no-cache, no-store, max-stale
+// and min-fresh Cache-Control directives of requests.
+func WithRequestCacheControl() Option {
+	return func(o *Options) {
+		o.RequestCacheControl = true
+	}
+}
+
+// WithPartialContent enables caching of partial content, see
+// Transport.PartialContent.
+func WithPartialContent() Option {
+	return func(o *Options) {
+		o.PartialContent = true
+	}
+}
+
+// WithRevalidate makes Transport revalidate expired entries instead of
+// deleting them, see Transport.Revalidate.
+func WithRevalidate() Option {
+	return func(o *Options) {
+		o.Revalidate = true
+	}
+}
+
+// WithEncoding sets how Content-Encoding of responses is treated when they are
+// stored.
+func WithEncoding(mode EncodingMode) Option {
+	return func(o *Options) {
+		o.Encoding = mode
+	}
+}
+
+// WithAcceptEncoding sets how Accept-Encoding header of requests is treated.
+func WithAcceptEncoding(mode AcceptEncodingMode) Option {
+	return func(o *Options) {
+		o.AcceptEncoding = mode
+	}
+}
+
+// WithStreamingThreshold sets the maximum number of buffered bytes of responses
+// without Content-Length, see Transport.StreamingThreshold.
+func WithStreamingThreshold(n int64) Option {
+	return func(o *Options) {
+		o.StreamingThreshold = n
+	}
+}
+
+// WithEagerBuffering makes Transport store responses with bodies of up to limit
+// bytes before returning them, see Transport.EagerBuffering.
+func WithEagerBuffering(limit int64) Option {
+	return func(o *Options) {
+		o.EagerBuffering = limit
+	}
+}
+
+// WithMaxBodySize makes Transport not store responses with bodies larger than
+// size bytes, see Transport.MaxBodySize.
+func WithMaxBodySize(size int64) Option {
+	return func(o *Options) {
+		o.MaxBodySize = size
+	}
+}
+
+// WithReleaseOnCancel makes Transport drop copies of bodies being cached once
+// their requests are canceled, see Transport.ReleaseOnCancel.
+func WithReleaseOnCancel() Option {
+	return func(o *Options) {
+		o.ReleaseOnCancel = true
+	}
+}
+
+// WithBackgroundFill makes Transport finish reading abandoned bodies of up to
+// limit bytes in the background to cache them, see Transport.BackgroundFill.
+func WithBackgroundFill(limit int64) Option {
+	return func(o *Options) {
+		o.BackgroundFill = limit
+	}
+}
+
+// WithStaleIfError makes Transport serve stale entries when refreshing them
+// fails, see Transport.StaleIfError.
+func WithStaleIfError() Option {
+	return func(o *Options) {
+		o.StaleIfError = true
+	}
+}
+
+// WithStaleGrace makes Transport drop entries that expired more than grace ago
+// instead of serving them stale or revalidating them, see
+// Transport.StaleGrace.
+func WithStaleGrace(grace time.Duration) Option {
+	return func(o *Options) {
+		o.StaleGrace = grace
+	}
+}
+
+// WithSafeDefaults enables options that prevent storing responses which are
+// likely to be private to a user. This is the recommended profile for
+// transports shared between users.
+func WithSafeDefaults() Option {
+	return func(o *Options) {
+		WithSkipSetCookie()(o)
+		WithAuthorizationPolicy(AuthorizationPartition)(o)
+		WithRespectNoStore()(o)
+		WithRequestCacheControl()(o)
+	}
+}
+
+func NewTransport(cache Cache, opts ...Option) *Transport {
 	args := &Options{}
 	for _, o := range opts {
 		o(args)
 	}
 
+	transport := args.Transport
+	if len(args.OriginMiddleware) > 0 {
+		transport = Chain(transport, args.OriginMiddleware...)
+	}
+
 	return &Transport{
-		Transport: args.Transport,
-		Cache:     cache,
-		MaxAge:    args.MaxAge,
+		Transport:           transport,
+		Cache:               cache,
+		MaxAge:              args.MaxAge,
+		Expires:             args.Expires,
+		Shared:              args.Shared,
+		Partition:           args.Partition,
+		SkipSetCookie:       args.SkipSetCookie,
+		Authorization:       args.Authorization,
+		RespectNoStore:      args.RespectNoStore,
+		RequestCacheControl: args.RequestCacheControl,
+		PartialContent:      args.PartialContent,
+		Revalidate:          args.Revalidate,
+		StaleIfError:        args.StaleIfError,
+		Encoding:            args.Encoding,
+		AcceptEncoding:      args.AcceptEncoding,
+		StreamingThreshold:  args.StreamingThreshold,
+		EagerBuffering:      args.EagerBuffering,
+		MaxBodySize:         args.MaxBodySize,
+		ReleaseOnCancel:     args.ReleaseOnCancel,
+		BackgroundFill:      args.BackgroundFill,
+		ResumeFills:         args.ResumeFills,
+		ParallelChunkSize:   args.ParallelChunkSize,
+		ParallelFetches:     args.ParallelFetches,
+		Mode:                args.Mode,
+		BackendErrors:       args.BackendErrors,
+		BackendTimeout:      args.BackendTimeout,
+		OnBackendError:      args.OnBackendError,
+		Clock:               args.Clock,
+		Freshness:           args.Freshness,
+		RefreshInterval:     args.RefreshInterval,
+		Locker:              args.Locker,
+		LockTimeout:         args.LockTimeout,
+		StaleWhileLocked:    args.StaleWhileLocked,
+		Redirects:           args.Redirects,
+		Observer:            args.Observer,
+		HealthCheckInterval: args.HealthCheckInterval,
+		OnBackendHealth:     args.OnBackendHealth,
+		EventBuffer:         args.EventBuffer,
+		StoreTransform:      args.StoreTransform,
+		ServeTransform:      args.ServeTransform,
+		NormalizeRequest:    args.NormalizeRequest,
+		Immutable:           args.Immutable,
+		ImmutableForever:    args.ImmutableForever,
+		StaleGrace:          args.StaleGrace,
+		BreakerThreshold:    args.BreakerThreshold,
+		BreakerCooldown:     args.BreakerCooldown,
+		OnCircuit:           args.OnCircuit,
+		RateLimiter:         args.RateLimiter,
+		OnLowHitRatio:       args.OnLowHitRatio,
+		HitRatioWindow:      args.HitRatioWindow,
+		HitRatioThreshold:   args.HitRatioThreshold,
+		MaxTTL:              args.MaxTTL,
+		MinTTL:              args.MinTTL,
+		TTLHeader:           args.TTLHeader,
+		SurrogateControl:    args.SurrogateControl,
+		BanLifetime:         args.BanLifetime,
+		WriteBehind:         args.WriteBehind,
+		WriteRetries:        args.WriteRetries,
+		MaxConcurrentStores: args.MaxConcurrentStores,
+		MaxStoreBytes:       args.MaxStoreBytes,
+		CorruptEntries:      args.CorruptEntries,
+		OnCorruptEntry:      args.OnCorruptEntry,
+		UndatedEntries:      args.UndatedEntries,
+		BackendDeadlines:    args.BackendDeadlines,
+		StoreTimeout:        args.StoreTimeout,
+		ContentTypes:        args.ContentTypes,
+		SkipContentTypes:    args.SkipContentTypes,
+		PrefetchDepth:       args.PrefetchDepth,
+		PrefetchConcurrency: args.PrefetchConcurrency,
+		NextPage:            args.NextPage,
+		HotKeys:             args.HotKeys,
+		RewarmAhead:         args.RewarmAhead,
+		StatusTTLs:          args.StatusTTLs,
+		ContentTTLs:         args.ContentTTLs,
 	}
 }
 
@@ -66,93 +753,1175 @@ func NewTransport(cache httpcache.Cache, opts ...Option) *Transport {
 //
 // If there is a fresh Response already in cache, then it will be returned without connecting to
 // the server.
-// RoundTrip gives 0 fucks about Cache-Control and other stuff,
-// it just blindly caches all GET requests that responsed with http.StatusOK (code 200).
+// Only GET requests are cached. By default responses are stored regardless of
+// Cache-Control and stay fresh forever (or for MaxAge); headers of responses
+// are only obeyed when enabled: Expires, Shared (s-maxage and max-age),
+// SurrogateControl, TTLHeader and RespectNoStore. RequestCacheControl does
+// the same for directives of requests. StatusTTLs, ContentTTLs, MinTTL and
+// MaxTTL adjust lifetimes on top of that, and Freshness replaces them all.
+//
+// Range requests are served out of cached full response if there's one,
+// otherwise they go to the server and only full responses are cached (unless
+// PartialContent is enabled).
 //
 // It's based on RoundTrip implementation from httpcache package
 // https://github.com/gregjones/httpcache/blob/901d90724c7919163f472a9812253fb26761123d/httpcache.go#L139
 // but heavilly differs from it.
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
-	transport := t.Transport
-	if transport == nil {
-		transport = http.DefaultTransport
+	start := time.Now()
+	outcome := OutcomeMiss
+	req = t.normalize(req)
+	resp, err := t.roundTrip(req, &outcome)
+	background := inBackground(req.Context())
+	if !background {
+		t.observe(outcome, start, err)
+	}
+	t.stripHeaders(resp)
+	if err != nil {
+		return resp, err
+	}
+	if !background {
+		t.countBody(resp, outcome)
+	}
+	if req.Method == http.MethodGet {
+		if t.PrefetchDepth > 0 {
+			t.prefetchLinks(req, resp)
+		}
+		if t.NextPage != nil {
+			t.prefetchNextPage(req, resp)
+		}
 	}
 
-	if req.Method != http.MethodGet {
-		return transport.RoundTrip(req)
+	var key string
+	if outcome != OutcomeBypass {
+		key = t.cacheKey(t.withAcceptEncoding(req))
+		if t.subscribed() && !background {
+			typ := EventHit
+			if outcome == OutcomeMiss {
+				typ = EventMiss
+			}
+			t.emit(typ, key, outcome)
+		}
+		if t.HotKeys > 0 {
+			t.trackHotKey(req, key)
+		}
 	}
+	return t.withInfo(req, resp, key, outcome), nil
+}
 
-	// cacheKey is the same as in httpcache package
-	// https://github.com/gregjones/httpcache/blob/901d90724c7919163f472a9812253fb26761123d/httpcache.go#L42
-	cacheKey := req.URL.String()
+// roundTrip is RoundTrip that tells how it served req in outcome.
+func (t *Transport) roundTrip(req *http.Request, outcome *Outcome) (*http.Response, error) {
+	transport := t.transport()
+
+	// upgraded connections are read and written by the caller, they must
+	// reach it as they are
+	if req.Method != http.MethodGet || t.Authorization == AuthorizationBypass && req.Header.Get("authorization") != "" || upgrade(req) {
+		if t.Mode == ModeReplay {
+			return nil, ErrCacheMiss
+		}
+		*outcome = OutcomeBypass
+		if !t.allowOrigin(req.URL.Host) {
+			return nil, ErrCircuitOpen
+		}
+		if err := t.waitOrigin(req); err != nil {
+			t.abandonOrigin(req.URL.Host)
+			return nil, err
+		}
+		resp, err := transport.RoundTrip(req)
+		t.originResult(req, resp, err)
+		return resp, err
+	}
+
+	req = t.withAcceptEncoding(req)
+	cacheKey := t.cacheKey(req)
+
+	var reqCC cacheControl
+	if t.RequestCacheControl {
+		reqCC = parseCacheControl(req.Header)
+	}
 
-	if cachedVal, ok := t.Cache.Get(cacheKey); ok {
-		cachedResp, err := http.ReadResponse(bufio.NewReader(bytes.NewBuffer(cachedVal)), req)
+	if t.Mode == ModeReplay {
+		*outcome = OutcomeHit
+		return t.replay(req, reqCC, cacheKey)
+	}
+
+	// staleResp is kept for revalidation and as a fallback, staleAt is when
+	// it was stored
+	var staleResp *http.Response
+	var staleAt time.Time
+
+	cachedVal, ok, err := t.lookup(req, reqCC, cacheKey)
+	if err != nil {
+		return nil, err
+	}
+	var cachedResp *http.Response
+	var storedAt time.Time
+	if ok {
+		cachedResp, storedAt, ok, err = t.decode(req, cacheKey, cachedVal)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ok {
+		meta := t.meta(cachedResp.StatusCode, cachedResp.Header, storedAt)
+		fresh, err := t.fresh(req, reqCC, meta)
 		if err != nil {
-			return cachedResp, err
+			return nil, err
+		}
+		if !fresh {
+			switch {
+			case t.pastGrace(meta):
+				if t.writes() {
+					if err := t.cacheDelete(req.Context(), cacheKey); err != nil {
+						return nil, err
+					}
+					t.emit(EventEvict, cacheKey, 0)
+				}
+			case t.throttled(req, cacheKey, cachedResp.Header):
+				*outcome = OutcomeStale
+				return t.serveStale(req, cachedResp, storedAt, `110 - "Response is Stale"`), nil
+			case !t.keepsStale():
+				if t.writes() {
+					if err := t.cacheDelete(req.Context(), cacheKey); err != nil {
+						return nil, err
+					}
+					t.emit(EventEvict, cacheKey, 0)
+				}
+			case req.Header.Get("range") == "":
+				staleResp, staleAt = cachedResp, storedAt
+			}
+			cachedResp = nil
 		}
 
-		if t.MaxAge > 0 {
-			date, err := httpcache.Date(cachedResp.Header)
+		// ranges of redirects and such are served as is
+		if cachedResp != nil && req.Header.Get("range") != "" && cachedResp.StatusCode == http.StatusOK {
+			var ok bool
+			cachedResp, ok, err = rangeResponse(req, cachedResp)
 			if err != nil {
 				return nil, err
 			}
-
-			if date.Add(t.MaxAge).Before(time.Now()) {
-				t.Cache.Delete(cacheKey)
+			if !ok {
 				cachedResp = nil
 			}
 		}
 
 		if cachedResp != nil {
-			cachedResp.Header.Set(XFromCache, "1")
-			return cachedResp, err
+			*outcome = OutcomeHit
+			return t.serve(req, cachedResp, storedAt), err
+		}
+	}
+
+	if t.PartialContent && req.Header.Get("range") != "" {
+		partialResp, ok, err := t.servePartial(req, reqCC, cacheKey)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			*outcome = OutcomeHit
+			return partialResp, nil
+		}
+	}
+
+	// release releases the lock of Locker, unless the body of the response
+	// takes care of it
+	var release func()
+	if t.Locker != nil && t.Mode == ModeDefault && req.Header.Get("range") == "" {
+		lockRelease, cachedResp, err := t.lockFetch(req, reqCC, cacheKey, staleResp, staleAt, outcome)
+		if err != nil {
+			return nil, err
+		}
+		if cachedResp != nil {
+			return cachedResp, nil
+		}
+		release = lockRelease
+		defer func() {
+			if release != nil {
+				release()
+			}
+		}()
+	}
+
+	outreq := req
+	revalidating := false
+	if staleResp != nil && t.Revalidate {
+		outreq = revalidationRequest(req, staleResp.Header)
+		revalidating = outreq != req
+	}
+
+	// verbatim storage needs encoded bytes, which are not available if
+	// http.Transport decompresses them transparently
+	decode := false
+	if t.Encoding == EncodingVerbatim && wantsTransparentDecoding(req) {
+		if outreq == req {
+			outreq = req.Clone(req.Context())
+		}
+		outreq.Header.Set("accept-encoding", "gzip")
+		decode = true
+	}
+
+	// prefix is the stored start of the response, only the rest of which is
+	// requested
+	fillreq := outreq
+	var prefix []byte
+	if t.ResumeFills && t.PartialContent && staleResp == nil && req.Header.Get("range") == "" && t.writes() {
+		outreq, prefix, err = t.resumeRequest(outreq, reqCC, cacheKey)
+		if err != nil {
+			return nil, err
 		}
 	}
+	parallel := false
+	if t.ParallelChunkSize > 0 && prefix == nil && staleResp == nil && req.Header.Get("range") == "" && t.writes() {
+		outreq = chunkRequest(outreq, 0, t.ParallelChunkSize-1, "")
+		parallel = true
+	}
 
-	resp, err := transport.RoundTrip(req)
+	if !t.allowOrigin(req.URL.Host) {
+		if staleResp != nil && !t.mustRevalidate(staleResp.Header) {
+			*outcome = OutcomeStale
+			return t.serveStale(req, staleResp, staleAt, `111 - "Revalidation Failed"`), nil
+		}
+		return nil, ErrCircuitOpen
+	}
+	if err := t.waitOrigin(outreq); err != nil {
+		t.abandonOrigin(req.URL.Host)
+		return nil, err
+	}
+	resp, err := transport.RoundTrip(outreq)
+	t.originResult(outreq, resp, err)
+	if err == nil && (prefix != nil || parallel) {
+		var ok bool
+		if prefix != nil {
+			resp, ok = resumed(resp, prefix)
+		} else {
+			resp, ok = t.parallelFill(transport, fillreq, resp)
+		}
+		if !ok {
+			// the server didn't respond with the range as asked, the
+			// response is requested as a whole
+			resp, err = transport.RoundTrip(fillreq)
+			t.originResult(fillreq, resp, err)
+		}
+	}
 	if err != nil {
+		if t.staleIfError(staleResp) {
+			*outcome = OutcomeStale
+			return t.serveStale(req, staleResp, staleAt, `111 - "Revalidation Failed"`), nil
+		}
 		return resp, err
 	}
 
+	if resp.StatusCode >= http.StatusInternalServerError && t.staleIfError(staleResp) {
+		resp.Body.Close()
+		*outcome = OutcomeStale
+		return t.serveStale(req, staleResp, staleAt, `111 - "Revalidation Failed"`), nil
+	}
+
+	if resp.StatusCode == http.StatusNotModified && revalidating {
+		resp.Body.Close()
+		staleResp, staleAt, err = t.refresh(req.Context(), cacheKey, staleResp, resp)
+		if err != nil {
+			return nil, err
+		}
+		*outcome = OutcomeRevalidated
+		return t.serve(req, staleResp, staleAt), nil
+	}
+
+	if !t.writes() || !t.storable(req, reqCC, resp) {
+		if decode {
+			decodeTransparently(resp)
+		}
+		return resp, err
+	}
+
+	// responses over the limits of stores in flight are passed through as
+	// if they were not storable
+	ticket, ok := t.admitStore()
+	if !ok {
+		if decode {
+			decodeTransparently(resp)
+		}
+		return resp, err
+	}
+
+	// resp may be changed before it's returned to the caller, and by the
+	// caller while the body is still being read (or filled in the
+	// background), cache stores it as it came from the server
+	stored := *resp
+	stored.Header = resp.Header.Clone()
+	ctx := req.Context()
+	onEOF := func(r io.Reader) error {
+		ctx, cancel := t.storeContext(withStoreTicket(ctx, ticket))
+		defer cancel()
+		return t.store(ctx, cacheKey, &stored, r)
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		onEOF = func(r io.Reader) error {
+			ctx, cancel := t.storeContext(withStoreTicket(ctx, ticket))
+			defer cancel()
+			return t.storePartial(ctx, cacheKey, &stored, r)
+		}
+	}
+
+	if t.EagerBuffering > 0 && resp.ContentLength <= t.EagerBuffering {
+		buffered, err := t.bufferEagerly(resp, ticket, onEOF)
+		if err != nil {
+			ticket.release()
+			return nil, err
+		}
+		if buffered {
+			ticket.release()
+			if decode {
+				decodeTransparently(resp)
+			}
+			return resp, nil
+		}
+	}
+
+	var limit int64
+	if resp.ContentLength < 0 {
+		limit = t.streamingThreshold()
+	}
+	if t.MaxBodySize > 0 && (limit <= 0 || t.MaxBodySize < limit) {
+		limit = t.MaxBodySize
+	}
+
+	unlock := release
+	if unlock != nil {
+		release = nil
+		store := onEOF
+		onEOF = func(r io.Reader) error {
+			defer unlock()
+			return store(r)
+		}
+	}
+
 	// Delay caching until EOF is reached.
-	// This is stolen without any modifications from
+	// This is based on
 	// https://github.com/gregjones/httpcache/blob/901d90724c7919163f472a9812253fb26761123d/httpcache.go#L233
-	resp.Body = &cachingReadCloser{
-		R: resp.Body,
-		OnEOF: func(r io.Reader) {
-			resp := *resp
-
-			// this is naive http cache, so it should be fine to do that.
-			// why do we set date manually? because not all responses have it.
-			// why do we need care? because of MaxAge
-			if resp.Header.Get("date") == "" {
-				resp.Header.Set("date", time.Now().Format(time.RFC1123))
+	// but modified: the copy is limited, reserved against store limits, may
+	// be filled in the background and is pooled, see cachingReadCloser.
+	body := &cachingReadCloser{
+		R:        resp.Body,
+		OnEOF:    onEOF,
+		Limit:    limit,
+		SizeHint: resp.ContentLength,
+		Context:  ctx,
+		Fill:     t.BackgroundFill,
+		Go:       t.goBackground,
+	}
+	if ticket != nil {
+		body.Reserve = ticket.reserve
+		body.OnRelease = ticket.release
+	}
+	if t.resumable(resp) {
+		body.OnAbandon = func(r *bytes.Reader) error {
+			ctx, cancel := t.storeContext(withStoreTicket(ctx, ticket))
+			defer cancel()
+			return t.storePrefix(ctx, cacheKey, &stored, r)
+		}
+	}
+	if t.ReleaseOnCancel {
+		body.watch()
+	}
+	resp.Body = body
+	if unlock != nil {
+		resp.Body = &releasingReadCloser{ReadCloser: resp.Body, release: unlock}
+	}
+	if decode {
+		decodeTransparently(resp)
+	}
+
+	return resp, err
+}
+
+// transport returns the RoundTripper that sends requests to the server.
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport == nil {
+		return http.DefaultTransport
+	}
+	return t.Transport
+}
+
+// CloseIdleConnections closes idle connections of the underlying Transport,
+// if it supports that. http.Client.CloseIdleConnections relies on it.
+func (t *Transport) CloseIdleConnections() {
+	type closeIdler interface {
+		CloseIdleConnections()
+	}
+	if c, ok := t.transport().(closeIdler); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// serve prepares cached response to req, which was stored at storedAt, for
+// returning it to the caller. Cached responses are decoded for every hit, so
+// the caller owns it: its header is never shared and its body is a reader of
+// its own over the cached value, which is never written to.
+func (t *Transport) serve(req *http.Request, cachedResp *http.Response, storedAt time.Time) *http.Response {
+	if t.Encoding == EncodingVerbatim && wantsTransparentDecoding(req) {
+		decodeTransparently(cachedResp)
+	}
+	cachedResp.Header.Set(XFromCache, "1")
+	if !storedAt.IsZero() {
+		cachedResp.Header.Set(XCachedAt, storedAt.UTC().Format(http.TimeFormat))
+	}
+	cachedResp.Request = t.withStoredAt(req, cachedResp, storedAt)
+	delStoredHeaders(cachedResp.Header)
+	if t.ServeTransform != nil {
+		t.ServeTransform(cachedResp)
+	}
+	return cachedResp
+}
+
+// delStoredHeaders removes headers that are stored with entries, but never
+// served (see purgedHeader and contentTTLHeader), from header.
+func delStoredHeaders(header http.Header) {
+	header.Del(purgedHeader)
+	header.Del(contentTTLHeader)
+}
+
+// stripHeaders removes headers meant for the cache only (TTLHeader and
+// Surrogate-Control) from resp. The header is copied first, because the stored
+// response may share it.
+func (t *Transport) stripHeaders(resp *http.Response) {
+	if resp == nil {
+		return
+	}
+	var names []string
+	if t.TTLHeader != "" {
+		names = append(names, t.TTLHeader)
+	}
+	if t.SurrogateControl {
+		names = append(names, "surrogate-control")
+	}
+	copied := false
+	for _, name := range names {
+		if resp.Header.Get(name) == "" {
+			continue
+		}
+		if !copied {
+			resp.Header = resp.Header.Clone()
+			copied = true
+		}
+		resp.Header.Del(name)
+	}
+}
+
+// staleIfError reports whether staleResp may be served instead of a failed
+// response.
+func (t *Transport) staleIfError(staleResp *http.Response) bool {
+	return t.StaleIfError && staleResp != nil && !t.mustRevalidate(staleResp.Header)
+}
+
+// serveStale is serve for stale responses, warning is the value of Warning
+// header that tells why it's stale.
+func (t *Transport) serveStale(req *http.Request, staleResp *http.Response, storedAt time.Time, warning string) *http.Response {
+	staleResp.Header.Add("warning", warning)
+	return t.serve(req, staleResp, storedAt)
+}
+
+// throttled reports whether expired entry with header must be served to req
+// instead of refreshing it, see RefreshInterval.
+func (t *Transport) throttled(req *http.Request, cacheKey string, header http.Header) bool {
+	if t.RefreshInterval <= 0 || req.Header.Get("range") != "" || t.mustRevalidate(header) {
+		return false
+	}
+	return !t.refreshes.allow(cacheKey, t.now(), t.RefreshInterval)
+}
+
+// refresh updates cached response with header of 304 (Not Modified) response
+// notModified, as per RFC 7234 section 4.3.4, stores it (unless Mode forbids
+// writes) and returns it, along with the time it was refreshed at.
+func (t *Transport) refresh(ctx context.Context, cacheKey string, cachedResp, notModified *http.Response) (*http.Response, time.Time, error) {
+	body, err := readBody(cachedResp.Body)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	for k, vv := range notModified.Header {
+		switch k {
+		// these describe the (empty) payload of 304, not the stored one
+		case "Content-Length", "Content-Encoding", "Content-Range", "Transfer-Encoding":
+			continue
+		}
+		cachedResp.Header[k] = vv
+	}
+	cachedResp.Header.Del(purgedHeader)
+
+	// refreshed response is as fresh as a new one
+	refreshedAt := t.dated(notModified.Header)
+	if t.writes() {
+		if err := t.storeAt(ctx, cacheKey, cachedResp, bytes.NewReader(body), refreshedAt); err != nil {
+			return nil, time.Time{}, err
+		}
+	}
+
+	cachedResp.Body = newCachedBody(body)
+	return cachedResp, refreshedAt, nil
+}
+
+// revalidationRequest returns conditional request for req validating the
+// cached response with header. req is returned as is if there are no
+// validators or if it carries its own conditions.
+func revalidationRequest(req *http.Request, header http.Header) *http.Request {
+	if req.Header.Get("if-none-match") != "" || req.Header.Get("if-modified-since") != "" {
+		return req
+	}
+
+	etag := header.Get("etag")
+	lastModified := header.Get("last-modified")
+	if etag == "" && lastModified == "" {
+		return req
+	}
+
+	outreq := req.Clone(req.Context())
+	if etag != "" {
+		outreq.Header.Set("if-none-match", etag)
+	}
+	if lastModified != "" {
+		outreq.Header.Set("if-modified-since", lastModified)
+	}
+	return outreq
+}
+
+// dated returns Date of response with header, or the current time if it
+// doesn't have one. Freshness of stored responses is counted from it.
+func (t *Transport) dated(header http.Header) time.Time {
+	if date, err := responseDate(header); err == nil {
+		return date
+	}
+	return t.now()
+}
+
+// meta returns EntryMeta of cached response with status and header, which was
+// stored at storedAt.
+func (t *Transport) meta(status int, header http.Header, storedAt time.Time) EntryMeta {
+	return EntryMeta{StatusCode: status, Header: header, Date: storedAt, Now: t.now()}
+}
+
+// lifetime returns for how long cached response described by meta stays
+// fresh since its date, at least MinTTL and up to MaxTTL. False means that it
+// never expires.
+func (t *Transport) lifetime(meta EntryMeta) (time.Duration, bool) {
+	lifetime, ok := t.uncappedLifetime(meta)
+	if ok && lifetime < t.MinTTL {
+		lifetime = t.MinTTL
+	}
+	if t.MaxTTL > 0 && (!ok || lifetime > t.MaxTTL) {
+		return t.MaxTTL, true
+	}
+	return lifetime, ok
+}
+
+// uncappedLifetime is lifetime regardless of MinTTL and MaxTTL.
+func (t *Transport) uncappedLifetime(meta EntryMeta) (time.Duration, bool) {
+	header := meta.Header
+	if lifetime, ok := t.statusTTL(meta.StatusCode); ok {
+		return lifetime, true
+	}
+	if lifetime, ok := recordedTTL(header); ok {
+		return lifetime, true
+	}
+	if lifetime, expires, ok := t.Redirects.lifetime(meta.StatusCode); ok {
+		return lifetime, expires
+	}
+
+	if lifetime, ok := t.headerTTL(header); ok {
+		return lifetime, true
+	}
+
+	lifetime, ok := t.responseLifetime(meta)
+	if !ok && t.ImmutableForever && t.immutable(header) {
+		return 0, false
+	}
+
+	if t.MaxAge > 0 {
+		return t.MaxAge, true
+	}
+
+	return lifetime, ok
+}
+
+// responseLifetime is lifetime that response described by meta states on its
+// own, by the headers that t obeys.
+func (t *Transport) responseLifetime(meta EntryMeta) (time.Duration, bool) {
+	header := meta.Header
+	if sc, ok := t.surrogateControl(header); ok {
+		if maxAge, ok := sc.seconds("max-age"); ok {
+			return maxAge, true
+		}
+	} else if t.Shared {
+		cc := parseCacheControl(header)
+		if sMaxAge, ok := cc.seconds("s-maxage"); ok {
+			return sMaxAge, true
+		}
+		if maxAge, ok := cc.seconds("max-age"); ok {
+			return maxAge, true
+		}
+	}
+
+	if t.Expires {
+		if v := header.Get("expires"); v != "" {
+			expires, err := http.ParseTime(v)
+			if err != nil {
+				// invalid Expires, especially "0", represents a time in the past
+				return 0, true
+			}
+			// Expires is relative to the clock of the server
+			date, err := responseDate(header)
+			if err != nil {
+				date = meta.Date
+			}
+			return expires.Sub(date), true
+		}
+	}
+
+	return 0, false
+}
+
+// fresh reports whether cached response described by meta is fresh enough for
+// req. reqCC holds directives of the request, if they are honored.
+func (t *Transport) fresh(req *http.Request, reqCC cacheControl, meta EntryMeta) (bool, error) {
+	if ahead, ok := rewarming(req); ok {
+		meta.Now = meta.Now.Add(ahead)
+	}
+	header := meta.Header
+	if _, ok := purgedAt(header); ok {
+		return false, nil
+	}
+	if t.Freshness != nil {
+		if meta.Date.IsZero() {
+			return false, t.undated()
+		}
+		if t.MaxTTL > 0 && meta.Age() > t.MaxTTL {
+			return false, nil
+		}
+		if meta.Age() < t.MinTTL {
+			return true, nil
+		}
+		return t.Freshness.Freshness(req, meta) == Fresh, nil
+	}
+
+	lifetime, ok := t.lifetime(meta)
+	if !ok {
+		return true, nil
+	}
+	if meta.Date.IsZero() {
+		return false, t.undated()
+	}
+
+	now := meta.Now
+
+	if minFresh, ok := reqCC.seconds("min-fresh"); ok && !t.immutable(header) {
+		now = now.Add(minFresh)
+	}
+	if maxStale, ok := reqCC["max-stale"]; ok && !t.mustRevalidate(header) {
+		// max-stale without a value means that any staleness is acceptable
+		if maxStale == "" {
+			if t.MaxTTL <= 0 {
+				return true, nil
 			}
+			lifetime = t.MaxTTL
+		}
+		if maxStale, ok := reqCC.seconds("max-stale"); ok {
+			lifetime += maxStale
+		}
+		if t.MaxTTL > 0 && lifetime > t.MaxTTL {
+			lifetime = t.MaxTTL
+		}
+	}
+
+	return !meta.Date.Add(lifetime).Before(now), nil
+}
 
-			resp.Body = ioutil.NopCloser(r)
-			respBytes, err := httputil.DumpResponse(&resp, true)
-			if err == nil {
-				t.Cache.Set(cacheKey, respBytes)
+// mustRevalidate reports whether response with header must never be served
+// stale.
+func (t *Transport) mustRevalidate(header http.Header) bool {
+	cc := parseCacheControl(header)
+	return cc.has("must-revalidate") || t.Shared && cc.has("proxy-revalidate")
+}
+
+// ttl returns for how long cached response described by meta is useful for
+// the cache, zero means that it's not known or that it may be served (or
+// revalidated) long after it expires.
+func (t *Transport) ttl(meta EntryMeta) time.Duration {
+	if t.Mode == ModeRecord || t.Freshness != nil || t.keepsStale() && t.StaleGrace <= 0 || t.RequestCacheControl {
+		return 0
+	}
+	lifetime, ok := t.lifetime(meta)
+	if !ok || meta.Date.IsZero() {
+		return 0
+	}
+	if t.keepsStale() {
+		lifetime += t.StaleGrace
+	}
+	ttl := meta.Date.Add(lifetime).Sub(meta.Now)
+	if ttl <= 0 {
+		// already expired, it's only good to answer the request it came with
+		ttl = time.Second
+	}
+	return ttl
+}
+
+// keepsStale reports whether expired entries are kept in the cache, because
+// options of t may use them.
+func (t *Transport) keepsStale() bool {
+	return t.Revalidate || t.StaleIfError || t.RefreshInterval > 0 || t.StaleWhileLocked > 0
+}
+
+// pastGrace reports whether cached response described by meta expired more
+// than StaleGrace ago, so it can't be used anymore.
+func (t *Transport) pastGrace(meta EntryMeta) bool {
+	if t.StaleGrace <= 0 {
+		return false
+	}
+	staleness, err := t.staleness(meta)
+	return err == nil && staleness > t.StaleGrace
+}
+
+// staleness returns for how long cached response described by meta is
+// expired, negative if it's fresh. Once Freshness decides, the age is all
+// there is to tell. Soft purged responses are expired since the purge, unless
+// they expired before it. Undated responses are expired forever, unless
+// UndatedEntries says otherwise.
+func (t *Transport) staleness(meta EntryMeta) (time.Duration, error) {
+	if meta.Date.IsZero() {
+		return undatedStaleness, t.undated()
+	}
+	age := meta.Age()
+	if t.Freshness != nil {
+		return age, nil
+	}
+	staleness := time.Duration(-1)
+	if lifetime, ok := t.lifetime(meta); ok {
+		staleness = age - lifetime
+	}
+	if at, ok := purgedAt(meta.Header); ok && !at.IsZero() && meta.Now.Sub(at) > staleness {
+		staleness = meta.Now.Sub(at)
+	}
+	return staleness, nil
+}
+
+// lookup returns cached value for cacheKey, unless request directives or Mode
+// ask to bypass the cache, or it's banned (see Ban).
+func (t *Transport) lookup(req *http.Request, reqCC cacheControl, cacheKey string) ([]byte, bool, error) {
+	switch t.Mode {
+	case ModeRecord, ModeWriteOnly:
+		return nil, false, nil
+	case ModeReplay:
+		val, ok, err := t.cacheGet(req.Context(), cacheKey)
+		if err != nil || !ok {
+			return nil, false, err
+		}
+		ok, err = t.intact(req.Context(), cacheKey, val)
+		return val, ok, err
+	}
+	if t.RequestCacheControl {
+		// Pragma: no-cache is only considered in absence of Cache-Control, as
+		// RFC 7234 suggests.
+		if reqCC.has("no-cache") || (len(reqCC) == 0 && req.Header.Get("pragma") == "no-cache") {
+			if !t.Immutable {
+				return nil, false, nil
 			}
-		},
+			val, ok, err := t.lookupImmutable(req, cacheKey)
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			return t.usable(req.Context(), cacheKey, val)
+		}
+	}
+	val, ok, err := t.cacheGet(req.Context(), cacheKey)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	return t.usable(req.Context(), cacheKey, val)
+}
+
+// usable returns entry val stored under key, unless it's corrupt or banned.
+func (t *Transport) usable(ctx context.Context, key string, val []byte) ([]byte, bool, error) {
+	ok, err := t.intact(ctx, key, val)
+	if err != nil || !ok {
+		return nil, false, err
 	}
+	ok, err = t.unbanned(ctx, key, val)
+	return val, ok, err
+}
 
-	return resp, err
+// storable reports whether resp to req may be written to the cache.
+// reqCC holds directives of the request, if they are honored.
+func (t *Transport) storable(req *http.Request, reqCC cacheControl, resp *http.Response) bool {
+	if t.Encoding == EncodingDecoded && !decodable(resp.Header) {
+		return false
+	}
+
+	if streaming(resp.Header) || !t.storableContentType(resp.Header) {
+		return false
+	}
+
+	if t.MaxBodySize > 0 && resp.ContentLength > t.MaxBodySize {
+		return false
+	}
+
+	if ttl, ok := t.statusTTL(resp.StatusCode); ok && ttl <= 0 && t.Mode != ModeRecord {
+		return false
+	}
+	if ttl, ok := t.contentTTL(resp.StatusCode, resp.Header); ok && ttl <= 0 && t.Mode != ModeRecord {
+		return false
+	}
+	if resp.StatusCode == http.StatusPartialContent {
+		// partial responses must never be stored as full ones, but they can be
+		// assembled into one
+		if !t.PartialContent {
+			return false
+		}
+		_, _, size, ok := parseContentRange(resp.Header.Get("content-range"))
+		if !ok || t.MaxBodySize > 0 && size > t.MaxBodySize {
+			return false
+		}
+		// ranges of encoded content can't be decoded
+		if t.Encoding == EncodingDecoded && contentEncoding(resp.Header) != "" {
+			return false
+		}
+	}
+	if t.Mode == ModeRecord {
+		return true
+	}
+	if reqCC.has("no-store") {
+		return false
+	}
+	if t.SkipSetCookie && len(resp.Header.Values("set-cookie")) > 0 {
+		return false
+	}
+
+	sc, surrogate := t.surrogateControl(resp.Header)
+	if surrogate && (sc.has("no-store") || sc.has("no-store-remote")) {
+		return false
+	}
+
+	if t.RespectNoStore || t.Shared {
+		cc := parseCacheControl(resp.Header)
+		// Cache-Control is for end clients when there's Surrogate-Control
+		if !surrogate && t.RespectNoStore && cc.has("no-store") {
+			return false
+		}
+		if !surrogate && cc.has("private") {
+			return false
+		}
+		// shared cache must not store responses to authorized requests unless
+		// explicitly allowed to, see RFC 7234 section 3.2. Partitioned keys are
+		// never shared between credentials, so that's fine.
+		if t.Shared && t.Authorization == AuthorizationIgnore && req.Header.Get("authorization") != "" &&
+			!cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// bufferEagerly reads body of resp up to EagerBuffering bytes (or MaxBodySize,
+// if it's less) and, if it ends within the limit, passes it to onEOF (unless
+// it doesn't fit into ticket) and replaces it with a replayable one. Otherwise
+// body is kept readable from the start and false is returned. Error is the one
+// of onEOF.
+func (t *Transport) bufferEagerly(resp *http.Response, ticket *storeTicket, onEOF func(io.Reader) error) (bool, error) {
+	limit := t.EagerBuffering
+	if t.MaxBodySize > 0 && t.MaxBodySize < limit {
+		limit = t.MaxBodySize
+	}
+	body := resp.Body
+	buf, err := ioutil.ReadAll(io.LimitReader(body, limit+1))
+	switch {
+	case err != nil:
+		// the caller still deserves what was read, followed by the error
+		resp.Body = &readCloser{
+			Reader: io.MultiReader(bytes.NewReader(buf), &errReader{err}),
+			Closer: body,
+		}
+		return true, nil
+	case int64(len(buf)) > limit:
+		resp.Body = &readCloser{
+			Reader: io.MultiReader(bytes.NewReader(buf), body),
+			Closer: body,
+		}
+		return false, nil
+	}
+
+	body.Close()
+	if ticket.reserve(int64(len(buf))) {
+		if err := onEOF(bytes.NewReader(buf)); err != nil {
+			return false, err
+		}
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	return true, nil
+}
+
+// streamingThreshold returns effective StreamingThreshold.
+func (t *Transport) streamingThreshold() int64 {
+	if t.StreamingThreshold == 0 {
+		return DefaultStreamingThreshold
+	}
+	return t.StreamingThreshold
+}
+
+// streaming reports whether response with header is a stream that never
+// ends (or at least is not meant to be replayed).
+func streaming(header http.Header) bool {
+	switch mediaType(header) {
+	case "text/event-stream", "multipart/x-mixed-replace":
+		return true
+	}
+	return false
+}
+
+// upgrade reports whether req asks to switch protocols, e.g. to WebSocket.
+func upgrade(req *http.Request) bool {
+	if req.Header.Get("upgrade") == "" {
+		return false
+	}
+	for _, line := range req.Header.Values("connection") {
+		for _, token := range strings.Split(line, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// store writes resp with body to the cache under cacheKey.
+// If cacheKey is being stored already, e.g. by another response that was
+// fetched concurrently, store does nothing: the other one is just as fresh.
+// Only errors of the cache are returned, responses that can't be stored are
+// skipped silently.
+func (t *Transport) store(ctx context.Context, cacheKey string, resp *http.Response, body io.Reader) error {
+	return t.storeAt(ctx, cacheKey, resp, body, t.dated(resp.Header))
+}
+
+// storeAt is store of response that was stored (or refreshed) at storedAt,
+// which freshness of it is counted from.
+func (t *Transport) storeAt(ctx context.Context, cacheKey string, resp *http.Response, body io.Reader, storedAt time.Time) error {
+	unlock, ok := t.storeLocks.tryLock(cacheKey)
+	if !ok {
+		return nil
+	}
+	defer unlock()
+
+	r := *resp
+	r.Header = resp.Header.Clone()
+
+	if t.Encoding == EncodingDecoded {
+		if enc := contentEncoding(r.Header); enc != "" {
+			decoded, err := decoder(body, enc)
+			if err != nil {
+				return nil
+			}
+			decodedBytes, err := ioutil.ReadAll(decoded)
+			if err != nil {
+				return nil
+			}
+			body = bytes.NewReader(decodedBytes)
+			r.Header.Del("content-encoding")
+			r.Header.Del("content-length")
+		}
+	}
+
+	if t.StoreTransform != nil {
+		t.StoreTransform(&r)
+	}
+	t.recordContentTTL(r.StatusCode, r.Header)
+
+	e, err := newEntry(&r, body)
+	if err != nil || !e.complete() {
+		return nil
+	}
+	e.StoredAt, e.CachedAt = storedAt, t.now()
+	val, ttl := e.encode(), t.ttl(t.meta(r.StatusCode, r.Header, storedAt))
+	if t.WriteBehind > 0 && t.enqueueWrite(ctx, cacheKey, val, ttl) {
+		return nil
+	}
+	if err := t.cacheSet(ctx, cacheKey, val, ttl); err != nil {
+		return err
+	}
+	return t.stored(ctx, cacheKey)
+}
+
+// stored finishes storing the entry under cacheKey once it's written to the
+// cache: partial entries of it are no longer needed.
+func (t *Transport) stored(ctx context.Context, cacheKey string) error {
+	t.emit(EventStore, cacheKey, 0)
+	if t.PartialContent {
+		return t.cacheDelete(ctx, partialKey(cacheKey))
+	}
+	return nil
+}
+
+// Purge deletes the entry of GET request to rawurl with ctx (which may be
+// needed for the partition). Entries of requests that are keyed by their
+// headers too can be purged with PurgeRequest.
+func (t *Transport) Purge(ctx context.Context, rawurl string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return err
+	}
+	return t.PurgeRequest(req)
+}
+
+// PurgeRequest deletes the entry of req.
+func (t *Transport) PurgeRequest(req *http.Request) error {
+	cacheKey := t.CacheKey(req)
+	if err := t.cacheDelete(req.Context(), cacheKey); err != nil {
+		return err
+	}
+	t.emit(EventInvalidate, cacheKey, 0)
+	if t.PartialContent {
+		if err := t.cacheDelete(req.Context(), partialKey(cacheKey)); err != nil {
+			return err
+		}
+		t.emit(EventInvalidate, partialKey(cacheKey), 0)
+	}
+	return nil
+}
+
+// PurgeFunc deletes entries for which match returns true and returns the
+// number of deleted entries. Values that can't be decoded are not matched.
+// The cache must implement Walker, otherwise ErrNotWalkable is returned.
+func (t *Transport) PurgeFunc(ctx context.Context, match func(key string, meta EntryMeta) bool) (int, error) {
+	deleted := 0
+	var err error
+	walkErr := t.walkEntries(ctx, func(key string, val []byte) bool {
+		meta, decodeErr := t.entryMeta(key, val)
+		if decodeErr != nil || !match(key, meta) {
+			return true
+		}
+		if err = t.cacheDelete(ctx, key); err != nil {
+			return false
+		}
+		t.emit(EventInvalidate, key, 0)
+		deleted++
+		return true
+	})
+	if err == nil {
+		err = walkErr
+	}
+	return deleted, err
+}
+
+// cacheKey returns the key under which response to req is stored.
+// Request URL (or the key set by ContextWithCacheKey) is always the last space
+// separated part of the key, everything before it narrows the key down (e.g.
+// to a partition).
+func (t *Transport) cacheKey(req *http.Request) string {
+	// base key is the same as in httpcache package
+	// https://github.com/gregjones/httpcache/blob/901d90724c7919163f472a9812253fb26761123d/httpcache.go#L42
+	// except for internationalized hosts, which are keyed by their ASCII form
+	key := asciiURL(req.URL).String()
+	if override, ok := req.Context().Value(cacheKeyContextKey{}).(string); ok {
+		key = override
+	}
+
+	if t.Partition != nil {
+		if partition := t.Partition(req.Context()); partition != "" {
+			key = "partition=" + url.QueryEscape(partition) + " " + key
+		}
+	}
+
+	if t.AcceptEncoding == AcceptEncodingNormalize {
+		if acceptEncoding := req.Header.Get("accept-encoding"); acceptEncoding != "" {
+			key = "accept-encoding=" + url.QueryEscape(acceptEncoding) + " " + key
+		}
+	}
+
+	if t.Authorization == AuthorizationPartition {
+		if credential := req.Header.Get("authorization"); credential != "" {
+			sum := sha256.Sum256([]byte(credential))
+			key = "authorization=" + hex.EncodeToString(sum[:]) + " " + key
+		}
+	}
+
+	return key
+}
+
+// readCloser combines Reader with Closer of other ReadCloser.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// errReader always fails with err.
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// maxPooledBufferSize is the maximum capacity of buffers that are returned to
+// bufferPool, larger ones are left for GC.
+const maxPooledBufferSize = 4 << 20
+
+// bufferPool holds buffers of cachingReadCloser.
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
 }
 
 // cachingReadCloser is a wrapper around ReadCloser R that calls OnEOF
 // handler with a full copy of the content read from R when EOF is
 // reached.
-// cachingReadCloser and all its methods are stolen without any
-// modifications from https://github.com/gregjones/httpcache/blob/901d90724c7919163f472a9812253fb26761123d/httpcache.go#L520
+// cachingReadCloser and all its methods are stolen from
+// https://github.com/gregjones/httpcache/blob/901d90724c7919163f472a9812253fb26761123d/httpcache.go#L520
+// with Limit, SizeHint, Context, Fill, OnAbandon, Reserve, OnRelease, Go and
+// buffer pooling being added.
 type cachingReadCloser struct {
 	// Underlying ReadCloser.
 	R io.ReadCloser
 	// OnEOF is called with a copy of the content of R when EOF is reached.
-	OnEOF func(io.Reader)
-	// buf stores a copy of the content of R.
-	buf bytes.Buffer
+	// The copy is only valid until OnEOF returns. Its error is returned by
+	// Read instead of io.EOF.
+	OnEOF func(io.Reader) error
+	// Limit, if positive, is the maximum number of bytes to copy. Once it's
+	// exceeded, the copy is dropped and OnEOF is never called.
+	Limit int64
+	// SizeHint, if not negative, is the expected size of the content, used to
+	// allocate the copy up front. Content of another size is never passed to
+	// OnEOF.
+	SizeHint int64
+	// Context, if set, is the context of the request. Once it's done, EOF may
+	// mean that the content is truncated, so it's not passed to OnEOF.
+	Context context.Context
+	// Fill, if positive, makes Close read the rest of R in the background,
+	// as long as the content is not larger than Fill bytes, so it still can
+	// be passed to OnEOF.
+	Fill int64
+	// OnAbandon, if set, is called with the copy of the content read so far,
+	// if R is closed or fails before EOF. The copy is only valid until
+	// OnAbandon returns.
+	OnAbandon func(*bytes.Reader) error
+	// Reserve, if set, is called with the number of bytes about to be added
+	// to the copy, false drops the copy and OnEOF is never called.
+	Reserve func(n int64) bool
+	// OnRelease, if set, is called once the copy is dropped, whether it was
+	// passed to OnEOF or not.
+	OnRelease func()
+	// Go, if set, runs fills of Fill instead of goroutines of their own.
+	// False means that it didn't, and the copy is dropped.
+	Go func(fn func()) bool
+
+	// mu guards the copy, which watch may drop concurrently with Read.
+	mu sync.Mutex
+	// buf stores a copy of the content of R, it's taken from bufferPool on
+	// first read.
+	buf *bytes.Buffer
+	// done is set once the copy is passed to OnEOF or dropped.
+	done bool
+	// stop stops watch, if it's running.
+	stop chan struct{}
+	// filling is set once Close leaves R to fill.
+	filling bool
 }
 
 // Read reads the next len(p) bytes from R or until R is drained. The
@@ -161,13 +1930,142 @@ type cachingReadCloser struct {
 // has been read so far.
 func (r *cachingReadCloser) Read(p []byte) (n int, err error) {
 	n, err = r.R.Read(p)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.done {
+		return n, err
+	}
+	if r.buf == nil {
+		r.buf = bufferPool.Get().(*bytes.Buffer)
+		if r.SizeHint > 0 && r.SizeHint <= maxPooledBufferSize {
+			// one more byte is needed to not grow when reading EOF
+			r.buf.Grow(int(r.SizeHint) + 1)
+		}
+	}
+	if r.Limit > 0 && int64(r.buf.Len()+n) > r.Limit || r.Reserve != nil && !r.Reserve(int64(n)) {
+		r.release()
+		return n, err
+	}
 	r.buf.Write(p[:n])
-	if err == io.EOF {
-		r.OnEOF(bytes.NewReader(r.buf.Bytes()))
+	switch {
+	case err == io.EOF:
+		if r.complete() {
+			if eofErr := r.OnEOF(bytes.NewReader(r.buf.Bytes())); eofErr != nil {
+				err = eofErr
+			}
+		}
+		r.release()
+	case err != nil:
+		// whatever comes after an error can't be trusted
+		r.abandon()
 	}
 	return n, err
 }
 
+// complete reports whether the copy is the whole content, once EOF is read.
+func (r *cachingReadCloser) complete() bool {
+	if r.SizeHint >= 0 && int64(r.buf.Len()) != r.SizeHint {
+		return false
+	}
+	return r.Context == nil || r.Context.Err() == nil
+}
+
 func (r *cachingReadCloser) Close() error {
+	r.mu.Lock()
+	if r.filling {
+		r.mu.Unlock()
+		return nil
+	}
+	r.filling = !r.done && r.Fill > 0 && r.SizeHint <= r.Fill && (r.Context == nil || r.Context.Err() == nil)
+	if !r.filling {
+		r.abandon()
+	}
+	filling := r.filling
+	r.mu.Unlock()
+
+	switch {
+	case !filling:
+	case r.Go == nil:
+		go r.fill()
+		return nil
+	case r.Go(r.fill):
+		return nil
+	default:
+		r.mu.Lock()
+		r.abandon()
+		r.mu.Unlock()
+	}
 	return r.R.Close()
 }
+
+// fill reads the rest of R, so the copy can be passed to OnEOF, and closes R.
+func (r *cachingReadCloser) fill() {
+	defer r.R.Close()
+
+	r.mu.Lock()
+	if r.Limit <= 0 || r.Fill < r.Limit {
+		r.Limit = r.Fill
+	}
+	r.mu.Unlock()
+
+	p := make([]byte, 32<<10)
+	for {
+		_, err := r.Read(p)
+		r.mu.Lock()
+		done := r.done
+		r.mu.Unlock()
+		if err != nil || done {
+			return
+		}
+	}
+}
+
+// watch drops the copy as soon as Context is done.
+func (r *cachingReadCloser) watch() {
+	if r.Context == nil || r.Context.Done() == nil {
+		return
+	}
+	r.stop = make(chan struct{})
+	stop := r.stop
+	go func() {
+		select {
+		case <-r.Context.Done():
+			r.mu.Lock()
+			r.abandon()
+			r.mu.Unlock()
+		case <-stop:
+		}
+	}()
+}
+
+// abandon passes the copy to OnAbandon, unless it's done already, and drops it.
+// It must be called with mu held.
+func (r *cachingReadCloser) abandon() {
+	if !r.done && r.buf != nil && r.OnAbandon != nil {
+		// errors of the cache are reported by Transport
+		_ = r.OnAbandon(bytes.NewReader(r.buf.Bytes()))
+	}
+	r.release()
+}
+
+// release drops the copy and returns its buffer to the pool. It must be
+// called with mu held.
+func (r *cachingReadCloser) release() {
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+	r.done = true
+	if r.OnRelease != nil {
+		r.OnRelease()
+		r.OnRelease = nil
+	}
+	if r.buf == nil {
+		return
+	}
+	if r.buf.Cap() <= maxPooledBufferSize {
+		r.buf.Reset()
+		bufferPool.Put(r.buf)
+	}
+	r.buf = nil
+}
@@ -1,9 +1,18 @@
 package naivehttpcache_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -18,11 +27,13 @@ func TestMaxAge(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	maxAge := time.Second
+	maxAge := time.Minute
+	clock := newFakeClock()
 	httpClient := &http.Client{
 		Transport: naivehttpcache.NewTransport(
-			httpcache.NewMemoryCache(),
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
 			naivehttpcache.WithMaxAge(maxAge),
+			naivehttpcache.WithClock(clock),
 		),
 	}
 
@@ -44,8 +55,8 @@ func TestMaxAge(t *testing.T) {
 	check("")
 	// second request should hit it
 	check("1")
-	// after sleep cached response should qulify as expired
-	time.Sleep(maxAge)
+	// once maxAge passes cached response should qulify as expired
+	clock.Advance(maxAge + time.Second)
 	// third request should be a miss
 	check("")
 
@@ -54,6 +65,75 @@ func TestMaxAge(t *testing.T) {
 	}
 }
 
+func TestMaxTTL(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("cache-control", "max-age=604800")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithSharedCache(),
+			naivehttpcache.WithRequestCacheControl(),
+			naivehttpcache.WithMaxTTL(time.Minute),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	mustGet(t, httpClient, ts.URL)
+	clock.Advance(30 * time.Second)
+	mustGet(t, httpClient, ts.URL)
+	if hits != 1 {
+		t.Fatalf("expected response to be fresh within MaxTTL; got %d hits", hits)
+	}
+
+	clock.Advance(time.Minute)
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("cache-control", "max-stale")
+	fetch(t, httpClient, req)
+	if hits != 2 {
+		t.Fatalf("expected MaxTTL to cap the lifetime of the response; got %d hits", hits)
+	}
+}
+
+func TestMinTTL(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("cache-control", "max-age=0")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithSharedCache(),
+			naivehttpcache.WithMinTTL(time.Hour),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	mustGet(t, httpClient, ts.URL)
+	clock.Advance(30 * time.Minute)
+	mustGet(t, httpClient, ts.URL)
+	if hits != 1 {
+		t.Fatalf("expected response to be fresh within MinTTL; got %d hits", hits)
+	}
+
+	clock.Advance(time.Hour)
+	mustGet(t, httpClient, ts.URL)
+	if hits != 2 {
+		t.Fatalf("expected response to expire after MinTTL; got %d hits", hits)
+	}
+}
+
 func TestTransport(t *testing.T) {
 	var proto string
 	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -65,7 +145,7 @@ func TestTransport(t *testing.T) {
 
 	httpClient := ts.Client()
 	httpClient.Transport = naivehttpcache.NewTransport(
-		httpcache.NewMemoryCache(),
+		naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
 		naivehttpcache.WithTransport(httpClient.Transport),
 	)
 	httpClient.Get(ts.URL)
@@ -74,3 +154,1072 @@ func TestTransport(t *testing.T) {
 		t.Fatalf("expected http 2 proto; got %s", proto)
 	}
 }
+
+type tenantKey struct{}
+
+func TestPartition(t *testing.T) {
+	tsHits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsHits++
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithPartition(func(ctx context.Context) string {
+				tenant, _ := ctx.Value(tenantKey{}).(string)
+				return tenant
+			}),
+		),
+	}
+
+	check := func(tenant string, expected string) {
+		ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if _, err := ioutil.ReadAll(resp.Body); err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get(naivehttpcache.XFromCache); got != expected {
+			t.Fatalf("tenant %q: expected %q; got %q\n", tenant, expected, got)
+		}
+	}
+
+	check("a", "")
+	check("a", "1")
+	// other tenant must not see tenant a's response
+	check("b", "")
+	check("b", "1")
+
+	if tsHits != 2 {
+		t.Fatalf("expected 2 server hits; got %d", tsHits)
+	}
+}
+
+// fetch does req with httpClient, reads the whole body and returns the
+// response along with the body.
+func fetch(t *testing.T, httpClient *http.Client, req *http.Request) (*http.Response, string) {
+	t.Helper()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body)
+}
+
+// mustGet is fetch for plain GET request to url.
+func mustGet(t *testing.T, httpClient *http.Client, url string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fetch(t, httpClient, req)
+}
+
+func TestSkipSetCookie(t *testing.T) {
+	tsHits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsHits++
+		if r.URL.Path == "/cookie" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		}
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithSafeDefaults(),
+		),
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp, _ := mustGet(t, httpClient, ts.URL+"/cookie"); resp.Header.Get(naivehttpcache.XFromCache) != "" {
+			t.Fatal("response with set-cookie must not be served from cache")
+		}
+	}
+	mustGet(t, httpClient, ts.URL+"/plain")
+	if resp, _ := mustGet(t, httpClient, ts.URL+"/plain"); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected response without set-cookie to be cached")
+	}
+
+	if tsHits != 3 {
+		t.Fatalf("expected 3 server hits; got %d", tsHits)
+	}
+}
+
+func TestStorableStatus(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/missing":
+			http.NotFound(w, r)
+		case "/partial":
+			w.Header().Set("content-range", "bytes 0-1/4")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("he"))
+		}
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{Transport: naivehttpcache.NewTransport(
+		naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithMaxAge(time.Minute),
+	)}
+
+	for i := 0; i < 2; i++ {
+		mustGet(t, httpClient, ts.URL+"/missing")
+		mustGet(t, httpClient, ts.URL+"/partial")
+	}
+	// responses of any status are cached, except partial ones
+	if hits["/missing"] != 1 {
+		t.Fatalf("expected 404 to be cached; got %d server hits", hits["/missing"])
+	}
+	if hits["/partial"] != 2 {
+		t.Fatalf("expected 206 not to be cached; got %d server hits", hits["/partial"])
+	}
+}
+
+func TestAuthorizationPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   naivehttpcache.AuthorizationPolicy
+		expected []string
+	}{
+		{"ignore", naivehttpcache.AuthorizationIgnore, []string{"", "1", "1"}},
+		{"bypass", naivehttpcache.AuthorizationBypass, []string{"", "", ""}},
+		{"partition", naivehttpcache.AuthorizationPartition, []string{"", "1", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			defer ts.Close()
+
+			httpClient := &http.Client{
+				Transport: naivehttpcache.NewTransport(
+					naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+					naivehttpcache.WithAuthorizationPolicy(tt.policy),
+				),
+			}
+
+			for i, credential := range []string{"Bearer alice", "Bearer alice", "Bearer bob"} {
+				req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+				req.Header.Set("Authorization", credential)
+				resp, _ := fetch(t, httpClient, req)
+				if got := resp.Header.Get(naivehttpcache.XFromCache); got != tt.expected[i] {
+					t.Fatalf("request %d: expected %q; got %q", i, tt.expected[i], got)
+				}
+			}
+		})
+	}
+}
+
+func TestRespectNoStore(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithRespectNoStore(),
+		),
+	}
+
+	tests := []struct {
+		cacheControl string
+		cached       bool
+	}{
+		{"no-store", false},
+		{"private, max-age=60", false},
+		{"max-age=60", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		u := ts.URL + "/?cc=" + url.QueryEscape(tt.cacheControl)
+		mustGet(t, httpClient, u)
+		resp, _ := mustGet(t, httpClient, u)
+		if cached := resp.Header.Get(naivehttpcache.XFromCache) == "1"; cached != tt.cached {
+			t.Fatalf("cache-control %q: expected cached %t; got %t", tt.cacheControl, tt.cached, cached)
+		}
+	}
+}
+
+func TestRequestCacheControl(t *testing.T) {
+	tsHits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsHits++
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithRequestCacheControl(),
+		),
+	}
+
+	check := func(path, cacheControl, expected string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if cacheControl != "" {
+			req.Header.Set("Cache-Control", cacheControl)
+		}
+		resp, _ := fetch(t, httpClient, req)
+		if got := resp.Header.Get(naivehttpcache.XFromCache); got != expected {
+			t.Fatalf("%s with %q: expected %q; got %q", path, cacheControl, expected, got)
+		}
+	}
+
+	// no-store responses are not stored
+	check("/a", "no-store", "")
+	check("/a", "", "")
+	check("/a", "", "1")
+	// no-cache skips the lookup, but refreshes the entry
+	check("/a", "no-cache", "")
+	check("/a", "", "1")
+
+	if tsHits != 3 {
+		t.Fatalf("expected 3 server hits; got %d", tsHits)
+	}
+}
+
+func TestRequestFreshnessDirectives(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stale" {
+			w.Header().Set("Date", time.Now().Add(-2*time.Hour).UTC().Format(http.TimeFormat))
+		}
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithMaxAge(time.Hour),
+			naivehttpcache.WithRequestCacheControl(),
+		),
+	}
+
+	check := func(path, cacheControl, expected string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.Header.Set("Cache-Control", cacheControl)
+		resp, _ := fetch(t, httpClient, req)
+		if got := resp.Header.Get(naivehttpcache.XFromCache); got != expected {
+			t.Fatalf("%s with %q: expected %q; got %q", path, cacheControl, expected, got)
+		}
+	}
+
+	check("/fresh", "", "")
+	// entry is fresh, but not for another 2 hours
+	check("/fresh", "min-fresh=7200", "")
+	check("/fresh", "", "1")
+
+	// entry is stale by an hour, which is tolerated
+	check("/stale", "", "")
+	check("/stale", "max-stale=7200", "1")
+	check("/stale", "max-stale", "1")
+	// but this is too much
+	check("/stale", "max-stale=60", "")
+}
+
+func TestExpires(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/future":
+			w.Header().Set("Expires", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		case "/past":
+			w.Header().Set("Expires", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+		case "/invalid":
+			w.Header().Set("Expires", "0")
+		}
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithExpires(),
+		),
+	}
+
+	tests := []struct {
+		path   string
+		cached bool
+	}{
+		{"/future", true},
+		{"/past", false},
+		{"/invalid", false},
+		// no Expires means forever
+		{"/none", true},
+	}
+	for _, tt := range tests {
+		mustGet(t, httpClient, ts.URL+tt.path)
+		resp, _ := mustGet(t, httpClient, ts.URL+tt.path)
+		if cached := resp.Header.Get(naivehttpcache.XFromCache) == "1"; cached != tt.cached {
+			t.Fatalf("%s: expected cached %t; got %t", tt.path, tt.cached, cached)
+		}
+	}
+}
+
+func TestSharedCache(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", r.URL.Query().Get("cc"))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithSharedCache(),
+		),
+	}
+
+	tests := []struct {
+		cacheControl  string
+		authorization string
+		cached        bool
+	}{
+		{"max-age=3600", "", true},
+		// s-maxage wins over max-age
+		{"s-maxage=0, max-age=3600", "", false},
+		{"s-maxage=3600, max-age=0", "", true},
+		{"private, max-age=3600", "", false},
+		{"max-age=3600", "Bearer alice", false},
+		{"public, max-age=3600", "Bearer alice", true},
+	}
+	for _, tt := range tests {
+		u := ts.URL + "/?cc=" + url.QueryEscape(tt.cacheControl) + "&auth=" + url.QueryEscape(tt.authorization)
+		var resp *http.Response
+		for i := 0; i < 2; i++ {
+			req, _ := http.NewRequest(http.MethodGet, u, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			resp, _ = fetch(t, httpClient, req)
+		}
+		if cached := resp.Header.Get(naivehttpcache.XFromCache) == "1"; cached != tt.cached {
+			t.Fatalf("%q (authorization %q): expected cached %t; got %t", tt.cacheControl, tt.authorization, tt.cached, cached)
+		}
+	}
+}
+
+func TestMustRevalidate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(-2*time.Hour).UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "must-revalidate")
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithMaxAge(time.Hour),
+			naivehttpcache.WithRequestCacheControl(),
+		),
+	}
+
+	mustGet(t, httpClient, ts.URL)
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Cache-Control", "max-stale")
+	if resp, _ := fetch(t, httpClient, req); resp.Header.Get(naivehttpcache.XFromCache) != "" {
+		t.Fatal("stale must-revalidate response must not be served")
+	}
+}
+
+// roundTripFunc is an adapter to allow the use of ordinary functions as
+// http.RoundTripper.
+// fakeClock is naivehttpcache.Clock that only moves with Advance.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+// undated returns h with responses that are not dated, so they're dated by
+// the fake clock of Transport.
+func undated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header()["Date"] = nil
+		h(w, r)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRevalidate(t *testing.T) {
+	var conditions []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditions = append(conditions, r.Header.Get("If-None-Match"))
+		w.Header().Set("Date", time.Now().Add(-2*time.Hour).UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	failing := false
+	cache := httpcache.NewMemoryCache()
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(cache),
+			naivehttpcache.WithMaxAge(time.Hour),
+			naivehttpcache.WithRevalidate(),
+			naivehttpcache.WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				if failing {
+					return nil, errors.New("origin is down")
+				}
+				return http.DefaultTransport.RoundTrip(req)
+			})),
+		),
+	}
+
+	mustGet(t, httpClient, ts.URL)
+	resp, body := mustGet(t, httpClient, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != "hello" {
+		t.Fatalf("expected cached body after 304; got %q", body)
+	}
+	if len(conditions) != 2 || conditions[1] != `"v1"` {
+		t.Fatalf("expected second request to be conditional; got %q", conditions)
+	}
+
+	failing = true
+	if _, err := httpClient.Get(ts.URL); err == nil {
+		t.Fatal("expected error from failing origin")
+	}
+	if _, ok := cache.Get(ts.URL); !ok {
+		t.Fatal("expected entry to survive failed refresh")
+	}
+}
+
+func TestRevalidateMergesHeaders(t *testing.T) {
+	tsHits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsHits++
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("X-Hit", strconv.Itoa(tsHits))
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		// first response is stale on arrival
+		w.Header().Set("Date", time.Now().Add(-2*time.Hour).UTC().Format(http.TimeFormat))
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithMaxAge(time.Hour),
+			naivehttpcache.WithRevalidate(),
+		),
+	}
+
+	mustGet(t, httpClient, ts.URL)
+	// revalidated
+	mustGet(t, httpClient, ts.URL)
+	// refreshed entry is fresh and carries headers of 304
+	resp, body := mustGet(t, httpClient, ts.URL)
+	if body != "hello" || resp.Header.Get("X-Hit") != "2" {
+		t.Fatalf("expected hello with X-Hit 2; got %q with %q", body, resp.Header.Get("X-Hit"))
+	}
+	if tsHits != 2 {
+		t.Fatalf("expected 2 server hits; got %d", tsHits)
+	}
+}
+
+func TestStaleGrace(t *testing.T) {
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	failing := false
+	cache := ttlCache{Cache: naivehttpcache.NewMemoryCache(0, 0)}
+	clock := newFakeClock()
+	transport := naivehttpcache.NewTransport(&cache,
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithStaleIfError(),
+		naivehttpcache.WithStaleGrace(time.Hour),
+		naivehttpcache.WithClock(clock),
+		naivehttpcache.WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			if failing {
+				return nil, errors.New("origin is down")
+			}
+			return http.DefaultTransport.RoundTrip(req)
+		})),
+	)
+	httpClient := &http.Client{Transport: transport}
+
+	mustGet(t, httpClient, ts.URL)
+	// Date header is only precise to a second
+	if cache.ttl <= time.Hour || cache.ttl > time.Hour+time.Minute {
+		t.Fatalf("expected entry to be kept for its lifetime and grace; got %v", cache.ttl)
+	}
+
+	failing = true
+	clock.Advance(30 * time.Minute)
+	if resp, _ := mustGet(t, httpClient, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected stale entry within grace to be served")
+	}
+
+	clock.Advance(time.Hour)
+	if _, err := httpClient.Get(ts.URL); err == nil {
+		t.Fatal("expected entry past grace to be dropped")
+	}
+}
+
+func TestStreamingBypass(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" {
+			w.Header().Set("Content-Type", "text/event-stream")
+		}
+		// flushing makes response chunked, i.e. of unknown length
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("data: 1234\n\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithStreamingThreshold(32),
+		),
+	}
+
+	for _, path := range []string{"/events", "/long"} {
+		mustGet(t, httpClient, ts.URL+path)
+		if resp, _ := mustGet(t, httpClient, ts.URL+path); resp.Header.Get(naivehttpcache.XFromCache) != "" {
+			t.Fatalf("%s: expected streaming response to not be cached", path)
+		}
+	}
+
+	httpClient.Transport = naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()))
+	mustGet(t, httpClient, ts.URL+"/long")
+	if resp, _ := mustGet(t, httpClient, ts.URL+"/long"); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected response within default threshold to be cached")
+	}
+}
+
+func TestUpgradeBypass(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("upgrade") != "echo" {
+			w.Write([]byte("hello"))
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0)),
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("connection", "keep-alive, Upgrade")
+	req.Header.Set("upgrade", "echo")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("expected the protocol to be switched; got %s", resp.Status)
+	}
+	if info, _ := naivehttpcache.FromResponse(resp); info.Outcome != naivehttpcache.OutcomeBypass {
+		t.Fatalf("expected upgrade to bypass the cache; got %v", info.Outcome)
+	}
+	conn, ok := resp.Body.(io.ReadWriter)
+	if !ok {
+		t.Fatalf("expected body of upgraded connection to be writable; got %T", resp.Body)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("expected echo over upgraded connection; got %q, %v", buf, err)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chunked":
+			// flushing makes response chunked, i.e. of unknown length
+			for i := 0; i < 4; i++ {
+				w.Write([]byte("data: 1234\n\n"))
+				w.(http.Flusher).Flush()
+			}
+		case "/sized":
+			w.Write(bytes.Repeat([]byte("a"), 48))
+		default:
+			w.Write([]byte("hello"))
+		}
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithMaxBodySize(32),
+		),
+	}
+
+	for _, path := range []string{"/chunked", "/sized"} {
+		if _, body := mustGet(t, httpClient, ts.URL+path); len(body) != 48 {
+			t.Fatalf("%s: expected the whole body to be streamed; got %d bytes", path, len(body))
+		}
+		if resp, _ := mustGet(t, httpClient, ts.URL+path); resp.Header.Get(naivehttpcache.XFromCache) != "" {
+			t.Fatalf("%s: expected response over the limit to not be cached", path)
+		}
+	}
+
+	mustGet(t, httpClient, ts.URL+"/small")
+	if resp, _ := mustGet(t, httpClient, ts.URL+"/small"); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected response within the limit to be cached")
+	}
+}
+
+func TestIncompleteBodies(t *testing.T) {
+	for _, releaseOnCancel := range []bool{false, true} {
+		cache := httpcache.NewMemoryCache()
+		opts := []naivehttpcache.Option{
+			naivehttpcache.WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				resp := &http.Response{
+					StatusCode:    http.StatusOK,
+					Header:        http.Header{},
+					Body:          ioutil.NopCloser(strings.NewReader("hello")),
+					ContentLength: -1,
+					Request:       req,
+				}
+				if req.URL.Path == "/short" {
+					resp.ContentLength = 10
+				}
+				return resp, nil
+			})),
+		}
+		if releaseOnCancel {
+			opts = append(opts, naivehttpcache.WithReleaseOnCancel())
+		}
+		httpClient := &http.Client{
+			Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(cache), opts...),
+		}
+
+		mustGet(t, httpClient, "http://example.com/short")
+		if _, ok := cache.Get("http://example.com/short"); ok {
+			t.Fatalf("release on cancel %v: expected body shorter than Content-Length to not be stored", releaseOnCancel)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "http://example.com/canceled", nil)
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancel()
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || string(body) != "hello" {
+			t.Fatalf("release on cancel %v: expected the body to be readable; got %q, %v", releaseOnCancel, body, err)
+		}
+		if _, ok := cache.Get("http://example.com/canceled"); ok {
+			t.Fatalf("release on cancel %v: expected body of canceled request to not be stored", releaseOnCancel)
+		}
+	}
+}
+
+func TestBackgroundFill(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("data: 1234\n\n"))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		limit  int64
+		cached bool
+	}{
+		{64, true},
+		{32, false},
+	} {
+		cache := httpcache.NewMemoryCache()
+		httpClient := &http.Client{
+			Transport: naivehttpcache.NewTransport(
+				naivehttpcache.FromHTTPCache(cache),
+				naivehttpcache.WithBackgroundFill(tc.limit),
+			),
+		}
+
+		resp, err := httpClient.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Read(make([]byte, 1))
+		resp.Body.Close()
+
+		// the body is filled in the background, waiting for what isn't
+		// expected to happen is cut short
+		wait := time.Second
+		if !tc.cached {
+			wait = 100 * time.Millisecond
+		}
+		cached := false
+		for deadline := time.Now().Add(wait); !cached && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+			_, cached = cache.Get(ts.URL)
+		}
+		if cached != tc.cached {
+			t.Fatalf("limit %d: expected cached to be %v", tc.limit, tc.cached)
+		}
+	}
+}
+
+func TestEagerBuffering(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithEagerBuffering(8),
+		),
+	}
+
+	tests := []struct {
+		path   string
+		cached bool
+	}{
+		{"/short", true},
+		// doesn't fit, so it's left unread and uncached
+		{"/very/long/path", false},
+	}
+	for _, tt := range tests {
+		// only status is checked, body is never read
+		resp, err := httpClient.Get(ts.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		resp, body := mustGet(t, httpClient, ts.URL+tt.path)
+		if cached := resp.Header.Get(naivehttpcache.XFromCache) == "1"; cached != tt.cached {
+			t.Fatalf("%s: expected cached %t; got %t", tt.path, tt.cached, cached)
+		}
+		if body != tt.path {
+			t.Fatalf("%s: expected body %q; got %q", tt.path, tt.path, body)
+		}
+	}
+}
+
+// discardCache is naivehttpcache.Cache that never stores anything.
+type discardCache struct{}
+
+func (discardCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+func (discardCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	return nil
+}
+
+func (discardCache) Delete(ctx context.Context, key string) error {
+	return nil
+}
+
+func benchmarkMiss(b *testing.B, size int, chunked bool) {
+	body := bytes.Repeat([]byte("a"), size)
+	transport := naivehttpcache.NewTransport(
+		discardCache{},
+		naivehttpcache.WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			contentLength := int64(size)
+			if chunked {
+				contentLength = -1
+			}
+			return &http.Response{
+				StatusCode:    http.StatusOK,
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        http.Header{},
+				ContentLength: contentLength,
+				Body:          ioutil.NopCloser(bytes.NewReader(body)),
+				Request:       req,
+			}, nil
+		})),
+	)
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+func BenchmarkMiss(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			benchmarkMiss(b, size, false)
+		})
+		b.Run(fmt.Sprintf("%dKB/chunked", size>>10), func(b *testing.B) {
+			benchmarkMiss(b, size, true)
+		})
+	}
+}
+
+func BenchmarkHit(b *testing.B) {
+	for _, size := range []int{1 << 10, 64 << 10, 1 << 20} {
+		b.Run(fmt.Sprintf("%dKB", size>>10), func(b *testing.B) {
+			body := bytes.Repeat([]byte("a"), size)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("ETag", `"v1"`)
+				w.Write(body)
+			}))
+			defer ts.Close()
+
+			transport := naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()))
+			req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+
+			b.ReportAllocs()
+			b.SetBytes(int64(size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				resp, err := transport.RoundTrip(req)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+					b.Fatal("expected a hit")
+				}
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+			}
+		})
+	}
+}
+
+// slowCache is naivehttpcache.Cache counting Set calls, which take a while.
+type slowCache struct {
+	naivehttpcache.Cache
+	mu   sync.Mutex
+	sets int
+}
+
+func (c *slowCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	c.sets++
+	c.mu.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	return c.Cache.Set(ctx, key, val, ttl)
+}
+
+func TestConcurrentStores(t *testing.T) {
+	const n = 8
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// respond to all requests at once
+		arrived.Done()
+		arrived.Wait()
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	cache := &slowCache{Cache: naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache())}
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(cache),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := httpClient.Get(ts.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			ioutil.ReadAll(resp.Body)
+		}()
+	}
+	wg.Wait()
+
+	if cache.sets != 1 {
+		t.Fatalf("expected 1 store; got %d", cache.sets)
+	}
+}
+
+func TestConcurrentHits(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Origin", "1")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0)),
+	}
+
+	// the caller changes the header before reading the body, which must not
+	// reach the cache
+	resp, err := httpClient.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Header.Del("X-Origin")
+	resp.Header.Set("X-Caller", "1")
+	ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := httpClient.Get(ts.URL)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.Header.Get("X-Origin") != "1" || resp.Header.Get("X-Caller") != "" {
+				t.Errorf("expected header as it came from the server; got %v", resp.Header)
+			}
+			resp.Header.Set("X-Caller", strconv.Itoa(i))
+			body, err := ioutil.ReadAll(resp.Body)
+			if err != nil || string(body) != "hello" {
+				t.Errorf("expected whole body of its own; got %q, %v", body, err)
+			}
+			if v := resp.Header.Get("X-Caller"); v != strconv.Itoa(i) {
+				t.Errorf("expected header of its own; got X-Caller %q", v)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPurgeFunc(t *testing.T) {
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("cache-control", "max-age=3600")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	clock := newFakeClock()
+	transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithClock(clock))
+	client := &http.Client{Transport: transport}
+
+	mustGet(t, client, ts.URL+"/old")
+	clock.Advance(time.Hour / 2)
+	mustGet(t, client, ts.URL+"/new")
+	clock.Advance(time.Hour / 4)
+
+	deleted, err := transport.PurgeFunc(context.Background(), func(key string, meta naivehttpcache.EntryMeta) bool {
+		return meta.Age() > time.Hour/2
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 1 || cache.Len() != 1 {
+		t.Fatalf("expected /old to be purged; got %d deleted and %d left", deleted, cache.Len())
+	}
+	if resp, _ := mustGet(t, client, ts.URL+"/new"); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected /new to be kept")
+	}
+}
+
+// idleClosingTransport is http.RoundTripper counting CloseIdleConnections.
+type idleClosingTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *idleClosingTransport) CloseIdleConnections() {
+	t.closed++
+}
+
+func TestCloseIdleConnections(t *testing.T) {
+	underlying := &idleClosingTransport{RoundTripper: http.DefaultTransport}
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithTransport(underlying),
+		),
+	}
+	httpClient.CloseIdleConnections()
+	if underlying.closed != 1 {
+		t.Fatalf("expected idle connections of the underlying transport to be closed; got %d calls", underlying.closed)
+	}
+}
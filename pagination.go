@@ -0,0 +1,54 @@
+package naivehttpcache
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// WithNextPage makes Transport prefetch pages predicted by next after pages
+// of paginated APIs, DefaultNextPage if next is nil, see Transport.NextPage.
+func WithNextPage(next func(req *http.Request, resp *http.Response) *url.URL) Option {
+	if next == nil {
+		next = DefaultNextPage
+	}
+	return func(o *Options) {
+		o.NextPage = next
+	}
+}
+
+// DefaultNextPage predicts the next page of successful resp to req of a
+// paginated API: the URL of Link header with rel=next, or otherwise the URL
+// of req with its page query parameter, if it's an integer, incremented.
+func DefaultNextPage(req *http.Request, resp *http.Response) *url.URL {
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	for _, link := range headerLinks(resp.Header, "next") {
+		if u, err := req.URL.Parse(link); err == nil {
+			return u
+		}
+	}
+
+	query := req.URL.Query()
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil {
+		return nil
+	}
+	query.Set("page", strconv.Itoa(page+1))
+	u := *req.URL
+	u.RawQuery = query.Encode()
+	return &u
+}
+
+// prefetchNextPage prefetches the page predicted by NextPage after resp to
+// req. Pages that are prefetched themselves are not followed, so a fetch of a
+// page only warms the one after it.
+func (t *Transport) prefetchNextPage(req *http.Request, resp *http.Response) {
+	if _, ok := req.Context().Value(prefetchDepthKey{}).(int); ok {
+		return
+	}
+	if u := t.NextPage(req, resp); u != nil {
+		t.prefetchURL(req, u, 0)
+	}
+}
@@ -0,0 +1,119 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestDefaultNextPage(t *testing.T) {
+	tests := []struct {
+		url  string
+		link string
+		want string
+	}{
+		{url: "http://example.com/items?page=1&sort=id", want: "http://example.com/items?page=2&sort=id"},
+		{url: "http://example.com/items?page=1", link: `</items?cursor=abc>; rel="next"`, want: "http://example.com/items?cursor=abc"},
+		{url: "http://example.com/items?page=last"},
+		{url: "http://example.com/items"},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+		if test.link != "" {
+			resp.Header.Set("Link", test.link)
+		}
+		var got string
+		if u := naivehttpcache.DefaultNextPage(req, resp); u != nil {
+			got = u.String()
+		}
+		if got != test.want {
+			t.Errorf("%s: expected %q; got %q", test.url, test.want, got)
+		}
+	}
+}
+
+func TestNextPage(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.RawQuery]++
+		mu.Unlock()
+		w.Write([]byte(r.URL.RawQuery))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithNextPage(nil),
+	)
+	client := &http.Client{Transport: transport}
+	mustGet(t, client, ts.URL+"/items?page=1")
+
+	if !waitUntil(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits["page=2"] == 1
+	}) {
+		t.Fatal("expected the next page to be prefetched")
+	}
+
+	if resp, _ := mustGet(t, client, ts.URL+"/items?page=2"); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected the next page to be served from the cache")
+	}
+	// which warms the page after it in turn
+	if !waitUntil(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits["page=3"] == 1
+	}) {
+		t.Fatal("expected the page after the next one to be prefetched")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["page=4"] != 0 {
+		t.Fatalf("expected prefetched pages not to be followed; got %v", hits)
+	}
+}
+
+func TestNextPagePredictor(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithNextPage(func(req *http.Request, resp *http.Response) *url.URL {
+			if req.URL.Path != "/first" {
+				return nil
+			}
+			return req.URL.ResolveReference(&url.URL{Path: "/second"})
+		}),
+	)
+	mustGet(t, &http.Client{Transport: transport}, ts.URL+"/first")
+
+	if !waitUntil(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(paths) == 2
+	}) {
+		t.Fatal("expected the predicted page to be prefetched")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if paths[1] != "/second" {
+		t.Fatalf("expected /second to be prefetched; got %q", paths)
+	}
+}
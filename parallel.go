@@ -0,0 +1,211 @@
+package naivehttpcache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+// DefaultParallelFetches is the default Transport.ParallelFetches.
+const DefaultParallelFetches = 4
+
+// errChunkMismatch is the error of chunks of parallel downloads that don't
+// continue the response.
+var errChunkMismatch = errors.New("naivehttpcache: chunk doesn't match the response")
+
+// WithParallelFill makes Transport download responses in chunks of chunkSize
+// bytes, fetches of them concurrently, see Transport.ParallelChunkSize.
+func WithParallelFill(chunkSize int64, fetches int) Option {
+	return func(o *Options) {
+		o.ParallelChunkSize = chunkSize
+		o.ParallelFetches = fetches
+	}
+}
+
+func (t *Transport) parallelFetches() int {
+	if t.ParallelFetches > 0 {
+		return t.ParallelFetches
+	}
+	return DefaultParallelFetches
+}
+
+// chunkRequest returns req asking for bytes of the response from start to end
+// inclusive, as long as it still has validator (if it's not empty).
+func chunkRequest(req *http.Request, start, end int64, validator string) *http.Request {
+	chunkreq := req.Clone(req.Context())
+	chunkreq.Header.Set("range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10))
+	if validator != "" {
+		chunkreq.Header.Set("if-range", validator)
+	}
+	return chunkreq
+}
+
+// parallelFill turns resp, the response to the first chunk of fillreq (see
+// chunkRequest), into a full response, the rest of which is fetched in
+// parallel. False means that resp can't be continued this way, in which case
+// its body is closed unless it's a full response, which is returned as is.
+func (t *Transport) parallelFill(transport http.RoundTripper, fillreq *http.Request, resp *http.Response) (*http.Response, bool) {
+	if resp.StatusCode == http.StatusOK {
+		return resp, true
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, false
+	}
+	start, end, size, ok := parseContentRange(resp.Header.Get("content-range"))
+	validator := ifRangeValidator(resp.Header)
+	if !ok || start != 0 || end+1 < size && validator == "" {
+		resp.Body.Close()
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(fillreq.Context())
+	body := &parallelBody{
+		first:  resp.Body,
+		cancel: cancel,
+		slots:  make(chan struct{}, t.parallelFetches()),
+	}
+	for start := end + 1; start < size; start += t.ParallelChunkSize {
+		end := start + t.ParallelChunkSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		body.chunks = append(body.chunks, &chunk{
+			req:   chunkRequest(fillreq.WithContext(ctx), start, end, validator),
+			start: start,
+			end:   end,
+			size:  size,
+			done:  make(chan struct{}),
+		})
+	}
+	go body.fetch(t, transport)
+
+	full := *resp
+	full.Status = "200 " + http.StatusText(http.StatusOK)
+	full.StatusCode = http.StatusOK
+	full.Header = resp.Header.Clone()
+	full.Header.Del("content-range")
+	full.Header.Set("content-length", strconv.FormatInt(size, 10))
+	full.ContentLength = size
+	full.Body = body
+	return &full, true
+}
+
+// chunk is a part of parallel download.
+type chunk struct {
+	req *http.Request
+	// start, end and size are as in Content-Range of the chunk.
+	start, end, size int64
+	// done is closed once data or err is set.
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// parallelBody is a body of parallel download: the first chunk is read from
+// the response as is, others are fetched ahead of the reader.
+type parallelBody struct {
+	first  io.ReadCloser
+	chunks []*chunk
+	cancel context.CancelFunc
+	// slots limit the number of chunks that are fetched or wait to be read.
+	slots chan struct{}
+
+	// read is the number of read chunks, the first one included.
+	read int
+	cur  *bytes.Reader
+	err  error
+}
+
+// fetch fetches chunks in order, as long as there are free slots.
+func (b *parallelBody) fetch(t *Transport, transport http.RoundTripper) {
+	for i, c := range b.chunks {
+		select {
+		case b.slots <- struct{}{}:
+		case <-c.req.Context().Done():
+			// chunks that are not fetched yet are never going to be
+			for _, c := range b.chunks[i:] {
+				c.err = c.req.Context().Err()
+				close(c.done)
+			}
+			return
+		}
+		c := c
+		go func() {
+			c.data, c.err = t.fetchChunk(transport, c)
+			close(c.done)
+		}()
+	}
+}
+
+// fetchChunk returns data of chunk c.
+func (t *Transport) fetchChunk(transport http.RoundTripper, c *chunk) ([]byte, error) {
+	if err := t.waitOrigin(c.req); err != nil {
+		return nil, err
+	}
+	resp, err := transport.RoundTrip(c.req)
+	t.originResult(c.req, resp, err)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	start, end, size, ok := parseContentRange(resp.Header.Get("content-range"))
+	if resp.StatusCode != http.StatusPartialContent || !ok || start != c.start || end != c.end || size != c.size {
+		return nil, errChunkMismatch
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != end-start+1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return data, nil
+}
+
+func (b *parallelBody) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.read == 0 {
+		n, err := b.first.Read(p)
+		if err != io.EOF {
+			return n, err
+		}
+		b.read++
+		if n > 0 {
+			return n, nil
+		}
+	}
+
+	for b.cur == nil || b.cur.Len() == 0 {
+		if b.cur != nil {
+			// the chunk is read, its slot is free
+			b.cur = nil
+			b.read++
+			<-b.slots
+		}
+		if b.read > len(b.chunks) {
+			b.err = io.EOF
+			return 0, io.EOF
+		}
+		c := b.chunks[b.read-1]
+		<-c.done
+		if c.err != nil {
+			b.err = c.err
+			return 0, c.err
+		}
+		b.cur = bytes.NewReader(c.data)
+	}
+	return b.cur.Read(p)
+}
+
+func (b *parallelBody) Close() error {
+	b.cancel()
+	return b.first.Close()
+}
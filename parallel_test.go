@@ -0,0 +1,63 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestParallelFill(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	var mu sync.Mutex
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		if r.URL.Path == "/plain" {
+			w.Write(content)
+			return
+		}
+		w.Header().Set("etag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithParallelFill(16<<10, 2),
+		),
+	}
+
+	for _, tc := range []struct {
+		path     string
+		requests int
+	}{
+		{"/ranges", 7},
+		{"/plain", 1},
+	} {
+		mu.Lock()
+		requests = 0
+		mu.Unlock()
+		resp, body := mustGet(t, httpClient, ts.URL+tc.path)
+		if resp.StatusCode != http.StatusOK || body != string(content) {
+			t.Fatalf("%s: expected the whole content; got %d with %d bytes", tc.path, resp.StatusCode, len(body))
+		}
+		mu.Lock()
+		n := requests
+		mu.Unlock()
+		if n != tc.requests {
+			t.Fatalf("%s: expected %d requests; got %d", tc.path, tc.requests, n)
+		}
+		if resp, body := mustGet(t, httpClient, ts.URL+tc.path); resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != string(content) {
+			t.Fatalf("%s: expected the content to be cached", tc.path)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package naivehttpcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// partialMagic prefixes encoded partial entries, which are gob encoded
+// partialEntry followed by its crc32. Values without it are partial entries
+// stored by versions of the package that didn't checksum them.
+const partialMagic = "\x89NHP"
+
+// partialEntry is a set of cached ranges of a single representation. Once
+// ranges cover the whole representation it's upgraded to a full entry.
+type partialEntry struct {
+	// Header is the header of the first stored 206 response, without
+	// Content-Range and Content-Length.
+	Header http.Header
+	// Size is the complete length of the representation.
+	Size int64
+	// Chunks are sorted by Start and never overlap or touch each other.
+	Chunks []partialChunk
+	// StoredAt is the date of the first stored range, see Transport.dated.
+	StoredAt time.Time
+	// CachedAt is when the first range was written to the cache, see
+	// entry.CachedAt.
+	CachedAt time.Time
+}
+
+type partialChunk struct {
+	Start int64
+	Data  []byte
+}
+
+// partialKey returns the key under which ranges of response to cacheKey are
+// stored.
+func partialKey(cacheKey string) string {
+	return "partial " + cacheKey
+}
+
+// parseContentRange parses Content-Range header of a single part 206 response.
+// Ranges of unknown complete length are not supported.
+func parseContentRange(s string) (start, end, size int64, ok bool) {
+	const b = "bytes "
+	if !strings.HasPrefix(s, b) {
+		return 0, 0, 0, false
+	}
+	s = s[len(b):]
+	dash := strings.IndexByte(s, '-')
+	slash := strings.IndexByte(s, '/')
+	if dash < 0 || slash < dash {
+		return 0, 0, 0, false
+	}
+	var err error
+	if start, err = strconv.ParseInt(s[:dash], 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if end, err = strconv.ParseInt(s[dash+1:slash], 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if size, err = strconv.ParseInt(s[slash+1:], 10, 64); err != nil {
+		return 0, 0, 0, false
+	}
+	if start < 0 || end < start || end >= size {
+		return 0, 0, 0, false
+	}
+	return start, end, size, true
+}
+
+// verifyPartialEntry reports whether val, if it's an encoded partial entry,
+// matches its checksum. Values that are not checksummed partial entries are
+// not checked at all.
+func verifyPartialEntry(val []byte) bool {
+	if !bytes.HasPrefix(val, []byte(partialMagic)) {
+		return true
+	}
+	data := val[len(partialMagic):]
+	if len(data) < 4 {
+		return false
+	}
+	sum := data[len(data)-4:]
+	return crc32.ChecksumIEEE(data[:len(data)-4]) == binary.BigEndian.Uint32(sum)
+}
+
+func decodePartialEntry(val []byte) (*partialEntry, error) {
+	if bytes.HasPrefix(val, []byte(partialMagic)) {
+		if !verifyPartialEntry(val) {
+			return nil, errCorruptEntry
+		}
+		val = val[len(partialMagic) : len(val)-4]
+	}
+	var entry partialEntry
+	if err := gob.NewDecoder(bytes.NewReader(val)).Decode(&entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (e *partialEntry) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(partialMagic)
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return nil, err
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf.Bytes()[len(partialMagic):]))
+	buf.Write(sum[:])
+	return buf.Bytes(), nil
+}
+
+// sameRepresentation reports whether ranges from response with header can be
+// combined with ranges of e.
+func (e *partialEntry) sameRepresentation(header http.Header, size int64) bool {
+	if e.Size != size {
+		return false
+	}
+	if etag := e.Header.Get("etag"); etag != "" {
+		return etag == header.Get("etag")
+	}
+	if lastModified := e.Header.Get("last-modified"); lastModified != "" {
+		return lastModified == header.Get("last-modified")
+	}
+	return true
+}
+
+// add merges data starting at start into e.
+func (e *partialEntry) add(start int64, data []byte) {
+	e.Chunks = append(e.Chunks, partialChunk{Start: start, Data: data})
+	sort.Slice(e.Chunks, func(i, j int) bool {
+		return e.Chunks[i].Start < e.Chunks[j].Start
+	})
+
+	merged := e.Chunks[:1]
+	for _, chunk := range e.Chunks[1:] {
+		last := &merged[len(merged)-1]
+		lastEnd := last.Start + int64(len(last.Data))
+		if chunk.Start > lastEnd {
+			merged = append(merged, chunk)
+			continue
+		}
+		if chunkEnd := chunk.Start + int64(len(chunk.Data)); chunkEnd > lastEnd {
+			data := make([]byte, 0, chunkEnd-last.Start)
+			data = append(data, last.Data...)
+			data = append(data, chunk.Data[lastEnd-chunk.Start:]...)
+			last.Data = data
+		}
+	}
+	e.Chunks = merged
+}
+
+// storedAt returns when e was stored, see storedAt.
+func (e *partialEntry) storedAt() time.Time {
+	return storedAt(e.StoredAt, e.Header)
+}
+
+// partialMeta returns EntryMeta of partial entry e.
+func (t *Transport) partialMeta(e *partialEntry) EntryMeta {
+	meta := t.meta(http.StatusOK, e.Header, e.storedAt())
+	meta.CachedAt = e.CachedAt
+	return meta
+}
+
+// complete reports whether e covers the whole representation.
+func (e *partialEntry) complete() bool {
+	return len(e.Chunks) == 1 && e.Chunks[0].Start == 0 && int64(len(e.Chunks[0].Data)) == e.Size
+}
+
+// slice returns content of r, false means that e doesn't cover all of it.
+func (e *partialEntry) slice(r byteRange) ([]byte, bool) {
+	for _, chunk := range e.Chunks {
+		if chunk.Start <= r.start && r.start+r.length <= chunk.Start+int64(len(chunk.Data)) {
+			offset := r.start - chunk.Start
+			return chunk.Data[offset : offset+r.length], true
+		}
+	}
+	return nil, false
+}
+
+// servePartial serves range request req out of cached ranges. False means
+// that the range isn't cached.
+func (t *Transport) servePartial(req *http.Request, reqCC cacheControl, cacheKey string) (*http.Response, bool, error) {
+	key := partialKey(cacheKey)
+	val, ok, err := t.lookup(req, reqCC, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, nil
+	}
+	entry, err := decodePartialEntry(val)
+	if err != nil {
+		return nil, false, t.corrupt(req.Context(), key, err)
+	}
+
+	if t.Mode != ModeReplay {
+		fresh, err := t.fresh(req, reqCC, t.meta(http.StatusOK, entry.Header, entry.storedAt()))
+		if err != nil {
+			return nil, false, err
+		}
+		if !fresh {
+			if t.writes() {
+				if err := t.cacheDelete(req.Context(), key); err != nil {
+					return nil, false, err
+				}
+				t.emit(EventEvict, key, 0)
+			}
+			return nil, false, nil
+		}
+	}
+
+	if !ifRangeMatches(req, entry.Header) {
+		return nil, false, nil
+	}
+	ranges, err := parseRange(req.Header.Get("range"), entry.Size)
+	if err != nil || len(ranges) != 1 {
+		return nil, false, nil
+	}
+	data, ok := entry.slice(ranges[0])
+	if !ok {
+		return nil, false, nil
+	}
+
+	header := entry.Header.Clone()
+	header.Set("content-range", ranges[0].contentRange(entry.Size))
+	header.Set("content-length", strconv.FormatInt(ranges[0].length, 10))
+	return t.serve(req, &http.Response{
+		Status:        "206 " + http.StatusText(http.StatusPartialContent),
+		StatusCode:    http.StatusPartialContent,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		ContentLength: ranges[0].length,
+		Body:          newCachedBody(data),
+	}, entry.storedAt()), true, nil
+}
+
+// storePartial merges range from 206 resp with body into the ranges cached
+// under cacheKey and upgrades them to a full entry once they are complete.
+func (t *Transport) storePartial(ctx context.Context, cacheKey string, resp *http.Response, body io.Reader) error {
+	start, end, size, ok := parseContentRange(resp.Header.Get("content-range"))
+	if !ok {
+		return nil
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil || int64(len(data)) != end-start+1 {
+		return nil
+	}
+
+	key := partialKey(cacheKey)
+	// concurrent ranges must be merged one by one, otherwise some are lost
+	unlock := t.storeLocks.lock(key)
+	defer unlock()
+
+	val, ok, err := t.cacheGet(ctx, key)
+	if err != nil {
+		return err
+	}
+	var entry *partialEntry
+	if ok {
+		entry, err = decodePartialEntry(val)
+		// banned ranges must not make it into a full entry, which is newer
+		if err != nil || !entry.sameRepresentation(resp.Header, size) || t.bans.match(key, t.partialMeta(entry)) {
+			entry = nil
+		}
+	}
+	if entry == nil {
+		r := *resp
+		r.Header = resp.Header.Clone()
+		if t.StoreTransform != nil {
+			t.StoreTransform(&r)
+		}
+		header := r.Header
+		header.Del("content-range")
+		header.Del("content-length")
+		entry = &partialEntry{Header: header, Size: size, StoredAt: t.dated(header), CachedAt: t.now()}
+	}
+	entry.add(start, data)
+
+	if entry.complete() {
+		full := &http.Response{
+			Status:        "200 " + http.StatusText(http.StatusOK),
+			StatusCode:    http.StatusOK,
+			Proto:         resp.Proto,
+			ProtoMajor:    resp.ProtoMajor,
+			ProtoMinor:    resp.ProtoMinor,
+			Header:        entry.Header,
+			ContentLength: size,
+		}
+		// store also drops the ranges
+		return t.storeAt(ctx, cacheKey, full, bytes.NewReader(entry.Chunks[0].Data), entry.storedAt())
+	}
+
+	val, err = entry.encode()
+	if err != nil {
+		return nil
+	}
+	if err := t.cacheSet(ctx, key, val, t.ttl(t.meta(http.StatusOK, entry.Header, entry.storedAt()))); err != nil {
+		return err
+	}
+	t.emit(EventStore, key, 0)
+	return nil
+}
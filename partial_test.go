@@ -0,0 +1,63 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestPartialContent(t *testing.T) {
+	var tsRanges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsRanges = append(tsRanges, r.Header.Get("Range"))
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte(rangeContent)))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithPartialContent(),
+		),
+	}
+
+	tests := []struct {
+		rng       string
+		status    int
+		body      string
+		fromCache bool
+	}{
+		{"bytes=0-4", http.StatusPartialContent, "01234", false},
+		{"bytes=1-3", http.StatusPartialContent, "123", true},
+		// not covered yet
+		{"bytes=3-6", http.StatusPartialContent, "3456", false},
+		{"bytes=0-6", http.StatusPartialContent, "0123456", true},
+		// completes the representation, upgrading it to a full entry
+		{"bytes=7-", http.StatusPartialContent, "789", false},
+		{"", http.StatusOK, rangeContent, true},
+		{"bytes=8-9", http.StatusPartialContent, "89", true},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		if tt.rng != "" {
+			req.Header.Set("Range", tt.rng)
+		}
+		resp, body := fetch(t, httpClient, req)
+		if resp.StatusCode != tt.status || body != tt.body {
+			t.Fatalf("%q: expected %d with %q; got %d with %q", tt.rng, tt.status, tt.body, resp.StatusCode, body)
+		}
+		if fromCache := resp.Header.Get(naivehttpcache.XFromCache) == "1"; fromCache != tt.fromCache {
+			t.Fatalf("%q: expected from cache %t; got %t", tt.rng, tt.fromCache, fromCache)
+		}
+	}
+
+	if len(tsRanges) != 3 {
+		t.Fatalf("expected 3 server hits; got %q", tsRanges)
+	}
+}
@@ -0,0 +1,206 @@
+package naivehttpcache
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// DefaultPrefetchConcurrency is the default Transport.PrefetchConcurrency.
+const DefaultPrefetchConcurrency = 4
+
+// WithPrefetch makes Transport prefetch links of responses up to depth levels
+// deep, at most concurrency at a time, see Transport.PrefetchDepth.
+func WithPrefetch(depth, concurrency int) Option {
+	return func(o *Options) {
+		o.PrefetchDepth = depth
+		o.PrefetchConcurrency = concurrency
+	}
+}
+
+// prefetches tracks prefetches in flight.
+type prefetches struct {
+	mu sync.Mutex
+	// urls holds URLs being prefetched.
+	urls map[string]bool
+}
+
+// prefetchDepthKey is the context key of the number of levels of links that
+// are still followed from a prefetched response.
+type prefetchDepthKey struct{}
+
+// prefetchLinks prefetches links of resp to req, see PrefetchDepth.
+func (t *Transport) prefetchLinks(req *http.Request, resp *http.Response) {
+	depth, ok := req.Context().Value(prefetchDepthKey{}).(int)
+	if !ok {
+		depth = t.PrefetchDepth
+	}
+	if depth <= 0 {
+		return
+	}
+
+	for _, link := range headerLinks(resp.Header, "preload", "next") {
+		if u, err := req.URL.Parse(link); err == nil {
+			t.prefetchURL(req, u, depth-1)
+		}
+	}
+}
+
+// prefetchURL prefetches u for req, unless it's req itself or of another
+// origin, see prefetch.
+func (t *Transport) prefetchURL(req *http.Request, u *url.URL, depth int) {
+	if u.Scheme != req.URL.Scheme || !strings.EqualFold(u.Host, req.URL.Host) {
+		return
+	}
+	target := *u
+	target.Fragment = ""
+	if target.String() != req.URL.String() {
+		t.prefetch(req, target.String(), depth)
+	}
+}
+
+// prefetch fetches url into the cache in the background, with headers and
+// values of the context of req, following links of the response up to depth
+// levels deep. It's skipped if url is being prefetched already, if there are
+// PrefetchConcurrency prefetches in flight, or if t is closed.
+func (t *Transport) prefetch(req *http.Request, url string, depth int) {
+	limit := t.PrefetchConcurrency
+	if limit <= 0 {
+		limit = DefaultPrefetchConcurrency
+	}
+	p := &t.prefetches
+	p.mu.Lock()
+	if p.urls[url] || len(p.urls) >= limit {
+		p.mu.Unlock()
+		return
+	}
+	if p.urls == nil {
+		p.urls = make(map[string]bool)
+	}
+	p.urls[url] = true
+	p.mu.Unlock()
+
+	ctx, cancel := t.storeContext(context.WithValue(req.Context(), prefetchDepthKey{}, depth))
+	preq, err := backgroundRequest(ctx, req, url)
+	if err != nil {
+		cancel()
+		t.prefetched(url)
+		return
+	}
+
+	started := t.goBackground(func() {
+		defer t.prefetched(url)
+		defer cancel()
+		t.fetchBackground(preq)
+	})
+	if !started {
+		cancel()
+		t.prefetched(url)
+	}
+}
+
+// backgroundRequest returns GET request of url with ctx that is made in the
+// background on behalf of req, with headers of req minus Range and
+// conditional ones.
+func backgroundRequest(ctx context.Context, req *http.Request, url string) (*http.Request, error) {
+	breq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	breq.Header = req.Header.Clone()
+	for _, name := range []string{"Range", "If-Range", "If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since"} {
+		breq.Header.Del(name)
+	}
+	return breq, nil
+}
+
+// backgroundKey is the context key of requests made by Transport itself in
+// the background, see fetchBackground.
+type backgroundKey struct{}
+
+// fetchBackground fetches req made by backgroundRequest through t and reads
+// its body, so that it's stored. It's not caller's traffic, so it's not
+// counted by Metrics, Observer, OnLowHitRatio and hit and miss Events.
+func (t *Transport) fetchBackground(req *http.Request) {
+	req = req.WithContext(context.WithValue(req.Context(), backgroundKey{}, true))
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
+
+// inBackground reports whether ctx is of a request made by fetchBackground.
+func inBackground(ctx context.Context) bool {
+	return ctx.Value(backgroundKey{}) != nil
+}
+
+// prefetched records that prefetch of url is done.
+func (t *Transport) prefetched(url string) {
+	t.prefetches.mu.Lock()
+	delete(t.prefetches.urls, url)
+	t.prefetches.mu.Unlock()
+}
+
+// headerLinks returns URL references of Link header with any of rels.
+func headerLinks(header http.Header, rels ...string) []string {
+	var links []string
+	for _, value := range header.Values("Link") {
+		for value != "" {
+			value = strings.TrimLeft(value, " \t,")
+			if !strings.HasPrefix(value, "<") {
+				break
+			}
+			end := strings.IndexByte(value, '>')
+			if end < 0 {
+				break
+			}
+			ref := value[1:end]
+			value = value[end+1:]
+
+			// params end with the next link, commas of quoted values aside
+			next := len(value)
+			quoted := false
+			for i := 0; i < len(value) && next == len(value); i++ {
+				switch {
+				case value[i] == '"':
+					quoted = !quoted
+				case value[i] == ',' && !quoted:
+					next = i
+				}
+			}
+			params := value[:next]
+			value = value[next:]
+			if hasRel(params, rels) {
+				links = append(links, ref)
+			}
+		}
+	}
+	return links
+}
+
+// hasRel reports whether params of a link hold any of rels.
+func hasRel(params string, rels []string) bool {
+	for _, param := range strings.Split(params, ";") {
+		name, val := param, ""
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name, val = param[:i], param[i+1:]
+		}
+		if !strings.EqualFold(strings.TrimSpace(name), "rel") {
+			continue
+		}
+		for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(val), `"`)) {
+			for _, want := range rels {
+				if strings.EqualFold(rel, want) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
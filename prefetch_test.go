@@ -0,0 +1,85 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestPrefetch(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Add("Link", `</style.css>; rel=preload; as=style, <https://elsewhere.example/a.js>; rel=preload`)
+			w.Header().Add("Link", `</page/2>; rel="next"; title="a, b", </about>; rel=author`)
+		case "/page/2":
+			w.Header().Set("Link", "</page/3>; rel=next")
+		case "/page/3":
+			w.Header().Set("Link", "</page/4>; rel=next")
+		}
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithPrefetch(2, 0),
+	)
+	client := &http.Client{Transport: transport}
+	mustGet(t, client, ts.URL)
+
+	if !waitUntil(func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits["/style.css"] == 1 && hits["/page/3"] == 1
+	}) {
+		t.Fatal("expected links to be prefetched")
+	}
+
+	for _, path := range []string{"/style.css", "/page/2", "/page/3"} {
+		resp, body := mustGet(t, client, ts.URL+path)
+		if resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != path {
+			t.Errorf("%s: expected to be served from the cache", path)
+		}
+	}
+	mu.Lock()
+	if hits["/page/4"] != 0 || hits["/about"] != 0 {
+		t.Fatalf("expected links beyond the depth and of other relations not to be prefetched; got %v", hits)
+	}
+	mu.Unlock()
+
+	// prefetches are not the traffic of the caller
+	if err := transport.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	m := transport.Metrics()
+	if m.Count(naivehttpcache.OutcomeMiss) != 1 || m.Count(naivehttpcache.OutcomeHit) != 3 {
+		t.Errorf("expected 1 miss and 3 hits; got %d and %d", m.Count(naivehttpcache.OutcomeMiss), m.Count(naivehttpcache.OutcomeHit))
+	}
+	if m.Stores != 1 || m.OriginBytes != 1 {
+		t.Errorf("expected 1 store of 1 byte from origin; got %d stores and %d bytes", m.Stores, m.OriginBytes)
+	}
+}
+
+// waitUntil waits for up to a second for cond to hold, and then a bit more
+// for anything in the background that follows it (e.g. stores of bodies
+// that were read, or prefetches that shouldn't happen) to happen.
+func waitUntil(cond func() bool) bool {
+	for deadline := time.Now().Add(time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			return false
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	return true
+}
@@ -0,0 +1,85 @@
+package naivehttpcache
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+)
+
+// MethodPurge is the method of requests that purge entries from ReverseProxy.
+const MethodPurge = "PURGE"
+
+// ReverseProxy is a caching reverse proxy: httputil.ReverseProxy on top of
+// Transport. Stale entries are served when the upstream fails and entries can
+// be purged with PURGE requests to their paths. PURGE removes every variant
+// of the URL (e.g. stored under other Accept-Encoding, Authorization or
+// partition): the one of the request is deleted and the rest are banned, see
+// Transport.Ban. Bans are kept until they are reaped, so proxies that are
+// purged often should run Transport.RunBanReaper or set BanLifetime.
+type ReverseProxy struct {
+	*httputil.ReverseProxy
+	// Transport is the caching transport of ReverseProxy.
+	Transport *Transport
+	// PurgeAllowed reports whether PURGE request may be served. If nil, only
+	// requests from loopback addresses are allowed to purge.
+	PurgeAllowed func(r *http.Request) bool
+}
+
+// NewReverseProxy returns ReverseProxy that routes requests to target, just
+// like httputil.NewSingleHostReverseProxy does, and caches responses of
+// target in cache. Stale-if-error is always on.
+func NewReverseProxy(target *url.URL, cache Cache, opts ...Option) *ReverseProxy {
+	// full slice expression makes append copy opts instead of writing into
+	// the caller's array
+	opts = append(opts[:len(opts):len(opts)], WithStaleIfError())
+	transport := NewTransport(cache, opts...)
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = transport
+	return &ReverseProxy{
+		ReverseProxy: proxy,
+		Transport:    transport,
+	}
+}
+
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != MethodPurge {
+		p.ReverseProxy.ServeHTTP(w, r)
+		return
+	}
+
+	allowed := p.PurgeAllowed
+	if allowed == nil {
+		allowed = fromLoopback
+	}
+	if !allowed(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	// entry is keyed by the request that goes upstream
+	outreq := r.Clone(r.Context())
+	outreq.Method = http.MethodGet
+	p.Director(outreq)
+	if err := p.Transport.PurgeRequest(outreq); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	// variants made under other headers of requests have keys of their own
+	purged := KeyURL(p.Transport.CacheKey(outreq))
+	p.Transport.Ban(func(key string, _ EntryMeta) bool {
+		return KeyURL(key) == purged
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+// fromLoopback reports whether r came from a loopback address.
+func fromLoopback(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,112 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestReverseProxy(t *testing.T) {
+	hits := 0
+	failing := false
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		hits++
+		w.Write([]byte("v" + strconv.Itoa(hits)))
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL)
+	clock := newFakeClock()
+	proxy := naivehttpcache.NewReverseProxy(target, naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithMaxAge(time.Hour),
+		naivehttpcache.WithClock(clock),
+	)
+	ts := httptest.NewServer(proxy)
+	defer ts.Close()
+
+	check := func(expected string) {
+		t.Helper()
+		resp, body := mustGet(t, http.DefaultClient, ts.URL+"/a")
+		if resp.StatusCode != http.StatusOK || body != expected {
+			t.Fatalf("expected 200 with %q; got %d with %q", expected, resp.StatusCode, body)
+		}
+	}
+
+	check("v1")
+	check("v1")
+
+	req, _ := http.NewRequest(naivehttpcache.MethodPurge, ts.URL+"/a", nil)
+	if resp, _ := fetch(t, http.DefaultClient, req); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected purge to succeed; got %d", resp.StatusCode)
+	}
+	check("v2")
+
+	// expire the entry and break upstream, stale entry is served
+	clock.Advance(2 * time.Hour)
+	failing = true
+	resp, body := mustGet(t, http.DefaultClient, ts.URL+"/a")
+	if body != "v2" || resp.Header.Get("Warning") == "" {
+		t.Fatalf("expected stale v2 with warning; got %q", body)
+	}
+
+	proxy.PurgeAllowed = func(r *http.Request) bool { return false }
+	if resp, _ := fetch(t, http.DefaultClient, req); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected purge to be forbidden; got %d", resp.StatusCode)
+	}
+}
+
+func TestReverseProxyPurgeVariants(t *testing.T) {
+	hits := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("v" + strconv.Itoa(hits)))
+	}))
+	defer upstream.Close()
+
+	target, _ := url.Parse(upstream.URL)
+	clock := newFakeClock()
+	proxy := naivehttpcache.NewReverseProxy(target, naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithAcceptEncoding(naivehttpcache.AcceptEncodingNormalize),
+		naivehttpcache.WithClock(clock),
+	)
+	ts := httptest.NewServer(proxy)
+	defer ts.Close()
+
+	get := func(method string) string {
+		t.Helper()
+		req, _ := http.NewRequest(method, ts.URL+"/a", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if method == naivehttpcache.MethodPurge {
+			// the variant of PURGE itself is not cached
+			req.Header.Set("Accept-Encoding", "br")
+		}
+		resp, body := fetch(t, http.DefaultClient, req)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200; got %d", resp.StatusCode)
+		}
+		return body
+	}
+
+	if body := get(http.MethodGet); body != "v1" {
+		t.Fatalf("unexpected body %q", body)
+	}
+	clock.Advance(time.Second)
+	get(naivehttpcache.MethodPurge)
+	clock.Advance(time.Second)
+	if body := get(http.MethodGet); body != "v2" {
+		t.Fatalf("expected the variant to be purged; got %q", body)
+	}
+	if body := get(http.MethodGet); body != "v2" {
+		t.Fatalf("expected the variant to be cached again; got %q", body)
+	}
+}
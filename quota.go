@@ -0,0 +1,180 @@
+package naivehttpcache
+
+import (
+	"container/list"
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HostQuotaCache is Cache that limits the summary size of keys and values
+// stored per host (see KeyURL) of Cache, evicting least recently used entries
+// of a host once it's over its quota, so a single origin can't evict
+// everything else from a shared bounded cache. Values larger than the quota
+// of their host are not stored at all.
+//
+// Only values written through HostQuotaCache are accounted, and they are
+// accounted until they are deleted or found missing (e.g. because they
+// expired or were evicted by Cache on its own).
+type HostQuotaCache struct {
+	Cache Cache
+	// MaxHostBytes, if positive, is the quota of hosts.
+	MaxHostBytes int64
+	// HostQuotas, if set, holds quotas of specific (lowercased) hosts instead of
+	// MaxHostBytes, non-positive ones mean no limit.
+	HostQuotas map[string]int64
+
+	mu    sync.Mutex
+	hosts map[string]*hostEntries
+}
+
+// hostEntries are entries of a host of HostQuotaCache.
+type hostEntries struct {
+	// lru holds keys, the most recently used ones are at the front.
+	lru   *list.List
+	items map[string]*list.Element
+	bytes int64
+}
+
+// hostEntry is an element of hostEntries.lru.
+type hostEntry struct {
+	key  string
+	size int64
+}
+
+// NewHostQuotaCache returns HostQuotaCache that stores up to maxHostBytes per
+// host in cache.
+func NewHostQuotaCache(cache Cache, maxHostBytes int64) *HostQuotaCache {
+	return &HostQuotaCache{Cache: cache, MaxHostBytes: maxHostBytes}
+}
+
+// HostBytes returns the number of bytes accounted to host.
+func (c *HostQuotaCache) HostBytes(host string) int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h, ok := c.hosts[strings.ToLower(host)]; ok {
+		return h.bytes
+	}
+	return 0
+}
+
+func (c *HostQuotaCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	val, ok, err := c.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	h, el := c.lookup(key)
+	switch {
+	case el == nil:
+	case ok:
+		h.lru.MoveToFront(el)
+	default:
+		h.remove(el)
+	}
+	return val, ok, nil
+}
+
+func (c *HostQuotaCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	host := keyHost(key)
+	quota := c.quota(host)
+	size := int64(len(key) + len(val))
+	if quota > 0 && size > quota {
+		return c.Delete(ctx, key)
+	}
+	if err := c.Cache.Set(ctx, key, val, ttl); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	if c.hosts == nil {
+		c.hosts = make(map[string]*hostEntries)
+	}
+	h, ok := c.hosts[host]
+	if !ok {
+		h = &hostEntries{lru: list.New(), items: make(map[string]*list.Element)}
+		c.hosts[host] = h
+	}
+	if el, ok := h.items[key]; ok {
+		h.remove(el)
+	}
+	h.items[key] = h.lru.PushFront(&hostEntry{key: key, size: size})
+	h.bytes += size
+	var evicted []string
+	for quota > 0 && h.bytes > quota {
+		el := h.lru.Back()
+		evicted = append(evicted, el.Value.(*hostEntry).key)
+		h.remove(el)
+	}
+	c.mu.Unlock()
+
+	for _, key := range evicted {
+		if err := c.Cache.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *HostQuotaCache) Delete(ctx context.Context, key string) error {
+	if err := c.Cache.Delete(ctx, key); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if h, el := c.lookup(key); el != nil {
+		h.remove(el)
+	}
+	return nil
+}
+
+// Walk calls fn with keys of the cache that start with prefix until it
+// returns false. Cache must implement Walker, otherwise ErrNotWalkable is
+// returned.
+func (c *HostQuotaCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	walker, ok := c.Cache.(Walker)
+	if !ok {
+		return ErrNotWalkable
+	}
+	return walker.Walk(ctx, prefix, fn)
+}
+
+// quota returns the quota of host, non-positive means no limit.
+func (c *HostQuotaCache) quota(host string) int64 {
+	if quota, ok := c.HostQuotas[host]; ok {
+		return quota
+	}
+	return c.MaxHostBytes
+}
+
+// lookup returns the entries of the host of key and the element of key in
+// them, if it's accounted. It must be called with mu held.
+func (c *HostQuotaCache) lookup(key string) (*hostEntries, *list.Element) {
+	h, ok := c.hosts[keyHost(key)]
+	if !ok {
+		return nil, nil
+	}
+	return h, h.items[key]
+}
+
+// remove stops accounting the entry of el.
+func (h *hostEntries) remove(el *list.Element) {
+	e := h.lru.Remove(el).(*hostEntry)
+	delete(h.items, e.key)
+	h.bytes -= e.size
+}
+
+// keyHost returns the lowercased host of the URL of key, empty if it has
+// none.
+func keyHost(key string) string {
+	u, err := url.Parse(KeyURL(key))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
@@ -0,0 +1,61 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestHostQuotaCache(t *testing.T) {
+	ctx := context.Background()
+	backend := naivehttpcache.NewMemoryCache(0, 0)
+	cache := naivehttpcache.NewHostQuotaCache(backend, 100)
+	cache.HostQuotas = map[string]int64{"big.example": 1000}
+
+	val := []byte(strings.Repeat("x", 20))
+	// each entry takes about 45 bytes, so 2 of them fit
+	for _, path := range []string{"/a", "/b", "/c"} {
+		if path == "/c" {
+			// /a is used, so /b is the least recently used one
+			cache.Get(ctx, "http://chatty.example/a")
+		}
+		if err := cache.Set(ctx, "http://chatty.example"+path, val, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		cache.Set(ctx, "http://big.example/"+strings.Repeat("x", i), val, 0)
+	}
+	cache.Set(ctx, "http://other.example/", val, 0)
+
+	for key, stored := range map[string]bool{
+		"http://chatty.example/a": true,
+		"http://chatty.example/b": false,
+		"http://chatty.example/c": true,
+		"http://big.example/":     true,
+		"http://other.example/":   true,
+	} {
+		if _, ok, _ := backend.Get(ctx, key); ok != stored {
+			t.Errorf("%s: expected stored to be %v", key, stored)
+		}
+	}
+	if n := cache.HostBytes("chatty.example"); n <= 0 || n > 100 {
+		t.Fatalf("expected chatty.example to be within its quota; got %d bytes", n)
+	}
+
+	if err := cache.Set(ctx, "http://other.example/large", make([]byte, 200), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := backend.Get(ctx, "http://other.example/large"); ok {
+		t.Fatal("expected values over the quota not to be stored")
+	}
+
+	// values that are gone are not accounted anymore
+	backend.Delete(ctx, "http://other.example/")
+	cache.Get(ctx, "http://other.example/")
+	if n := cache.HostBytes("other.example"); n != 0 {
+		t.Fatalf("expected missing values not to be accounted; got %d bytes", n)
+	}
+}
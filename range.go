@@ -0,0 +1,169 @@
+package naivehttpcache
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// errNoOverlap is returned by parseRange if none of the ranges overlap the
+// content.
+var errNoOverlap = errors.New("invalid range: failed to overlap")
+
+// byteRange is a range of content, the same as httpRange in net/http.
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange parses a Range header string as per RFC 7233.
+// errNoOverlap is returned if none of the ranges overlap.
+// It's stolen with minor modifications from net/http
+// https://github.com/golang/go/blob/go1.16/src/net/http/fs.go
+func parseRange(s string, size int64) ([]byteRange, error) {
+	if s == "" {
+		return nil, nil // header not present
+	}
+	const b = "bytes="
+	if !strings.HasPrefix(s, b) {
+		return nil, errors.New("invalid range")
+	}
+	var ranges []byteRange
+	noOverlap := false
+	for _, ra := range strings.Split(s[len(b):], ",") {
+		ra = textproto.TrimString(ra)
+		if ra == "" {
+			continue
+		}
+		i := strings.Index(ra, "-")
+		if i < 0 {
+			return nil, errors.New("invalid range")
+		}
+		start, end := textproto.TrimString(ra[:i]), textproto.TrimString(ra[i+1:])
+		var r byteRange
+		if start == "" {
+			// If no start is specified, end specifies the
+			// range start relative to the end of the file,
+			// and we are dealing with <suffix-length>
+			// which has to be a non-negative integer as per
+			// RFC 7233 Section 2.1 "Byte-Ranges".
+			if end == "" || end[0] == '-' {
+				return nil, errors.New("invalid range")
+			}
+			i, err := strconv.ParseInt(end, 10, 64)
+			if i < 0 || err != nil {
+				return nil, errors.New("invalid range")
+			}
+			if i > size {
+				i = size
+			}
+			if i == 0 {
+				// nothing of the content, e.g. of an empty one, is in
+				// the range
+				noOverlap = true
+				continue
+			}
+			r.start = size - i
+			r.length = size - r.start
+		} else {
+			i, err := strconv.ParseInt(start, 10, 64)
+			if err != nil || i < 0 {
+				return nil, errors.New("invalid range")
+			}
+			if i >= size {
+				// If the range begins after the size of the content,
+				// then it does not overlap.
+				noOverlap = true
+				continue
+			}
+			r.start = i
+			if end == "" {
+				// If no end is specified, range extends to end of the file.
+				r.length = size - r.start
+			} else {
+				i, err := strconv.ParseInt(end, 10, 64)
+				if err != nil || r.start > i {
+					return nil, errors.New("invalid range")
+				}
+				if i >= size {
+					i = size - 1
+				}
+				r.length = i - r.start + 1
+			}
+		}
+		ranges = append(ranges, r)
+	}
+	if noOverlap && len(ranges) == 0 {
+		// The specified ranges did not overlap with the content.
+		return nil, errNoOverlap
+	}
+	return ranges, nil
+}
+
+// ifRangeMatches reports whether If-Range precondition of req (if any) holds
+// for response with header, i.e. whether the range may be served.
+func ifRangeMatches(req *http.Request, header http.Header) bool {
+	ifRange := req.Header.Get("if-range")
+	if ifRange == "" {
+		return true
+	}
+	// only strong validators are allowed in If-Range
+	if strings.HasPrefix(ifRange, `"`) {
+		etag := header.Get("etag")
+		return etag != "" && etag == ifRange
+	}
+	lastModified := header.Get("last-modified")
+	return lastModified != "" && lastModified == ifRange
+}
+
+// rangeResponse returns response to range request req built out of full
+// cached response resp, consuming its body.
+// False means that the range can't be served out of resp and req has to go to
+// the server.
+func rangeResponse(req *http.Request, resp *http.Response) (*http.Response, bool, error) {
+	body, err := readBody(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	size := int64(len(body))
+
+	if !ifRangeMatches(req, resp.Header) {
+		// If-Range didn't match, whole representation has to be sent
+		resp.Body = newCachedBody(body)
+		return resp, true, nil
+	}
+
+	ranges, err := parseRange(req.Header.Get("range"), size)
+	switch {
+	case err == errNoOverlap:
+		partial := *resp
+		partial.StatusCode = http.StatusRequestedRangeNotSatisfiable
+		partial.Status = "416 " + http.StatusText(partial.StatusCode)
+		partial.Header = resp.Header.Clone()
+		partial.Header.Set("content-range", fmt.Sprintf("bytes */%d", size))
+		partial.Header.Del("content-length")
+		partial.ContentLength = 0
+		partial.Body = http.NoBody
+		return &partial, true, nil
+	case err != nil || len(ranges) != 1:
+		// multipart/byteranges responses are left for the server
+		return nil, false, nil
+	}
+
+	r := ranges[0]
+	partial := *resp
+	partial.StatusCode = http.StatusPartialContent
+	partial.Status = "206 " + http.StatusText(partial.StatusCode)
+	partial.Header = resp.Header.Clone()
+	partial.Header.Set("content-range", r.contentRange(size))
+	partial.Header.Set("content-length", strconv.FormatInt(r.length, 10))
+	partial.ContentLength = r.length
+	partial.Body = newCachedBody(body[r.start : r.start+r.length])
+	return &partial, true, nil
+}
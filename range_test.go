@@ -0,0 +1,95 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+const rangeContent = "0123456789"
+
+func TestRange(t *testing.T) {
+	tsHits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsHits++
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader([]byte(rangeContent)))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache())),
+	}
+
+	get := func(rng string) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+		if rng != "" {
+			req.Header.Set("Range", rng)
+		}
+		return fetch(t, httpClient, req)
+	}
+
+	// without a full entry range requests go to the server and 206 is not
+	// stored
+	if resp, body := get("bytes=0-1"); resp.StatusCode != http.StatusPartialContent || body != "01" {
+		t.Fatalf("expected 206 with 01; got %d with %q", resp.StatusCode, body)
+	}
+	if resp, body := get(""); resp.Header.Get(naivehttpcache.XFromCache) != "" || body != rangeContent {
+		t.Fatalf("expected partial response to not be cached; got %q", body)
+	}
+	if tsHits != 2 {
+		t.Fatalf("expected 2 server hits; got %d", tsHits)
+	}
+
+	tests := []struct {
+		rng       string
+		status    int
+		body      string
+		fromCache bool
+	}{
+		{"bytes=2-4", http.StatusPartialContent, "234", true},
+		{"bytes=-3", http.StatusPartialContent, "789", true},
+		{"bytes=-0", http.StatusRequestedRangeNotSatisfiable, "", true},
+		{"bytes=8-", http.StatusPartialContent, "89", true},
+		{"bytes=20-", http.StatusRequestedRangeNotSatisfiable, "", true},
+		// multiple ranges are left for the server
+		{"bytes=0-1,3-4", http.StatusPartialContent, "", false},
+	}
+	for _, tt := range tests {
+		resp, body := get(tt.rng)
+		if resp.StatusCode != tt.status {
+			t.Fatalf("%s: expected status %d; got %d", tt.rng, tt.status, resp.StatusCode)
+		}
+		if fromCache := resp.Header.Get(naivehttpcache.XFromCache) == "1"; fromCache != tt.fromCache {
+			t.Fatalf("%s: expected from cache %t; got %t", tt.rng, tt.fromCache, fromCache)
+		}
+		if tt.fromCache && body != tt.body {
+			t.Fatalf("%s: expected body %q; got %q", tt.rng, tt.body, body)
+		}
+	}
+}
+
+func TestRangeEmpty(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache())),
+	}
+	mustGet(t, httpClient, ts.URL)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL, nil)
+	req.Header.Set("Range", "bytes=-3")
+	resp, _ := fetch(t, httpClient, req)
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable || resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatalf("expected cached 416; got %d", resp.StatusCode)
+	}
+	if v := resp.Header.Get("content-range"); v != "bytes */0" {
+		t.Fatalf("expected content range of bytes */0; got %q", v)
+	}
+}
@@ -0,0 +1,149 @@
+package naivehttpcache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the rate of requests to hosts, see Transport.RateLimiter.
+type RateLimiter interface {
+	// Wait blocks until a request to host may be sent. The error (e.g. of
+	// ctx) fails the request.
+	Wait(ctx context.Context, host string) error
+}
+
+// WithRateLimiter makes Transport limit the rate of requests to the server
+// with limiter, see Transport.RateLimiter.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(o *Options) {
+		o.RateLimiter = limiter
+	}
+}
+
+// waitOrigin waits for RateLimiter to allow req to be sent to the server.
+func (t *Transport) waitOrigin(req *http.Request) error {
+	if t.RateLimiter == nil {
+		return nil
+	}
+	return t.RateLimiter.Wait(req.Context(), req.URL.Host)
+}
+
+// minBucketsPrune is the number of buckets of HostRateLimiter from which idle
+// ones are pruned.
+const minBucketsPrune = 64
+
+var errInvalidRateLimit = errors.New("naivehttpcache: rate limit must be positive with burst of at least 1")
+
+// HostRateLimiter is a RateLimiter with a token bucket per host: it refills
+// with Rate tokens a second up to Burst, and every request takes one. Rate
+// must be positive and Burst at least 1, otherwise Wait fails. Buckets that
+// refilled are forgotten, so idle hosts don't take memory.
+type HostRateLimiter struct {
+	Rate  float64
+	Burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// pruneAt is the number of buckets at which idle ones are pruned next.
+	pruneAt int
+}
+
+type tokenBucket struct {
+	// tokens are negative when the future ones are already reserved.
+	tokens float64
+	at     time.Time
+}
+
+// NewHostRateLimiter returns HostRateLimiter allowing rate requests a second
+// to every host, with bursts of up to burst requests. It panics unless rate is
+// positive and burst is at least 1.
+func NewHostRateLimiter(rate float64, burst int) *HostRateLimiter {
+	if !(rate > 0) || burst < 1 {
+		panic(errInvalidRateLimit)
+	}
+	return &HostRateLimiter{Rate: rate, Burst: burst}
+}
+
+// Len returns the number of hosts which buckets are tracked.
+func (l *HostRateLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func (l *HostRateLimiter) Wait(ctx context.Context, host string) error {
+	if !(l.Rate > 0) || l.Burst < 1 {
+		return errInvalidRateLimit
+	}
+	wait := l.reserve(host, time.Now())
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		// buckets with reserved tokens are never full, so never pruned
+		l.buckets[host].tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token of host and returns how long to wait until it's
+// actually there.
+func (l *HostRateLimiter) reserve(host string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = map[string]*tokenBucket{}
+	}
+	b, ok := l.buckets[host]
+	if !ok {
+		if len(l.buckets) >= l.pruneAt {
+			l.prune(now)
+		}
+		b = &tokenBucket{tokens: float64(l.Burst), at: now}
+		l.buckets[host] = b
+	}
+
+	l.refill(b, now)
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.Rate * float64(time.Second))
+}
+
+// refill adds tokens of b up to now.
+func (l *HostRateLimiter) refill(b *tokenBucket, now time.Time) {
+	b.tokens += now.Sub(b.at).Seconds() * l.Rate
+	if b.tokens > float64(l.Burst) {
+		b.tokens = float64(l.Burst)
+	}
+	b.at = now
+}
+
+// prune forgets buckets that refilled up to Burst by now, they are no
+// different from new ones. Buckets are pruned once their number doubles, so
+// the cost of pruning is spread over requests.
+func (l *HostRateLimiter) prune(now time.Time) {
+	for host, b := range l.buckets {
+		if l.refill(b, now); b.tokens >= float64(l.Burst) {
+			delete(l.buckets, host)
+		}
+	}
+	l.pruneAt = 2 * len(l.buckets)
+	if l.pruneAt < minBucketsPrune {
+		l.pruneAt = minBucketsPrune
+	}
+}
@@ -0,0 +1,99 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+// countingLimiter is naivehttpcache.RateLimiter counting waits by host.
+type countingLimiter struct {
+	waits map[string]int
+	err   error
+}
+
+func (l *countingLimiter) Wait(ctx context.Context, host string) error {
+	l.waits[host]++
+	return l.err
+}
+
+func TestRateLimiter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	limiter := &countingLimiter{waits: map[string]int{}}
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithRateLimiter(limiter),
+		),
+	}
+
+	host := ts.Listener.Addr().String()
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	if limiter.waits[host] != 1 {
+		t.Fatalf("expected only the miss to be limited; got %v", limiter.waits)
+	}
+
+	limiter.err = errors.New("slow down")
+	if _, err := client.Get(ts.URL + "/other"); !errors.Is(err, limiter.err) {
+		t.Fatalf("expected the error of limiter; got %v", err)
+	}
+}
+
+func TestHostRateLimiter(t *testing.T) {
+	limiter := naivehttpcache.NewHostRateLimiter(0.001, 1)
+	ctx := context.Background()
+	if err := limiter.Wait(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Wait(ctx, "b"); err != nil {
+		t.Fatalf("expected hosts to have their own buckets; got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "a"); err != context.DeadlineExceeded {
+		t.Fatalf("expected to wait for the next token; got %v", err)
+	}
+}
+
+func TestHostRateLimiterPrune(t *testing.T) {
+	limiter := naivehttpcache.NewHostRateLimiter(1000, 1)
+	ctx := context.Background()
+	for i := 0; i < 1000; i++ {
+		if i%100 == 0 {
+			// buckets refill meanwhile
+			time.Sleep(10 * time.Millisecond)
+		}
+		if err := limiter.Wait(ctx, strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := limiter.Len(); n >= 1000 {
+		t.Fatalf("expected buckets of idle hosts to be pruned; got %d", n)
+	}
+}
+
+func TestHostRateLimiterInvalid(t *testing.T) {
+	limiter := &naivehttpcache.HostRateLimiter{Burst: 1}
+	if err := limiter.Wait(context.Background(), "a"); err == nil {
+		t.Fatal("expected zero rate to fail")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected zero burst to panic")
+		}
+	}()
+	naivehttpcache.NewHostRateLimiter(1, 0)
+}
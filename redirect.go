@@ -0,0 +1,49 @@
+package naivehttpcache
+
+import (
+	"net/http"
+	"time"
+)
+
+// RedirectPolicy states for how long redirect responses stay fresh. Zero value
+// keeps them fresh as any other response.
+type RedirectPolicy struct {
+	// Permanent makes 301 (Moved Permanently) and 308 (Permanent Redirect)
+	// responses stay fresh for PermanentMaxAge, or forever if it's zero.
+	Permanent       bool
+	PermanentMaxAge time.Duration
+	// TemporaryMaxAge, if positive, makes 302 (Found) and 307 (Temporary
+	// Redirect) responses stay fresh for that long.
+	TemporaryMaxAge time.Duration
+}
+
+// DefaultRedirectPolicy keeps permanent redirects fresh forever and temporary
+// ones for a minute. Other redirects (e.g. 303) are fresh as other responses.
+var DefaultRedirectPolicy = RedirectPolicy{
+	Permanent:       true,
+	TemporaryMaxAge: time.Minute,
+}
+
+// WithRedirectPolicy sets for how long redirect responses stay fresh, see
+// RedirectPolicy.
+func WithRedirectPolicy(policy RedirectPolicy) Option {
+	return func(o *Options) {
+		o.Redirects = policy
+	}
+}
+
+// lifetime is Transport.lifetime of redirect response with status, if the
+// policy sets it. The last result is false for other responses.
+func (p RedirectPolicy) lifetime(status int) (lifetime time.Duration, expires bool, ok bool) {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		if p.Permanent {
+			return p.PermanentMaxAge, p.PermanentMaxAge > 0, true
+		}
+	case http.StatusFound, http.StatusTemporaryRedirect:
+		if p.TemporaryMaxAge > 0 {
+			return p.TemporaryMaxAge, true, true
+		}
+	}
+	return 0, false, false
+}
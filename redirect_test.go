@@ -0,0 +1,64 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/301":
+			http.Redirect(w, r, "/target", http.StatusMovedPermanently)
+		case "/302":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		case "/303":
+			http.Redirect(w, r, "/target", http.StatusSeeOther)
+		}
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithRedirectPolicy(naivehttpcache.DefaultRedirectPolicy),
+			naivehttpcache.WithMaxAge(time.Second),
+			naivehttpcache.WithClock(clock),
+		),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	get := func(path string, expectedFromCache bool) {
+		t.Helper()
+		resp, _ := mustGet(t, client, ts.URL+path)
+		if fromCache := resp.Header.Get(naivehttpcache.XFromCache) == "1"; fromCache != expectedFromCache {
+			t.Fatalf("%s: expected from cache to be %v", path, expectedFromCache)
+		}
+		if resp.Header.Get("location") != "/target" {
+			t.Fatalf("%s: expected redirect to /target; got %q", path, resp.Header.Get("location"))
+		}
+	}
+
+	for _, path := range []string{"/301", "/302", "/303"} {
+		get(path, false)
+	}
+	// the policy overrides MaxAge
+	clock.Advance(30 * time.Second)
+	get("/301", true)
+	get("/302", true)
+	get("/303", false)
+
+	clock.Advance(time.Hour)
+	get("/301", true)
+	get("/302", false)
+}
@@ -0,0 +1,149 @@
+package naivehttpcache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ReplicatedCache is Cache that writes values to all of Caches and reads them
+// from whichever of them returns first, tolerating failures of all of them
+// but one, e.g. to keep a warm local cache in front of a durable shared one.
+//
+// Set succeeds if any of Caches stored the value; the value is deleted from
+// those that failed to store it, as far as they allow, so they don't keep
+// serving the previous one. Get returns the first hit, or a miss once all of
+// Caches missed or failed, with an error only if all of them failed. Delete
+// deletes from all of Caches and fails if any of them does.
+type ReplicatedCache struct {
+	Caches []Cache
+}
+
+// NewReplicatedCache returns ReplicatedCache that replicates values to caches.
+func NewReplicatedCache(caches ...Cache) *ReplicatedCache {
+	return &ReplicatedCache{Caches: caches}
+}
+
+// cacheResult is a result of Cache.Get.
+type cacheResult struct {
+	val []byte
+	ok  bool
+	err error
+}
+
+func (c *ReplicatedCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	// replicas that are still reading are not waited for once there is a hit
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan cacheResult, len(c.Caches))
+	for _, cache := range c.Caches {
+		cache := cache
+		go func() {
+			val, ok, err := cache.Get(ctx, key)
+			results <- cacheResult{val: val, ok: ok, err: err}
+		}()
+	}
+
+	var miss bool
+	var firstErr error
+	for range c.Caches {
+		r := <-results
+		switch {
+		case r.err != nil:
+			if firstErr == nil {
+				firstErr = r.err
+			}
+		case r.ok:
+			return r.val, true, nil
+		default:
+			miss = true
+		}
+	}
+	if miss {
+		return nil, false, nil
+	}
+	return nil, false, firstErr
+}
+
+func (c *ReplicatedCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	errs := c.each(func(cache Cache) error {
+		err := cache.Set(ctx, key, val, ttl)
+		if err != nil {
+			cache.Delete(ctx, key)
+		}
+		return err
+	})
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	return firstError(errs)
+}
+
+func (c *ReplicatedCache) Delete(ctx context.Context, key string) error {
+	return firstError(c.each(func(cache Cache) error {
+		return cache.Delete(ctx, key)
+	}))
+}
+
+// Walk calls fn with keys of the cache that start with prefix until it
+// returns false, walking all of Caches that implement Walker. If none of them
+// does, ErrNotWalkable is returned.
+func (c *ReplicatedCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	walked := false
+	seen := make(map[string]bool)
+	stopped := false
+	for _, cache := range c.Caches {
+		walker, ok := cache.(Walker)
+		if !ok {
+			continue
+		}
+		walked = true
+		err := walker.Walk(ctx, prefix, func(key string) bool {
+			if seen[key] {
+				return true
+			}
+			seen[key] = true
+			stopped = !fn(key)
+			return !stopped
+		})
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+	if !walked {
+		return ErrNotWalkable
+	}
+	return nil
+}
+
+// each calls fn with each of Caches concurrently and returns their errors.
+func (c *ReplicatedCache) each(fn func(cache Cache) error) []error {
+	errs := make([]error, len(c.Caches))
+	var wg sync.WaitGroup
+	for i, cache := range c.Caches {
+		i, cache := i, cache
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = fn(cache)
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// firstError returns the first of errs that is not nil.
+func firstError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+// laggingCache is Cache that is slow to read.
+type laggingCache struct {
+	naivehttpcache.Cache
+}
+
+func (c laggingCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	select {
+	case <-time.After(200 * time.Millisecond):
+		return c.Cache.Get(ctx, key)
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+func TestReplicatedCache(t *testing.T) {
+	ctx := context.Background()
+	local := naivehttpcache.NewMemoryCache(0, 0)
+	shared := newFailingCache()
+	shared.failing = false
+	cache := naivehttpcache.NewReplicatedCache(local, laggingCache{shared})
+
+	if err := cache.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := shared.Get(ctx, "a"); !ok {
+		t.Fatal("expected the value to be written to all replicas")
+	}
+	start := time.Now()
+	if val, ok, err := cache.Get(ctx, "a"); err != nil || !ok || string(val) != "1" {
+		t.Fatalf("expected a hit; got %q, %v, %v", val, ok, err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Fatalf("expected the value to be read from the fastest replica; took %v", d)
+	}
+
+	// a failing replica is tolerated
+	shared.failing = true
+	if err := cache.Set(ctx, "b", []byte("2"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := cache.Get(ctx, "b"); err != nil || !ok {
+		t.Fatalf("expected a hit; got %v, %v", ok, err)
+	}
+	if _, ok, err := cache.Get(ctx, "c"); err != nil || ok {
+		t.Fatalf("expected a miss; got %v, %v", ok, err)
+	}
+	if err := cache.Delete(ctx, "b"); !errors.Is(err, errBackend) {
+		t.Fatalf("expected failed deletes to fail; got %v", err)
+	}
+
+	// unless all of them fail
+	cache = naivehttpcache.NewReplicatedCache(shared, shared)
+	if err := cache.Set(ctx, "d", []byte("4"), 0); !errors.Is(err, errBackend) {
+		t.Fatalf("expected the write to fail; got %v", err)
+	}
+	if _, _, err := cache.Get(ctx, "d"); !errors.Is(err, errBackend) {
+		t.Fatalf("expected the read to fail; got %v", err)
+	}
+}
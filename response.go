@@ -0,0 +1,63 @@
+package naivehttpcache
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// ResponseInfo tells how a response was served by Transport.
+type ResponseInfo struct {
+	Outcome Outcome
+	// Key is the cache key of the request, empty for OutcomeBypass.
+	Key string
+	// StoredAt is the date of the cached entry, ExpiresAt is when it stops
+	// being fresh. They are only set for responses served from the cache, and
+	// ExpiresAt also only if it's known (see EntryInfo.Expires).
+	StoredAt  time.Time
+	ExpiresAt time.Time
+}
+
+// responseInfoKey is the context key of ResponseInfo.
+type responseInfoKey struct{}
+
+// FromResponse returns ResponseInfo of resp returned by Transport. Unlike
+// XFromCache header, it survives middlewares that strip headers. False is
+// returned if resp (or rather resp.Request) didn't come from Transport.
+func FromResponse(resp *http.Response) (ResponseInfo, bool) {
+	if resp.Request == nil {
+		return ResponseInfo{}, false
+	}
+	info, ok := resp.Request.Context().Value(responseInfoKey{}).(ResponseInfo)
+	return info, ok
+}
+
+// withStoredAt returns req with StoredAt and ExpiresAt of ResponseInfo of
+// cachedResp to it, which was stored at storedAt. The rest is filled in by
+// withInfo.
+func (t *Transport) withStoredAt(req *http.Request, cachedResp *http.Response, storedAt time.Time) *http.Request {
+	info := ResponseInfo{StoredAt: storedAt}
+	if !storedAt.IsZero() && t.Freshness == nil {
+		if lifetime, ok := t.lifetime(t.meta(cachedResp.StatusCode, cachedResp.Header, storedAt)); ok {
+			info.ExpiresAt = storedAt.Add(lifetime)
+		}
+	}
+	return req.WithContext(context.WithValue(req.Context(), responseInfoKey{}, info))
+}
+
+// withInfo attaches ResponseInfo to resp to req, through the context of
+// resp.Request.
+func (t *Transport) withInfo(req *http.Request, resp *http.Response, key string, outcome Outcome) *http.Response {
+	info := ResponseInfo{Outcome: outcome, Key: key}
+	if outcome != OutcomeMiss && outcome != OutcomeBypass && resp.Request != nil {
+		if served, ok := resp.Request.Context().Value(responseInfoKey{}).(ResponseInfo); ok {
+			info.StoredAt, info.ExpiresAt = served.StoredAt, served.ExpiresAt
+		}
+	}
+
+	if resp.Request == nil {
+		resp.Request = req
+	}
+	resp.Request = resp.Request.WithContext(context.WithValue(resp.Request.Context(), responseInfoKey{}, info))
+	return resp
+}
@@ -0,0 +1,61 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestFromResponse(t *testing.T) {
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	resp, _ := mustGet(t, client, ts.URL)
+	info, ok := naivehttpcache.FromResponse(resp)
+	if !ok || info.Outcome != naivehttpcache.OutcomeMiss || info.Key != ts.URL || !info.StoredAt.IsZero() {
+		t.Fatalf("expected miss of %s; got %+v", ts.URL, info)
+	}
+
+	clock.Advance(time.Second)
+	resp, _ = mustGet(t, client, ts.URL)
+	resp.Header.Del(naivehttpcache.XFromCache)
+	info, ok = naivehttpcache.FromResponse(resp)
+	if !ok || info.Outcome != naivehttpcache.OutcomeHit {
+		t.Fatalf("expected hit; got %+v", info)
+	}
+	if age := clock.Now().Sub(info.StoredAt); age < time.Second || age > 2*time.Second {
+		t.Fatalf("expected entry stored a second ago; got %v", info.StoredAt)
+	}
+	if lifetime := info.ExpiresAt.Sub(info.StoredAt); lifetime != time.Minute {
+		t.Fatalf("expected entry to expire in a minute; got %v", lifetime)
+	}
+	if v := resp.Header.Get(naivehttpcache.XCachedAt); v != info.StoredAt.UTC().Format(http.TimeFormat) {
+		t.Fatalf("expected %s header to tell when the entry was stored; got %q", naivehttpcache.XCachedAt, v)
+	}
+	if v := resp.Header.Get("date"); v != "" {
+		t.Fatalf("expected headers of the server to be preserved; got Date %q", v)
+	}
+
+	resp, err := http.Post(ts.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if _, ok := naivehttpcache.FromResponse(resp); ok {
+		t.Fatal("expected no info for responses from other transports")
+	}
+}
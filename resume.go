@@ -0,0 +1,111 @@
+package naivehttpcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WithResumeFills makes Transport resume interrupted downloads of responses
+// with Range requests, see Transport.ResumeFills.
+func WithResumeFills() Option {
+	return func(o *Options) {
+		o.ResumeFills = true
+	}
+}
+
+// ifRangeValidator returns the validator of response with header that can be
+// used in If-Range, empty if there's none.
+func ifRangeValidator(header http.Header) string {
+	// only strong validators are allowed in If-Range
+	if etag := header.Get("etag"); strings.HasPrefix(etag, `"`) {
+		return etag
+	}
+	return header.Get("last-modified")
+}
+
+// resumable reports whether reading of 200 resp may be resumed with a Range
+// request, once it's interrupted.
+func (t *Transport) resumable(resp *http.Response) bool {
+	return t.ResumeFills && t.PartialContent && resp.StatusCode == http.StatusOK && resp.ContentLength > 0 &&
+		resp.Header.Get("accept-ranges") == "bytes" && ifRangeValidator(resp.Header) != ""
+}
+
+// resumeRequest returns outreq asking for the rest of the response, if a start
+// of it was stored by an interrupted download, and the start. Otherwise outreq
+// is returned as is.
+func (t *Transport) resumeRequest(outreq *http.Request, reqCC cacheControl, cacheKey string) (*http.Request, []byte, error) {
+	key := partialKey(cacheKey)
+	val, ok, err := t.lookup(outreq, reqCC, key)
+	if err != nil || !ok {
+		return outreq, nil, err
+	}
+	entry, err := decodePartialEntry(val)
+	if err != nil {
+		return outreq, nil, t.corrupt(outreq.Context(), key, err)
+	}
+	if len(entry.Chunks) == 0 || entry.Chunks[0].Start != 0 {
+		return outreq, nil, nil
+	}
+	validator := ifRangeValidator(entry.Header)
+	if validator == "" {
+		return outreq, nil, nil
+	}
+
+	prefix := entry.Chunks[0].Data
+	resumereq := outreq.Clone(outreq.Context())
+	resumereq.Header.Set("range", "bytes="+strconv.Itoa(len(prefix))+"-")
+	resumereq.Header.Set("if-range", validator)
+	return resumereq, prefix, nil
+}
+
+// resumed returns response to resumed request, which continues prefix, as a
+// full one. False means that the server didn't continue it (e.g. because the
+// response has changed), in which case the body of resp is closed unless it's
+// a full response, which is returned as is.
+func resumed(resp *http.Response, prefix []byte) (*http.Response, bool) {
+	if resp.StatusCode == http.StatusOK {
+		return resp, true
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, false
+	}
+	start, _, size, ok := parseContentRange(resp.Header.Get("content-range"))
+	if !ok || start != int64(len(prefix)) {
+		resp.Body.Close()
+		return nil, false
+	}
+
+	full := *resp
+	full.Status = "200 " + http.StatusText(http.StatusOK)
+	full.StatusCode = http.StatusOK
+	full.Header = resp.Header.Clone()
+	full.Header.Del("content-range")
+	full.Header.Set("content-length", strconv.FormatInt(size, 10))
+	full.ContentLength = size
+	full.Body = &readCloser{
+		Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body),
+		Closer: resp.Body,
+	}
+	return &full, true
+}
+
+// storePrefix stores body, the start of 200 resp that was interrupted, as a
+// range of it, so reading of it can be resumed later. The download is usually
+// interrupted by canceling the request, so ctx must not be the one of it, see
+// storeContext.
+func (t *Transport) storePrefix(ctx context.Context, cacheKey string, resp *http.Response, body *bytes.Reader) error {
+	n := body.Len()
+	if n == 0 {
+		return nil
+	}
+	r := *resp
+	r.StatusCode = http.StatusPartialContent
+	r.Header = resp.Header.Clone()
+	r.Header.Set("content-range", "bytes 0-"+strconv.Itoa(n-1)+"/"+strconv.FormatInt(resp.ContentLength, 10))
+	return t.storePartial(ctx, cacheKey, &r, body)
+}
@@ -0,0 +1,83 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestResumeFills(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	var ranges []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("range"))
+		w.Header().Set("etag", `"v1"`)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithPartialContent(),
+			naivehttpcache.WithResumeFills(),
+		),
+	}
+
+	resp, err := httpClient.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(resp.Body, make([]byte, 30000)); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, body := mustGet(t, httpClient, ts.URL)
+	if resp.StatusCode != http.StatusOK || body != string(content) {
+		t.Fatalf("expected the whole content; got %d with %d bytes", resp.StatusCode, len(body))
+	}
+	if len(ranges) != 2 || ranges[1] != "bytes=30000-" {
+		t.Fatalf("expected the download to be resumed; got ranges %q", ranges)
+	}
+
+	if resp, body := mustGet(t, httpClient, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != string(content) {
+		t.Fatal("expected resumed download to be cached")
+	}
+}
+
+func TestResumeFillsChangedContent(t *testing.T) {
+	etag := `"v1"`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("etag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(bytes.Repeat([]byte(etag), 10000)))
+	}))
+	defer ts.Close()
+
+	httpClient := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithPartialContent(),
+			naivehttpcache.WithResumeFills(),
+		),
+	}
+
+	resp, err := httpClient.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadFull(resp.Body, make([]byte, 100))
+	resp.Body.Close()
+
+	etag = `"v2"`
+	resp, body := mustGet(t, httpClient, ts.URL)
+	if resp.StatusCode != http.StatusOK || body != string(bytes.Repeat([]byte(etag), 10000)) {
+		t.Fatalf("expected the whole new content; got %d with %d bytes", resp.StatusCode, len(body))
+	}
+}
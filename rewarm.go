@@ -0,0 +1,171 @@
+package naivehttpcache
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRewarmAhead is the default Transport.RewarmAhead.
+const DefaultRewarmAhead = 10 * time.Second
+
+// minRewarmInterval is the minimum interval of rounds of re-warming, whatever
+// RewarmAhead is.
+const minRewarmInterval = 100 * time.Millisecond
+
+// maxHotKeysFactor bounds the number of keys tracked for HotKeys to that many
+// times HotKeys.
+const maxHotKeysFactor = 64
+
+// WithHotKeys makes Transport refresh the top most requested keys ahead of
+// their expiration, see Transport.HotKeys.
+func WithHotKeys(top int, ahead time.Duration) Option {
+	return func(o *Options) {
+		o.HotKeys = top
+		o.RewarmAhead = ahead
+	}
+}
+
+// hotKeys tracks requested keys for HotKeys.
+type hotKeys struct {
+	mu   sync.Mutex
+	keys map[string]*hotKey
+	// stop stops the loop of rounds, once it's started.
+	stop   chan struct{}
+	closed bool
+}
+
+// hotKey is a key tracked by hotKeys.
+type hotKey struct {
+	// req is the request that the key is refreshed with. Its context only
+	// carries values that Partition may need for the key.
+	req  *http.Request
+	hits uint64
+}
+
+// rewarmAheadKey is the context key of RewarmAhead of requests that re-warm
+// keys.
+type rewarmAheadKey struct{}
+
+// RewarmHotKeys runs a round of re-warming of HotKeys now: the most requested
+// keys that expire within RewarmAhead are refreshed, one at a time, and counts
+// of requests of keys halve. Rounds run in the background anyway, this is for
+// running them on a schedule of one's own.
+func (t *Transport) RewarmHotKeys() {
+	h := &t.hotKeys
+	h.mu.Lock()
+	keys := make([]*hotKey, 0, len(h.keys))
+	for _, k := range h.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].hits > keys[j].hits
+	})
+	if len(keys) > t.HotKeys {
+		keys = keys[:t.HotKeys]
+	}
+	reqs := make([]*http.Request, len(keys))
+	for i, k := range keys {
+		reqs[i] = k.req
+	}
+	for key, k := range h.keys {
+		if k.hits >>= 1; k.hits == 0 {
+			delete(h.keys, key)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, req := range reqs {
+		ctx, cancel := t.storeContext(context.WithValue(req.Context(), rewarmAheadKey{}, t.rewarmAhead()))
+		t.fetchBackground(req.WithContext(ctx))
+		cancel()
+	}
+}
+
+// trackHotKey counts a request of key by req, and starts the loop of rounds
+// of re-warming if it's not running yet.
+func (t *Transport) trackHotKey(req *http.Request, key string) {
+	if inBackground(req.Context()) {
+		return
+	}
+
+	h := &t.hotKeys
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	if k, ok := h.keys[key]; ok {
+		k.hits++
+		return
+	}
+	if len(h.keys) >= maxHotKeysFactor*t.HotKeys {
+		return
+	}
+	// values of the context may be anything kept alive by the caller, and
+	// the key may be tracked for long, so they are only kept for Partition
+	ctx := context.Background()
+	if t.Partition != nil {
+		ctx = detachedContext{req.Context()}
+	}
+	hreq, err := backgroundRequest(ctx, req, req.URL.String())
+	if err != nil {
+		return
+	}
+	if h.keys == nil {
+		h.keys = make(map[string]*hotKey)
+	}
+	h.keys[key] = &hotKey{req: hreq, hits: 1}
+
+	if h.stop == nil {
+		stop := make(chan struct{})
+		h.stop = stop
+		t.goBackground(func() { t.rewarmLoop(stop) })
+	}
+}
+
+// rewarmLoop runs rounds of re-warming every RewarmAhead/2 (but no more often
+// than minRewarmInterval) until stop is closed.
+func (t *Transport) rewarmLoop(stop chan struct{}) {
+	interval := t.rewarmAhead() / 2
+	if interval < minRewarmInterval {
+		interval = minRewarmInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.RewarmHotKeys()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// stopRewarm stops the loop of rounds of re-warming for good.
+func (t *Transport) stopRewarm() {
+	h := &t.hotKeys
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.closed && h.stop != nil {
+		close(h.stop)
+	}
+	h.closed = true
+}
+
+// rewarming returns for how long ahead of its expiration the entry of req is
+// treated as expired, if req re-warms it.
+func rewarming(req *http.Request) (time.Duration, bool) {
+	ahead, ok := req.Context().Value(rewarmAheadKey{}).(time.Duration)
+	return ahead, ok
+}
+
+func (t *Transport) rewarmAhead() time.Duration {
+	if t.RewarmAhead > 0 {
+		return t.RewarmAhead
+	}
+	return DefaultRewarmAhead
+}
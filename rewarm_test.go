@@ -0,0 +1,87 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestHotKeys(t *testing.T) {
+	clock := newFakeClock()
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Date", clock.Now().UTC().Format(http.TimeFormat))
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithClock(clock),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithHotKeys(1, 10*time.Second),
+	)
+	defer transport.Close(context.Background())
+	client := &http.Client{Transport: transport}
+	for i := 0; i < 3; i++ {
+		mustGet(t, client, ts.URL+"/hot")
+	}
+	mustGet(t, client, ts.URL+"/cold")
+
+	// nothing is about to expire yet
+	transport.RewarmHotKeys()
+	clock.Advance(55 * time.Second)
+	transport.RewarmHotKeys()
+	clock.Advance(10 * time.Second)
+
+	if resp, _ := mustGet(t, client, ts.URL+"/hot"); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+		t.Fatal("expected the hot key to be kept fresh")
+	}
+	if resp, _ := mustGet(t, client, ts.URL+"/cold"); resp.Header.Get(naivehttpcache.XFromCache) == "1" {
+		t.Fatal("expected the cold key to expire")
+	}
+	mu.Lock()
+	if hits["/hot"] != 2 || hits["/cold"] != 2 {
+		t.Fatalf("expected the hot key to be refreshed once; got %v", hits)
+	}
+	mu.Unlock()
+
+	// re-warming is not the traffic of the caller
+	if err := transport.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	m := transport.Metrics()
+	if m.Count(naivehttpcache.OutcomeMiss) != 3 || m.Count(naivehttpcache.OutcomeHit) != 3 {
+		t.Errorf("expected 3 misses and 3 hits; got %d and %d", m.Count(naivehttpcache.OutcomeMiss), m.Count(naivehttpcache.OutcomeHit))
+	}
+	if m.Stores != 3 {
+		t.Errorf("expected 3 stores; got %d", m.Stores)
+	}
+}
+
+func TestHotKeysShortAhead(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithHotKeys(1, time.Nanosecond),
+	)
+	client := &http.Client{Transport: transport}
+	mustGet(t, client, ts.URL)
+	// the loop of rounds is running by now
+	time.Sleep(150 * time.Millisecond)
+	if err := transport.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,102 @@
+package naivehttpcache
+
+import (
+	"context"
+	"net"
+	"path"
+	"strings"
+	"time"
+)
+
+// CacheRoute routes keys of hosts matching Pattern to Cache, see RoutingCache.
+type CacheRoute struct {
+	// Pattern is a host name (without port) or a pattern of them, as of
+	// path.Match (e.g. *.example.com), matched case-insensitively.
+	Pattern string
+	Cache   Cache
+}
+
+// RoutingCache is Cache that stores values in different caches depending on
+// hosts (see KeyURL) of their keys, e.g. large artifacts of some hosts on disk
+// and small API responses of others in memory, behind a single Transport.
+// Keys are routed to Cache of the first of Routes matching their host, and to
+// Default if none does.
+type RoutingCache struct {
+	Routes  []CacheRoute
+	Default Cache
+}
+
+// NewRoutingCache returns RoutingCache that routes keys by routes, and those
+// that match none of them to def.
+func NewRoutingCache(def Cache, routes ...CacheRoute) *RoutingCache {
+	return &RoutingCache{Routes: routes, Default: def}
+}
+
+func (c *RoutingCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return c.route(key).Get(ctx, key)
+}
+
+func (c *RoutingCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	return c.route(key).Set(ctx, key, val, ttl)
+}
+
+func (c *RoutingCache) Delete(ctx context.Context, key string) error {
+	return c.route(key).Delete(ctx, key)
+}
+
+// Walk calls fn with keys of all caches of c that start with prefix until it
+// returns false. All of them must implement Walker, otherwise ErrNotWalkable is
+// returned.
+func (c *RoutingCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	var walkers []Walker
+	seen := make(map[Cache]bool)
+	for _, cache := range c.caches() {
+		if seen[cache] {
+			continue
+		}
+		seen[cache] = true
+		walker, ok := cache.(Walker)
+		if !ok {
+			return ErrNotWalkable
+		}
+		walkers = append(walkers, walker)
+	}
+
+	stopped := false
+	for _, walker := range walkers {
+		err := walker.Walk(ctx, prefix, func(key string) bool {
+			stopped = !fn(key)
+			return !stopped
+		})
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+	return nil
+}
+
+// caches returns caches of routes of c and its default one.
+func (c *RoutingCache) caches() []Cache {
+	caches := make([]Cache, 0, len(c.Routes)+1)
+	for _, route := range c.Routes {
+		caches = append(caches, route.Cache)
+	}
+	return append(caches, c.Default)
+}
+
+// route returns the cache that key is routed to.
+func (c *RoutingCache) route(key string) Cache {
+	host := keyHost(key)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, route := range c.Routes {
+		if ok, _ := path.Match(strings.ToLower(route.Pattern), host); ok {
+			return route.Cache
+		}
+	}
+	return c.Default
+}
@@ -0,0 +1,57 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestRoutingCache(t *testing.T) {
+	ctx := context.Background()
+	images := naivehttpcache.NewMemoryCache(0, 0)
+	api := naivehttpcache.NewMemoryCache(0, 0)
+	def := naivehttpcache.NewMemoryCache(0, 0)
+	cache := naivehttpcache.NewRoutingCache(def,
+		naivehttpcache.CacheRoute{Pattern: "images.example.com", Cache: images},
+		naivehttpcache.CacheRoute{Pattern: "*.API.example.com", Cache: api},
+	)
+
+	for key, want := range map[string]naivehttpcache.Cache{
+		"http://images.example.com/a.png":      images,
+		"http://Images.example.com:8080/b.png": images,
+		"http://v1.api.example.com/users":      api,
+		"http://example.com/":                  def,
+	} {
+		if err := cache.Set(ctx, key, []byte(key), 0); err != nil {
+			t.Fatal(err)
+		}
+		if val, ok, _ := want.Get(ctx, key); !ok || string(val) != key {
+			t.Errorf("%s: expected to be routed to its backend", key)
+		}
+		if val, ok, _ := cache.Get(ctx, key); !ok || string(val) != key {
+			t.Errorf("%s: expected to be read from its backend", key)
+		}
+	}
+	if _, ok, _ := def.Get(ctx, "http://images.example.com/a.png"); ok {
+		t.Fatal("expected routed keys not to be stored in the default backend")
+	}
+
+	var keys []string
+	if err := cache.Walk(ctx, "http://", func(key string) bool {
+		keys = append(keys, key)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 4 {
+		t.Fatalf("expected keys of all backends to be walked; got %q", keys)
+	}
+
+	if err := cache.Delete(ctx, "http://v1.api.example.com/users"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := api.Get(ctx, "http://v1.api.example.com/users"); ok {
+		t.Fatal("expected the key to be deleted from its backend")
+	}
+}
@@ -0,0 +1,195 @@
+package naivehttpcache
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultVirtualNodes is the number of points of a node on the ring of
+// ShardedCache by default.
+const DefaultVirtualNodes = 160
+
+// ErrNoNodes is the error of operations of ShardedCache that has no nodes.
+var ErrNoNodes = errors.New("naivehttpcache: sharded cache has no nodes")
+
+// ShardedCache is Cache that distributes keys across nodes (e.g. memcached or
+// Redis instances) by consistent hashing, so adding or removing a node only
+// moves the keys of its share of the ring. Each node takes VirtualNodes points
+// on the ring, placed by hashes of its name, so keys are routed the same way
+// wherever nodes are added under the same names.
+type ShardedCache struct {
+	// VirtualNodes is the number of points of each node on the ring, it
+	// applies to nodes added afterwards. Non-positive means
+	// DefaultVirtualNodes.
+	VirtualNodes int
+
+	mu    sync.RWMutex
+	nodes map[string]Cache
+	// ring holds points of nodes sorted by their hashes.
+	ring []ringPoint
+}
+
+// ringPoint is a point of a node on the ring of ShardedCache.
+type ringPoint struct {
+	hash uint64
+	node string
+}
+
+// NewShardedCache returns ShardedCache of nodes by their names, each taking
+// virtualNodes points on the ring.
+func NewShardedCache(virtualNodes int, nodes map[string]Cache) *ShardedCache {
+	c := &ShardedCache{VirtualNodes: virtualNodes}
+	for name, cache := range nodes {
+		c.AddNode(name, cache)
+	}
+	return c
+}
+
+// AddNode adds cache to c as node name, replacing the node of the same name.
+func (c *ShardedCache) AddNode(name string, cache Cache) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.nodes[name]; ok {
+		c.removeNode(name)
+	}
+	if c.nodes == nil {
+		c.nodes = make(map[string]Cache)
+	}
+	c.nodes[name] = cache
+
+	points := c.VirtualNodes
+	if points <= 0 {
+		points = DefaultVirtualNodes
+	}
+	for i := 0; i < points; i++ {
+		c.ring = append(c.ring, ringPoint{hash: ringHash(name + "#" + strconv.Itoa(i)), node: name})
+	}
+	sort.Slice(c.ring, func(i, j int) bool {
+		if c.ring[i].hash != c.ring[j].hash {
+			return c.ring[i].hash < c.ring[j].hash
+		}
+		return c.ring[i].node < c.ring[j].node
+	})
+}
+
+// RemoveNode removes node name from c, its keys are routed to the following
+// nodes on the ring.
+func (c *ShardedCache) RemoveNode(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeNode(name)
+}
+
+// removeNode removes node name, it must be called with mu held.
+func (c *ShardedCache) removeNode(name string) {
+	delete(c.nodes, name)
+	ring := c.ring[:0]
+	for _, p := range c.ring {
+		if p.node != name {
+			ring = append(ring, p)
+		}
+	}
+	c.ring = ring
+}
+
+// Node returns the name of the node that key is routed to, false means that
+// c has no nodes.
+func (c *ShardedCache) Node(key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	name, _, ok := c.node(key)
+	return name, ok
+}
+
+// node returns the node that key is routed to, it must be called with mu held.
+func (c *ShardedCache) node(key string) (string, Cache, bool) {
+	if len(c.ring) == 0 {
+		return "", nil, false
+	}
+	hash := ringHash(key)
+	i := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= hash })
+	if i == len(c.ring) {
+		i = 0
+	}
+	name := c.ring[i].node
+	return name, c.nodes[name], true
+}
+
+// cache returns the cache of the node that key is routed to.
+func (c *ShardedCache) cache(key string) (Cache, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, cache, ok := c.node(key)
+	if !ok {
+		return nil, ErrNoNodes
+	}
+	return cache, nil
+}
+
+func (c *ShardedCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	cache, err := c.cache(key)
+	if err != nil {
+		return nil, false, err
+	}
+	return cache.Get(ctx, key)
+}
+
+func (c *ShardedCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	cache, err := c.cache(key)
+	if err != nil {
+		return err
+	}
+	return cache.Set(ctx, key, val, ttl)
+}
+
+func (c *ShardedCache) Delete(ctx context.Context, key string) error {
+	cache, err := c.cache(key)
+	if err != nil {
+		return err
+	}
+	return cache.Delete(ctx, key)
+}
+
+// Walk calls fn with keys of all nodes of c that start with prefix until it
+// returns false. All of them must implement Walker, otherwise ErrNotWalkable is
+// returned.
+func (c *ShardedCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	c.mu.RLock()
+	walkers := make([]Walker, 0, len(c.nodes))
+	for _, cache := range c.nodes {
+		walker, ok := cache.(Walker)
+		if !ok {
+			c.mu.RUnlock()
+			return ErrNotWalkable
+		}
+		walkers = append(walkers, walker)
+	}
+	c.mu.RUnlock()
+
+	stopped := false
+	for _, walker := range walkers {
+		err := walker.Walk(ctx, prefix, func(key string) bool {
+			stopped = !fn(key)
+			return !stopped
+		})
+		if err != nil {
+			return err
+		}
+		if stopped {
+			return nil
+		}
+	}
+	return nil
+}
+
+// ringHash returns the position of s on the ring of ShardedCache.
+func ringHash(s string) uint64 {
+	sum := md5.Sum([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
@@ -0,0 +1,78 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestShardedCache(t *testing.T) {
+	ctx := context.Background()
+	nodes := map[string]naivehttpcache.Cache{
+		"a": naivehttpcache.NewMemoryCache(0, 0),
+		"b": naivehttpcache.NewMemoryCache(0, 0),
+		"c": naivehttpcache.NewMemoryCache(0, 0),
+	}
+	cache := naivehttpcache.NewShardedCache(0, nodes)
+
+	const keys = 3000
+	routed := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < keys; i++ {
+		key := "http://example.com/" + strconv.Itoa(i)
+		if err := cache.Set(ctx, key, []byte(key), 0); err != nil {
+			t.Fatal(err)
+		}
+		node, _ := cache.Node(key)
+		if _, ok, _ := nodes[node].Get(ctx, key); !ok {
+			t.Fatalf("%s: expected to be stored in node %s", key, node)
+		}
+		routed[key] = node
+		counts[node]++
+	}
+	for name := range nodes {
+		if n := counts[name]; n < keys/6 {
+			t.Errorf("expected keys to be distributed evenly; node %s got %d of %d", name, n, keys)
+		}
+	}
+
+	// only keys of the removed node move
+	cache.RemoveNode("b")
+	for key, prev := range routed {
+		node, _ := cache.Node(key)
+		if prev != "b" && node != prev {
+			t.Fatalf("%s: expected to stay in node %s; moved to %s", key, prev, node)
+		}
+		if node == "b" {
+			t.Fatalf("%s: expected not to be routed to the removed node", key)
+		}
+	}
+
+	// and adding a node only takes keys over
+	cache.AddNode("b", nodes["b"])
+	for key, prev := range routed {
+		if node, _ := cache.Node(key); node != prev {
+			t.Fatalf("%s: expected to be routed to node %s again; got %s", key, prev, node)
+		}
+		if val, ok, _ := cache.Get(ctx, key); !ok || string(val) != key {
+			t.Fatalf("%s: expected a hit; got %q, %v", key, val, ok)
+		}
+	}
+
+	var walked int
+	cache.Walk(ctx, "http://", func(string) bool {
+		walked++
+		return true
+	})
+	if walked != keys {
+		t.Fatalf("expected keys of all nodes to be walked; got %d", walked)
+	}
+
+	empty := naivehttpcache.NewShardedCache(0, nil)
+	if _, _, err := empty.Get(ctx, "a"); !errors.Is(err, naivehttpcache.ErrNoNodes) {
+		t.Fatalf("expected ErrNoNodes; got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package naivehttpcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// snapshotMagic prefixes snapshots of MemoryCache.
+const snapshotMagic = "\x89NHS"
+
+// errCorruptSnapshot is the error of snapshots that fail to decode.
+var errCorruptSnapshot = errors.New("naivehttpcache: corrupt memory cache snapshot")
+
+// WriteSnapshot writes entries of the cache to w, so that ReadSnapshot can
+// restore them, e.g. after a restart. Entries keep their ttls, as the times
+// they expire at.
+func (c *MemoryCache) WriteSnapshot(w io.Writer) error {
+	c.mu.Lock()
+	var entries []*memoryEntry
+	if c.lru != nil {
+		c.removeExpired()
+		entries = make([]*memoryEntry, 0, c.lru.Len())
+		// least recently used first, so that restoring them keeps the order
+		for el := c.lru.Back(); el != nil; el = el.Prev() {
+			entries = append(entries, el.Value.(*memoryEntry))
+		}
+	}
+	c.mu.Unlock()
+
+	// values are never modified, only replaced
+	buf := []byte(snapshotMagic)
+	for _, e := range entries {
+		buf = appendString(buf, e.key)
+		buf = appendUvarint(buf, uint64(len(e.val)))
+		buf = append(buf, e.val...)
+		var expires uint64
+		if !e.expires.IsZero() {
+			expires = uint64(e.expires.UnixNano())
+		}
+		buf = appendUvarint(buf, expires)
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(buf))
+	_, err := w.Write(append(buf, sum[:]...))
+	return err
+}
+
+// ReadSnapshot restores entries written by WriteSnapshot from r, as the most
+// recently used ones, replacing entries of the same keys. Entries that
+// expired meanwhile are skipped, and limits of the cache apply.
+func (c *MemoryCache) ReadSnapshot(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < len(snapshotMagic)+4 || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return errCorruptSnapshot
+	}
+	body, sum := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(sum) {
+		return errCorruptSnapshot
+	}
+
+	var entries []*memoryEntry
+	d := entryDecoder{buf: body[len(snapshotMagic):]}
+	for len(d.buf) > 0 && d.err == nil {
+		e := &memoryEntry{key: string(d.bytes())}
+		// copied, so values don't pin the whole snapshot
+		e.val = append([]byte(nil), d.bytes()...)
+		if expires := d.uvarint(); expires != 0 {
+			e.expires = time.Unix(0, int64(expires))
+		}
+		entries = append(entries, e)
+	}
+	if d.err != nil {
+		return errCorruptSnapshot
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	for _, e := range entries {
+		if e.expires.IsZero() || now.Before(e.expires) {
+			c.set(e)
+		}
+	}
+	return nil
+}
+
+// SaveSnapshot writes a snapshot of the cache to the file at path
+// atomically: it's written to a temporary file next to it first, which then
+// replaces it.
+func (c *MemoryCache) SaveSnapshot(path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := c.WriteSnapshot(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadSnapshot restores a snapshot of the cache from the file at path, see
+// ReadSnapshot.
+func (c *MemoryCache) LoadSnapshot(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return c.ReadSnapshot(f)
+}
+
+// DefaultSnapshotInterval is the default interval of snapshots of
+// Snapshotter.
+const DefaultSnapshotInterval = 5 * time.Minute
+
+// Snapshotter saves snapshots of a MemoryCache to a file periodically, so
+// that the cache survives restarts (and crashes, up to the last snapshot).
+// Fields must not be changed.
+type Snapshotter struct {
+	Cache *MemoryCache
+	// Path is the path of the snapshot file.
+	Path string
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+	mu   sync.Mutex
+	err  error
+}
+
+// NewSnapshotter restores cache from the snapshot file at path, unless there
+// is none yet, and saves snapshots of it there every interval (non-positive
+// means DefaultSnapshotInterval), until Close. Snapshots that fail to restore
+// (e.g. corrupt ones) are errors.
+func NewSnapshotter(cache *MemoryCache, path string, interval time.Duration) (*Snapshotter, error) {
+	if interval <= 0 {
+		interval = DefaultSnapshotInterval
+	}
+	if err := cache.LoadSnapshot(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	s := &Snapshotter{
+		Cache: cache,
+		Path:  path,
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.loop(interval)
+	return s, nil
+}
+
+// Err returns the error of the last periodic snapshot, nil if it succeeded.
+func (s *Snapshotter) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops periodic snapshots and saves the last one.
+func (s *Snapshotter) Close() error {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+	return s.Cache.SaveSnapshot(s.Path)
+}
+
+// loop saves snapshots every interval until stop is closed.
+func (s *Snapshotter) loop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := s.Cache.SaveSnapshot(s.Path)
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
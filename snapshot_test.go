@@ -0,0 +1,99 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestMemoryCacheSnapshot(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	cache.Clock = clock
+	cache.Set(ctx, "a", []byte("1"), 0)
+	cache.Set(ctx, "b", []byte("2"), time.Minute)
+	cache.Set(ctx, "c", []byte("3"), time.Hour)
+	cache.Get(ctx, "a")
+
+	var buf bytes.Buffer
+	if err := cache.WriteSnapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := buf.Bytes()
+
+	clock.Advance(2 * time.Minute)
+	restored := naivehttpcache.NewMemoryCache(0, 2)
+	restored.Clock = clock
+	if err := restored.ReadSnapshot(bytes.NewReader(snapshot)); err != nil {
+		t.Fatal(err)
+	}
+	if val, ok, _ := restored.Get(ctx, "a"); !ok || string(val) != "1" {
+		t.Fatalf("expected a to be restored; got %q, %v", val, ok)
+	}
+	if _, ok, _ := restored.Get(ctx, "b"); ok {
+		t.Fatal("expected expired entries not to be restored")
+	}
+	clock.Advance(time.Hour)
+	if _, ok, _ := restored.Get(ctx, "c"); ok {
+		t.Fatal("expected restored entries to keep their ttls")
+	}
+
+	snapshot[len(snapshot)/2] ^= 1
+	if err := restored.ReadSnapshot(bytes.NewReader(snapshot)); err == nil {
+		t.Fatal("expected corrupt snapshots to fail")
+	}
+}
+
+func TestSnapshotter(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cache.snapshot")
+
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	snapshotter, err := naivehttpcache.NewSnapshotter(cache, path, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache.Set(ctx, "a", []byte("1"), 0)
+	time.Sleep(50 * time.Millisecond)
+	if err := snapshotter.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash, the periodic snapshot survives it
+	crashed := naivehttpcache.NewMemoryCache(0, 0)
+	if err := crashed.LoadSnapshot(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := crashed.Get(ctx, "a"); !ok {
+		t.Fatal("expected a periodic snapshot to be saved")
+	}
+
+	cache.Set(ctx, "b", []byte("2"), 0)
+	if err := snapshotter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	restored := naivehttpcache.NewMemoryCache(0, 0)
+	snapshotter, err = naivehttpcache.NewSnapshotter(restored, path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snapshotter.Close()
+	if restored.Len() != 2 {
+		t.Fatalf("expected the cache to be restored on construction; got %d entries", restored.Len())
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("expected temporary files to be cleaned up; got %d files", len(files))
+	}
+}
@@ -0,0 +1,92 @@
+package naivehttpcache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+)
+
+// purgedHeader is stored with soft purged entries and holds the time of the
+// purge. It's never returned to the caller.
+const purgedHeader = "Naivehttpcache-Purged"
+
+// SoftPurge marks the entry of GET request to rawurl with ctx (which may be
+// needed for the partition) stale instead of deleting it, see
+// SoftPurgeRequest.
+func (t *Transport) SoftPurge(ctx context.Context, rawurl string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return err
+	}
+	return t.SoftPurgeRequest(req)
+}
+
+// SoftPurgeRequest marks the entry of req stale instead of deleting it, so it
+// remains available for revalidation and as a fallback (see Revalidate,
+// StaleIfError, RefreshInterval and StaleWhileLocked) until the server
+// responds with a new one. Transports that don't keep stale entries have no
+// use of it, so it's deleted as by PurgeRequest. Cached ranges are always
+// deleted, they are never served stale.
+func (t *Transport) SoftPurgeRequest(req *http.Request) error {
+	if !t.keepsStale() {
+		return t.PurgeRequest(req)
+	}
+
+	ctx := req.Context()
+	cacheKey := t.CacheKey(req)
+	if t.PartialContent {
+		if err := t.cacheDelete(ctx, partialKey(cacheKey)); err != nil {
+			return err
+		}
+		t.emit(EventInvalidate, partialKey(cacheKey), 0)
+	}
+
+	unlock := t.storeLocks.lock(cacheKey)
+	defer unlock()
+
+	val, ok, err := t.cacheGet(ctx, cacheKey)
+	if err != nil || !ok {
+		return err
+	}
+	resp, storedAt, err := decodeResponse(val, nil)
+	if err != nil {
+		// there's nothing to serve stale anyway
+		return t.PurgeRequest(req)
+	}
+	if resp.Header.Get(purgedHeader) != "" {
+		return nil
+	}
+	body, err := readBody(resp.Body)
+	if err != nil {
+		return err
+	}
+	resp.Header.Set(purgedHeader, t.now().UTC().Format(http.TimeFormat))
+
+	e, err := newEntry(resp, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	// soft purging doesn't make the entry any newer for bans
+	e.StoredAt, e.CachedAt = storedAt, entryCachedAt(val)
+	if err := t.cacheSet(ctx, cacheKey, e.encode(), t.ttl(t.meta(resp.StatusCode, resp.Header, storedAt))); err != nil {
+		return err
+	}
+	t.emit(EventInvalidate, cacheKey, 0)
+	return nil
+}
+
+// purgedAt returns the time cached response with header was soft purged at,
+// false means that it wasn't.
+func purgedAt(header http.Header) (time.Time, bool) {
+	v := header.Get(purgedHeader)
+	if v == "" {
+		return time.Time{}, false
+	}
+	at, err := http.ParseTime(v)
+	if err != nil {
+		// it's stale anyway
+		return time.Time{}, true
+	}
+	return at, true
+}
@@ -0,0 +1,73 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestSoftPurge(t *testing.T) {
+	hits, failing := 0, false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("cache-control", "max-age=3600")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(
+		naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithSharedCache(),
+		naivehttpcache.WithStaleIfError(),
+	)
+	client := &http.Client{Transport: transport}
+
+	mustGet(t, client, ts.URL)
+	if err := transport.SoftPurge(context.Background(), ts.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	failing = true
+	resp, body := mustGet(t, client, ts.URL)
+	if hits != 2 || body != "hello" || resp.Header.Get("warning") == "" {
+		t.Fatalf("expected soft purged response to be served stale when the server fails; got %d hits, %q", hits, body)
+	}
+	if v := resp.Header.Get("naivehttpcache-purged"); v != "" {
+		t.Fatalf("expected the purge mark to be stripped; got %q", v)
+	}
+
+	failing = false
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	if hits != 3 {
+		t.Fatalf("expected soft purged response to be replaced by a new one; got %d hits", hits)
+	}
+}
+
+func TestSoftPurgeWithoutStale(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	transport := naivehttpcache.NewTransport(cache)
+	client := &http.Client{Transport: transport}
+
+	mustGet(t, client, ts.URL)
+	if err := transport.SoftPurge(context.Background(), ts.URL); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := cache.Get(context.Background(), transport.CacheKey(httptest.NewRequest(http.MethodGet, ts.URL, nil))); ok {
+		t.Fatal("expected entry to be deleted when stale entries are not kept")
+	}
+}
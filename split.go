@@ -0,0 +1,52 @@
+package naivehttpcache
+
+import (
+	"context"
+	"time"
+)
+
+// SplitCache is Cache that reads values from Replica and writes them to
+// Primary, for replicated backends (e.g. Redis replicas, or local snapshots
+// of a shared cache) of read-heavy fleets. As replication lags, values may be
+// missing from Replica for a while after they are stored, and served from it
+// for a while after they are deleted.
+type SplitCache struct {
+	Primary Cache
+	Replica Cache
+	// ReadPrimary makes Get read from Primary once Replica misses or fails,
+	// so values are served right after they are stored, at the cost of
+	// misses hitting Primary.
+	ReadPrimary bool
+}
+
+// NewSplitCache returns SplitCache that reads from replica and writes to
+// primary.
+func NewSplitCache(primary, replica Cache) *SplitCache {
+	return &SplitCache{Primary: primary, Replica: replica}
+}
+
+func (c *SplitCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	val, ok, err := c.Replica.Get(ctx, key)
+	if ok || !c.ReadPrimary {
+		return val, ok, err
+	}
+	return c.Primary.Get(ctx, key)
+}
+
+func (c *SplitCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	return c.Primary.Set(ctx, key, val, ttl)
+}
+
+func (c *SplitCache) Delete(ctx context.Context, key string) error {
+	return c.Primary.Delete(ctx, key)
+}
+
+// Walk calls fn with keys of Replica that start with prefix until it returns
+// false. Replica must implement Walker, otherwise ErrNotWalkable is returned.
+func (c *SplitCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	walker, ok := c.Replica.(Walker)
+	if !ok {
+		return ErrNotWalkable
+	}
+	return walker.Walk(ctx, prefix, fn)
+}
@@ -0,0 +1,49 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestSplitCache(t *testing.T) {
+	ctx := context.Background()
+	primary := naivehttpcache.NewMemoryCache(0, 0)
+	replica := newFailingCache()
+	replica.failing = false
+	cache := naivehttpcache.NewSplitCache(primary, replica)
+
+	if err := cache.Set(ctx, "a", []byte("1"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := primary.Get(ctx, "a"); !ok {
+		t.Fatal("expected the value to be written to the primary")
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Fatal("expected the value to be read from the replica")
+	}
+
+	// replication
+	replica.Set(ctx, "a", []byte("1"), 0)
+	if val, ok, _ := cache.Get(ctx, "a"); !ok || string(val) != "1" {
+		t.Fatalf("expected a hit; got %q, %v", val, ok)
+	}
+	if err := cache.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := primary.Get(ctx, "a"); ok {
+		t.Fatal("expected the value to be deleted from the primary")
+	}
+
+	cache.Set(ctx, "b", []byte("2"), 0)
+	replica.failing = true
+	if _, _, err := cache.Get(ctx, "b"); !errors.Is(err, errBackend) {
+		t.Fatalf("expected errors of the replica; got %v", err)
+	}
+	cache.ReadPrimary = true
+	if val, ok, err := cache.Get(ctx, "b"); err != nil || !ok || string(val) != "2" {
+		t.Fatalf("expected the value to be read from the primary; got %q, %v, %v", val, ok, err)
+	}
+}
@@ -0,0 +1,111 @@
+package naivehttpcache
+
+import "context"
+
+// Size is the size of a cache.
+type Size struct {
+	// Entries is the number of entries.
+	Entries int64
+	// Bytes is the summary size of keys and values.
+	Bytes int64
+}
+
+// Sizer is implemented by caches that keep track of their size.
+type Sizer interface {
+	Size(ctx context.Context) (Size, error)
+}
+
+// Tier is a named cache that is a part of another one.
+type Tier struct {
+	Name  string
+	Cache Cache
+}
+
+// Tiered is implemented by caches made of other caches, e.g. memory in front
+// of a remote store.
+type Tiered interface {
+	Tiers() []Tier
+}
+
+// TierSize is the size of Tier.
+type TierSize struct {
+	Name string
+	Size
+}
+
+// Stats describes the cache of Transport.
+type Stats struct {
+	Size
+	// Tiers breaks the size down by tiers of Tiered caches.
+	Tiers []TierSize
+}
+
+// Stats returns Stats of the cache. Sizes are taken from Sizer caches or
+// counted by walking Walker ones, otherwise ErrNotWalkable is returned. Size
+// of Tiered caches that don't tell it themselves is the sum of their tiers.
+func (t *Transport) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+	if tiered, ok := t.Cache.(Tiered); ok {
+		for _, tier := range tiered.Tiers() {
+			size, err := cacheSize(ctx, tier.Cache)
+			if err != nil {
+				return Stats{}, err
+			}
+			stats.Tiers = append(stats.Tiers, TierSize{Name: tier.Name, Size: size})
+			stats.Entries += size.Entries
+			stats.Bytes += size.Bytes
+		}
+	}
+
+	size, err := cacheSize(ctx, t.Cache)
+	switch {
+	case err == nil:
+		stats.Size = size
+	case err != ErrNotWalkable || stats.Tiers == nil:
+		return Stats{}, err
+	}
+	return stats, nil
+}
+
+// Size returns the size of the cache.
+func (c *MemoryCache) Size(ctx context.Context) (Size, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.lru == nil {
+		return Size{}, nil
+	}
+	c.removeExpired()
+	return Size{Entries: int64(c.lru.Len()), Bytes: c.bytes}, nil
+}
+
+// cacheSize returns the size of cache.
+func cacheSize(ctx context.Context, cache Cache) (Size, error) {
+	if sizer, ok := cache.(Sizer); ok {
+		return sizer.Size(ctx)
+	}
+	walker, ok := cache.(Walker)
+	if !ok {
+		return Size{}, ErrNotWalkable
+	}
+
+	var size Size
+	var err error
+	walkErr := walker.Walk(ctx, "", func(key string) bool {
+		var val []byte
+		var ok bool
+		val, ok, err = cache.Get(ctx, key)
+		if err != nil {
+			return false
+		}
+		if ok {
+			size.Entries++
+			size.Bytes += int64(len(key) + len(val))
+		}
+		return true
+	})
+	if err == nil {
+		err = walkErr
+	}
+	return size, err
+}
@@ -0,0 +1,71 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+// walkingCache is MemoryCache that can only be walked to tell its size.
+type walkingCache struct {
+	naivehttpcache.Cache
+	naivehttpcache.Walker
+}
+
+// tieredCache writes to all of its tiers and reads from the first one.
+type tieredCache struct {
+	naivehttpcache.Cache
+	tiers []naivehttpcache.Tier
+}
+
+func (c tieredCache) Tiers() []naivehttpcache.Tier {
+	return c.tiers
+}
+
+func TestStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	memory := naivehttpcache.NewMemoryCache(0, 0)
+	walking := naivehttpcache.NewMemoryCache(0, 0)
+	cache := tieredCache{
+		Cache: memory,
+		tiers: []naivehttpcache.Tier{
+			{Name: "memory", Cache: memory},
+			{Name: "walking", Cache: walkingCache{walking, walking}},
+		},
+	}
+	transport := naivehttpcache.NewTransport(cache)
+	client := &http.Client{Transport: transport}
+
+	mustGet(t, client, ts.URL+"/a")
+	mustGet(t, client, ts.URL+"/b")
+	// copy the entries to the other tier
+	ctx := context.Background()
+	memory.Walk(ctx, "", func(key string) bool {
+		val, _, _ := memory.Get(ctx, key)
+		walking.Set(ctx, key, val, 0)
+		return true
+	})
+
+	stats, err := transport.Stats(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 4 || stats.Bytes != 2*memory.Bytes() {
+		t.Fatalf("expected 4 entries of %d bytes; got %+v", 2*memory.Bytes(), stats.Size)
+	}
+	if len(stats.Tiers) != 2 || stats.Tiers[1].Name != "walking" || stats.Tiers[0].Size != stats.Tiers[1].Size {
+		t.Fatalf("expected 2 tiers of the same size; got %+v", stats.Tiers)
+	}
+
+	stats, err = naivehttpcache.NewTransport(memory).Stats(ctx)
+	if err != nil || stats.Entries != 2 || stats.Tiers != nil {
+		t.Fatalf("expected 2 entries without tiers; got %+v, %v", stats, err)
+	}
+}
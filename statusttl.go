@@ -0,0 +1,19 @@
+package naivehttpcache
+
+import "time"
+
+// WithStatusTTLs sets for how long responses with specific status codes stay
+// fresh, e.g. 200 for 10 minutes, 301 for a day and 404 for 30 seconds, see
+// Transport.StatusTTLs.
+func WithStatusTTLs(ttls map[int]time.Duration) Option {
+	return func(o *Options) {
+		o.StatusTTLs = ttls
+	}
+}
+
+// statusTTL returns the lifetime of StatusTTLs of responses with status, false
+// means that it has none.
+func (t *Transport) statusTTL(status int) (time.Duration, bool) {
+	ttl, ok := t.StatusTTLs[status]
+	return ttl, ok
+}
@@ -0,0 +1,99 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestStatusTTLs(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/ok":
+			w.Write([]byte("ok"))
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+			naivehttpcache.WithMaxAge(time.Hour),
+			naivehttpcache.WithStatusTTLs(map[int]time.Duration{
+				http.StatusOK:               10 * time.Minute,
+				http.StatusMovedPermanently: 24 * time.Hour,
+				http.StatusNotFound:         30 * time.Second,
+			}),
+			naivehttpcache.WithClock(clock),
+		),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	get := func(path string, expectedStatus, expectedHits int) {
+		t.Helper()
+		resp, _ := mustGet(t, client, ts.URL+path)
+		if resp.StatusCode != expectedStatus {
+			t.Fatalf("%s: expected status %d; got %d", path, expectedStatus, resp.StatusCode)
+		}
+		if hits[path] != expectedHits {
+			t.Fatalf("%s: expected %d hits; got %d", path, expectedHits, hits[path])
+		}
+	}
+
+	for _, path := range []string{"/ok", "/moved", "/missing", "/gone"} {
+		resp, _ := mustGet(t, client, ts.URL+path)
+		if resp.Header.Get(naivehttpcache.XFromCache) == "1" {
+			t.Fatalf("%s: expected first response not to be from cache", path)
+		}
+	}
+	get("/ok", http.StatusOK, 1)
+	get("/moved", http.StatusMovedPermanently, 1)
+	get("/missing", http.StatusNotFound, 1)
+	// statuses without lifetimes are cached as without StatusTTLs
+	get("/gone", http.StatusGone, 1)
+
+	clock.Advance(time.Minute)
+	get("/ok", http.StatusOK, 1)
+	get("/missing", http.StatusNotFound, 2)
+
+	// lifetimes take precedence over MaxAge
+	clock.Advance(20 * time.Minute)
+	get("/ok", http.StatusOK, 2)
+	get("/moved", http.StatusMovedPermanently, 1)
+}
+
+func TestStatusTTLsNotStored(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Transport: naivehttpcache.NewTransport(
+		naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()),
+		naivehttpcache.WithMaxAge(time.Hour),
+		naivehttpcache.WithStatusTTLs(map[int]time.Duration{http.StatusOK: 0}),
+	)}
+
+	mustGet(t, client, ts.URL)
+	mustGet(t, client, ts.URL)
+	if hits != 2 {
+		t.Fatalf("expected 2 hits; got %d", hits)
+	}
+}
@@ -0,0 +1,54 @@
+package naivehttpcache
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultStoreTimeout is the default Transport.StoreTimeout.
+const DefaultStoreTimeout = 30 * time.Second
+
+// WithStoreTimeout limits the duration of stores made once bodies are read,
+// see Transport.StoreTimeout.
+func WithStoreTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.StoreTimeout = timeout
+	}
+}
+
+// storeContext returns context of a store made for the request with ctx once
+// its body is read: it carries values of ctx (e.g. for tracing), but not its
+// cancellation, as the request may be done before the store is, and it's
+// limited by StoreTimeout instead.
+func (t *Transport) storeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := t.StoreTimeout
+	if timeout == 0 {
+		timeout = DefaultStoreTimeout
+	}
+	if timeout < 0 {
+		return context.WithCancel(detachedContext{ctx})
+	}
+	return context.WithTimeout(detachedContext{ctx}, timeout)
+}
+
+// detachedContext is a context with values of the parent, but which is never
+// done.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,60 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+// contextCache is MemoryCache that calls onSet with contexts of writes.
+type contextCache struct {
+	*naivehttpcache.MemoryCache
+	onSet func(ctx context.Context)
+}
+
+func (c *contextCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	c.onSet(ctx)
+	return c.MemoryCache.Set(ctx, key, val, ttl)
+}
+
+func TestStoreContext(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), tenantKey{}, "acme"))
+	defer cancel()
+	var tenant string
+	var deadline time.Duration
+	var err error
+	cache := &contextCache{
+		MemoryCache: naivehttpcache.NewMemoryCache(0, 0),
+		onSet: func(ctx context.Context) {
+			// the request is done, but the store goes on
+			cancel()
+			tenant, _ = ctx.Value(tenantKey{}).(string)
+			if at, ok := ctx.Deadline(); ok {
+				deadline = time.Until(at)
+			}
+			err = ctx.Err()
+		},
+	}
+	transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithStoreTimeout(time.Minute))
+
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+	fetch(t, &http.Client{Transport: transport}, req)
+	if tenant != "acme" {
+		t.Fatalf("expected values of the request context to be passed; got %q", tenant)
+	}
+	if deadline <= 0 || deadline > time.Minute {
+		t.Fatalf("expected the store to be limited by StoreTimeout; got %v", deadline)
+	}
+	if err != nil || cache.Len() != 1 {
+		t.Fatalf("expected the store not to be canceled with the request; got %v", err)
+	}
+}
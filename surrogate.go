@@ -0,0 +1,24 @@
+package naivehttpcache
+
+import "net/http"
+
+// WithSurrogateControl makes Transport obey Surrogate-Control header of
+// responses, see Transport.SurrogateControl.
+func WithSurrogateControl() Option {
+	return func(o *Options) {
+		o.SurrogateControl = true
+	}
+}
+
+// surrogateControl returns parsed Surrogate-Control of header, false means
+// that there's none or that it's not obeyed.
+func (t *Transport) surrogateControl(header http.Header) (cacheControl, bool) {
+	if !t.SurrogateControl {
+		return nil, false
+	}
+	lines := header.Values("surrogate-control")
+	if len(lines) == 0 {
+		return nil, false
+	}
+	return parseDirectives(lines), true
+}
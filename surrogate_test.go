@@ -0,0 +1,63 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestSurrogateControl(t *testing.T) {
+	hits := map[string]int{}
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/cacheable":
+			w.Header().Set("cache-control", "private, no-store, max-age=0")
+			w.Header().Set("surrogate-control", "max-age=300")
+		case "/uncacheable":
+			w.Header().Set("cache-control", "max-age=300")
+			w.Header().Set("surrogate-control", "no-store")
+		}
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithSharedCache(),
+			naivehttpcache.WithRespectNoStore(),
+			naivehttpcache.WithSurrogateControl(),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	get := func(path string) {
+		resp, _ := mustGet(t, client, ts.URL+path)
+		if v := resp.Header.Get("surrogate-control"); v != "" {
+			t.Fatalf("expected Surrogate-Control to be stripped; got %q", v)
+		}
+		if v := resp.Header.Get("cache-control"); v == "" {
+			t.Fatal("expected Cache-Control to be returned")
+		}
+	}
+
+	for _, path := range []string{"/cacheable", "/uncacheable"} {
+		get(path)
+		clock.Advance(time.Minute)
+		get(path)
+	}
+	if hits["/cacheable"] != 1 || hits["/uncacheable"] != 2 {
+		t.Fatalf("expected Surrogate-Control to take precedence over Cache-Control; got %v", hits)
+	}
+
+	clock.Advance(5 * time.Minute)
+	get("/cacheable")
+	if hits["/cacheable"] != 2 {
+		t.Fatalf("expected response to expire after max-age of Surrogate-Control; got %d hits", hits["/cacheable"])
+	}
+}
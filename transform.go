@@ -0,0 +1,35 @@
+package naivehttpcache
+
+import "net/http"
+
+// WithStoreTransform sets a function that modifies responses before they are
+// stored, see Transport.StoreTransform.
+func WithStoreTransform(fn func(resp *http.Response)) Option {
+	return func(o *Options) {
+		o.StoreTransform = fn
+	}
+}
+
+// WithServeTransform sets a function that modifies responses served from the
+// cache, see Transport.ServeTransform.
+func WithServeTransform(fn func(resp *http.Response)) Option {
+	return func(o *Options) {
+		o.ServeTransform = fn
+	}
+}
+
+// WithRequestNormalizer sets a function that rewrites requests before they are
+// handled, see Transport.NormalizeRequest.
+func WithRequestNormalizer(fn func(req *http.Request) *http.Request) Option {
+	return func(o *Options) {
+		o.NormalizeRequest = fn
+	}
+}
+
+// normalize returns req rewritten by NormalizeRequest.
+func (t *Transport) normalize(req *http.Request) *http.Request {
+	if t.NormalizeRequest == nil {
+		return req
+	}
+	return t.NormalizeRequest(req)
+}
@@ -0,0 +1,108 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestStoreTransform(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret"})
+		w.Header().Set("x-debug", "trace")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithStoreTransform(func(resp *http.Response) {
+				resp.Header.Del("set-cookie")
+				resp.Header.Del("x-debug")
+			}),
+		),
+	}
+
+	resp, _ := mustGet(t, client, ts.URL)
+	if resp.Header.Get("set-cookie") == "" || resp.Header.Get("x-debug") == "" {
+		t.Fatal("expected the response from the server to be intact")
+	}
+	resp, body := mustGet(t, client, ts.URL)
+	if resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != "hello" {
+		t.Fatalf("expected a hit; got %q", body)
+	}
+	if resp.Header.Get("set-cookie") != "" || resp.Header.Get("x-debug") != "" {
+		t.Fatalf("expected headers to be stripped; got %v", resp.Header)
+	}
+}
+
+func TestServeTransform(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	cache := naivehttpcache.NewMemoryCache(0, 0)
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(cache,
+			naivehttpcache.WithMaxAge(time.Minute),
+			naivehttpcache.WithServeTransform(func(resp *http.Response) {
+				resp.Header.Add("x-served-for", resp.Request.URL.Path)
+			}),
+		),
+	}
+
+	resp, _ := mustGet(t, client, ts.URL+"/a")
+	if resp.Header.Get("x-served-for") != "" {
+		t.Fatal("expected the response from the server to be intact")
+	}
+	for i := 0; i < 2; i++ {
+		resp, _ = mustGet(t, client, ts.URL+"/a")
+		// values would pile up if the stored entry was modified
+		served := resp.Header.Values("x-served-for")
+		if resp.Header.Get(naivehttpcache.XFromCache) != "1" || len(served) != 1 || served[0] != "/a" {
+			t.Fatalf("expected transformed hit; got %v", resp.Header)
+		}
+	}
+}
+
+func TestNormalizeRequest(t *testing.T) {
+	var tracing []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracing = append(tracing, r.Header.Get("x-trace"))
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(
+		naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithMaxAge(time.Minute),
+		naivehttpcache.WithRequestNormalizer(func(req *http.Request) *http.Request {
+			req = req.Clone(req.Context())
+			req.URL.Path = strings.ToLower(req.URL.Path)
+			req.Header.Del("x-trace")
+			return req
+		}),
+	)
+	client := &http.Client{Transport: transport}
+
+	for _, path := range []string{"/A", "/a"} {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		req.Header.Set("x-trace", "1")
+		fetch(t, client, req)
+	}
+	if len(tracing) != 1 || tracing[0] != "" {
+		t.Fatalf("expected a single normalized request to the server; got %q", tracing)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/A", nil)
+	if key := transport.CacheKey(req); key != ts.URL+"/a" {
+		t.Fatalf("expected normalized key; got %q", key)
+	}
+}
@@ -0,0 +1,32 @@
+package naivehttpcache
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// WithTTLHeader makes Transport take lifetimes of responses from header name
+// set by the server, see Transport.TTLHeader.
+func WithTTLHeader(name string) Option {
+	return func(o *Options) {
+		o.TTLHeader = name
+	}
+}
+
+// headerTTL returns the lifetime set in TTLHeader of header, false means that
+// there's no valid one.
+func (t *Transport) headerTTL(header http.Header) (time.Duration, bool) {
+	if t.TTLHeader == "" {
+		return 0, false
+	}
+	v := header.Get(t.TTLHeader)
+	if v == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
@@ -0,0 +1,51 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestTTLHeader(t *testing.T) {
+	hits := 0
+	ts := httptest.NewServer(undated(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("cache-control", "max-age=0")
+		w.Header().Set("x-naive-cache-ttl", "300")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	clock := newFakeClock()
+	client := &http.Client{
+		Transport: naivehttpcache.NewTransport(
+			naivehttpcache.NewMemoryCache(0, 0),
+			naivehttpcache.WithSharedCache(),
+			naivehttpcache.WithTTLHeader("X-Naive-Cache-TTL"),
+			naivehttpcache.WithClock(clock),
+		),
+	}
+
+	get := func() {
+		resp, _ := mustGet(t, client, ts.URL)
+		if v := resp.Header.Get("x-naive-cache-ttl"); v != "" {
+			t.Fatalf("expected TTL header to be stripped; got %q", v)
+		}
+	}
+
+	get()
+	clock.Advance(2 * time.Minute)
+	get()
+	if hits != 1 {
+		t.Fatalf("expected response to be fresh for the TTL set by the server; got %d hits", hits)
+	}
+
+	clock.Advance(5 * time.Minute)
+	get()
+	if hits != 2 {
+		t.Fatalf("expected response to expire after the TTL set by the server; got %d hits", hits)
+	}
+}
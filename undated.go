@@ -0,0 +1,39 @@
+package naivehttpcache
+
+import (
+	"math"
+	"time"
+)
+
+// UndatedEntryPolicy states what Transport does with cached entries that
+// don't tell when they were stored: entries of older versions of the package
+// which Date header is missing or can't be parsed.
+type UndatedEntryPolicy int
+
+const (
+	// UndatedExpired treats undated entries as expired for as long as
+	// possible, so they are revalidated or replaced. This is the default.
+	UndatedExpired UndatedEntryPolicy = iota
+	// UndatedFail fails RoundTrip for undated entries that may expire.
+	UndatedFail
+)
+
+// WithUndatedEntryPolicy sets what happens to entries that don't tell when
+// they were stored, see UndatedEntryPolicy.
+func WithUndatedEntryPolicy(policy UndatedEntryPolicy) Option {
+	return func(o *Options) {
+		o.UndatedEntries = policy
+	}
+}
+
+// undatedStaleness is the staleness of undated entries by UndatedExpired.
+const undatedStaleness = time.Duration(math.MaxInt64)
+
+// undated returns the error of checking freshness of an undated entry that
+// has to be surfaced according to UndatedEntries, if any.
+func (t *Transport) undated() error {
+	if t.UndatedEntries == UndatedFail {
+		return errNoDate
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package naivehttpcache_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestUndatedEntry(t *testing.T) {
+	tsHits := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tsHits++
+		w.Write([]byte("fresh"))
+	}))
+	defer ts.Close()
+
+	// entries of older versions only tell when they were stored by Date
+	legacy := func(date string) *httpcache.MemoryCache {
+		cache := httpcache.NewMemoryCache()
+		cache.Set(ts.URL, []byte("HTTP/1.1 200 OK\r\nContent-Length: 5\r\nDate: "+date+"\r\n\r\nstale"))
+		return cache
+	}
+
+	t.Run("expired", func(t *testing.T) {
+		tsHits = 0
+		transport := naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(legacy("yesterday")),
+			naivehttpcache.WithMaxAge(time.Hour),
+		)
+		client := &http.Client{Transport: transport}
+		if resp, body := mustGet(t, client, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) == "1" || body != "fresh" {
+			t.Fatalf("expected the undated entry to be expired; got %q", body)
+		}
+		if resp, body := mustGet(t, client, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != "fresh" || tsHits != 1 {
+			t.Fatalf("expected the undated entry to be replaced; got %q", body)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		transport := naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(legacy("yesterday")),
+			naivehttpcache.WithMaxAge(time.Hour),
+			naivehttpcache.WithUndatedEntryPolicy(naivehttpcache.UndatedFail),
+		)
+		if _, err := (&http.Client{Transport: transport}).Get(ts.URL); err == nil {
+			t.Fatal("expected the undated entry to fail the request")
+		}
+	})
+
+	t.Run("obsolete format", func(t *testing.T) {
+		date := time.Now().UTC().Format(time.RFC850)
+		transport := naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(legacy(date)),
+			naivehttpcache.WithMaxAge(time.Hour),
+		)
+		if resp, body := mustGet(t, &http.Client{Transport: transport}, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != "stale" {
+			t.Fatalf("expected the entry dated in RFC 850 format to be fresh; got %q", body)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package naivehttpcache
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Walker is implemented by caches that can enumerate their keys.
+type Walker interface {
+	// Walk calls fn with keys of the cache that start with prefix until it
+	// returns false. fn may modify the cache, keys that are added meanwhile
+	// may or may not be walked.
+	Walk(ctx context.Context, prefix string, fn func(key string) bool) error
+}
+
+// ErrNotWalkable is returned by operations that need to enumerate keys of a
+// cache that doesn't implement Walker.
+var ErrNotWalkable = errors.New("naivehttpcache: cache can't enumerate keys")
+
+// Walk calls fn with keys of the cache that start with prefix until it returns
+// false.
+func (c *MemoryCache) Walk(ctx context.Context, prefix string, fn func(key string) bool) error {
+	c.mu.Lock()
+	keys := make([]string, 0, len(c.items))
+	for key := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !fn(key) {
+			break
+		}
+	}
+	return nil
+}
+
+// Walk calls fn with keys of entries of t, which URLs (see KeyURL) start with
+// urlPrefix, until it returns false. Keys of all partitions and ranges are
+// walked. The cache must implement Walker, otherwise ErrNotWalkable is
+// returned.
+func (t *Transport) Walk(ctx context.Context, urlPrefix string, fn func(key string) bool) error {
+	walker, ok := t.Cache.(Walker)
+	if !ok {
+		return ErrNotWalkable
+	}
+
+	if t.plainKeys() {
+		return walker.Walk(ctx, urlPrefix, fn)
+	}
+	return walker.Walk(ctx, "", func(key string) bool {
+		if !strings.HasPrefix(KeyURL(key), urlPrefix) {
+			return true
+		}
+		return fn(key)
+	})
+}
+
+// plainKeys reports whether keys of t are just URLs, see cacheKey.
+func (t *Transport) plainKeys() bool {
+	return t.Partition == nil && t.AcceptEncoding != AcceptEncodingNormalize &&
+		t.Authorization != AuthorizationPartition && !t.PartialContent
+}
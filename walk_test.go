@@ -0,0 +1,66 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/blukai/naivehttpcache"
+	"github.com/gregjones/httpcache"
+)
+
+func TestWalk(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("cache-control", "max-age=60")
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	for _, partitioned := range []bool{false, true} {
+		var opts []naivehttpcache.Option
+		if partitioned {
+			opts = append(opts, naivehttpcache.WithPartition(func(ctx context.Context) string {
+				tenant, _ := ctx.Value(tenantKey{}).(string)
+				return tenant
+			}))
+		}
+		transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0), opts...)
+		client := &http.Client{Transport: transport}
+
+		for _, path := range []string{"/a/1", "/a/2", "/b/1"} {
+			req, _ := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+			req = req.WithContext(context.WithValue(req.Context(), tenantKey{}, "acme"))
+			fetch(t, client, req)
+		}
+
+		var urls []string
+		err := transport.Walk(context.Background(), ts.URL+"/a/", func(key string) bool {
+			urls = append(urls, naivehttpcache.KeyURL(key))
+			return true
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(urls)
+		if len(urls) != 2 || urls[0] != ts.URL+"/a/1" || urls[1] != ts.URL+"/a/2" {
+			t.Fatalf("partitioned %v: expected /a/1 and /a/2; got %q", partitioned, urls)
+		}
+
+		n := 0
+		transport.Walk(context.Background(), "", func(key string) bool {
+			n++
+			return false
+		})
+		if n != 1 {
+			t.Fatalf("partitioned %v: expected walk to stop; got %d keys", partitioned, n)
+		}
+	}
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.FromHTTPCache(httpcache.NewMemoryCache()))
+	err := transport.Walk(context.Background(), "", func(string) bool { return true })
+	if err != naivehttpcache.ErrNotWalkable {
+		t.Fatalf("expected ErrNotWalkable; got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package naivehttpcache
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DefaultWarmConcurrency is the default number of URLs that Warm fetches at
+// a time.
+const DefaultWarmConcurrency = 4
+
+// maxSitemaps is the maximum number of sitemaps of a sitemap index that
+// WarmSitemap reads, as of the sitemaps protocol.
+const maxSitemaps = 50000
+
+// Sitemap is a list of URLs, see ParseSitemap.
+type Sitemap struct {
+	URLs []string
+	// Sitemaps holds URLs of sitemaps listed by a sitemap index.
+	Sitemaps []string
+}
+
+// ParseSitemap parses sitemap.xml (a URL set or a sitemap index, optionally
+// gzipped) or a URL manifest, that is a text file of URLs, one per line,
+// with empty lines and lines starting with # ignored.
+func ParseSitemap(r io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+
+	data, err := ioutil.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	if trimmed := bytes.TrimSpace(data); !bytes.HasPrefix(trimmed, []byte("<")) {
+		sitemap := &Sitemap{}
+		for _, line := range strings.Split(string(trimmed), "\n") {
+			if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+				sitemap.URLs = append(sitemap.URLs, line)
+			}
+		}
+		return sitemap, nil
+	}
+
+	var doc struct {
+		URLs []struct {
+			Loc string `xml:"loc"`
+		} `xml:"url"`
+		Sitemaps []struct {
+			Loc string `xml:"loc"`
+		} `xml:"sitemap"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("naivehttpcache: parsing sitemap: %w", err)
+	}
+	sitemap := &Sitemap{}
+	for _, u := range doc.URLs {
+		if loc := strings.TrimSpace(u.Loc); loc != "" {
+			sitemap.URLs = append(sitemap.URLs, loc)
+		}
+	}
+	for _, s := range doc.Sitemaps {
+		if loc := strings.TrimSpace(s.Loc); loc != "" {
+			sitemap.Sitemaps = append(sitemap.Sitemaps, loc)
+		}
+	}
+	return sitemap, nil
+}
+
+// WarmProgress reports a URL warmed by Warm.
+type WarmProgress struct {
+	URL string
+	// Err is the error of fetching URL, StatusCode is the status of its
+	// response otherwise.
+	Err        error
+	StatusCode int
+	// Outcome tells how the response was served, e.g. OutcomeHit if URL was
+	// cached already.
+	Outcome Outcome
+	// Done is the number of URLs warmed so far, out of Total.
+	Done  int
+	Total int
+}
+
+// Warm fills the cache with responses to plain GET requests of urls, with
+// ctx, fetching at most concurrency (non-positive means
+// DefaultWarmConcurrency) of them at a time. The requests go through t, so
+// its policies apply as to any other request, and URLs that are cached
+// already are not fetched again. Progress, if not nil, is called once every
+// URL is warmed, one call at a time. Errors of URLs are only reported to
+// progress, Warm returns ctx.Err() if ctx is done before all of them are
+// warmed.
+func (t *Transport) Warm(ctx context.Context, urls []string, concurrency int, progress func(WarmProgress)) error {
+	if concurrency <= 0 {
+		concurrency = DefaultWarmConcurrency
+	}
+
+	var mu sync.Mutex
+	done := 0
+	report := func(p WarmProgress) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if progress != nil {
+			p.Done, p.Total = done, len(urls)
+			progress(p)
+		}
+	}
+
+	queue := make(chan string)
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for url := range queue {
+				report(t.warm(ctx, url))
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for _, url := range urls {
+		select {
+		case queue <- url:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+	return err
+}
+
+// warm fetches url through t and reads its body, so that it's stored.
+func (t *Transport) warm(ctx context.Context, url string) WarmProgress {
+	p := WarmProgress{URL: url}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		p.Err = err
+		return p
+	}
+	resp, err := t.RoundTrip(req)
+	if err != nil {
+		p.Err = err
+		return p
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(ioutil.Discard, resp.Body); err != nil {
+		p.Err = err
+	}
+	p.StatusCode = resp.StatusCode
+	if info, ok := FromResponse(resp); ok {
+		p.Outcome = info.Outcome
+	}
+	return p
+}
+
+// WarmSitemap warms the cache with URLs of the sitemap (or URL manifest, see
+// ParseSitemap) at sitemapURL, as by Warm. Sitemaps of a sitemap index are
+// read as well. Sitemaps are fetched by Transport.Transport, past the cache.
+func (t *Transport) WarmSitemap(ctx context.Context, sitemapURL string, concurrency int, progress func(WarmProgress)) error {
+	sitemap, err := t.fetchSitemap(ctx, sitemapURL)
+	if err != nil {
+		return err
+	}
+	urls := sitemap.URLs
+	for i, u := range sitemap.Sitemaps {
+		if i >= maxSitemaps {
+			break
+		}
+		// sitemap indexes can't list other indexes
+		nested, err := t.fetchSitemap(ctx, u)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, nested.URLs...)
+	}
+	return t.Warm(ctx, urls, concurrency, progress)
+}
+
+// fetchSitemap fetches and parses the sitemap at url.
+func (t *Transport) fetchSitemap(ctx context.Context, url string) (*Sitemap, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("naivehttpcache: fetching sitemap %s: %s", url, resp.Status)
+	}
+	return ParseSitemap(resp.Body)
+}
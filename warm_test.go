@@ -0,0 +1,117 @@
+package naivehttpcache_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+func TestParseSitemap(t *testing.T) {
+	manifest := "# pages\nhttp://example.com/a\n\n  http://example.com/b  \n"
+	sitemap, err := naivehttpcache.ParseSitemap(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http://example.com/a", "http://example.com/b"}; !reflect.DeepEqual(sitemap.URLs, want) {
+		t.Fatalf("expected %q; got %q", want, sitemap.URLs)
+	}
+
+	if _, err := naivehttpcache.ParseSitemap(strings.NewReader("<urlset><url>")); err == nil {
+		t.Fatal("expected malformed sitemaps to fail")
+	}
+}
+
+func TestWarmSitemap(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<sitemap><loc>%[1]s/pages.xml.gz</loc></sitemap>
+	<sitemap><loc>%[1]s/manifest.txt</loc></sitemap>
+</sitemapindex>`, ts.URL)
+		case "/pages.xml.gz":
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			fmt.Fprintf(gz, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+	<url><loc>%[1]s/a</loc></url>
+	<url><loc> %[1]s/b </loc><lastmod>2026-01-01</lastmod></url>
+</urlset>`, ts.URL)
+			gz.Close()
+			w.Write(buf.Bytes())
+		case "/manifest.txt":
+			fmt.Fprintf(w, "%[1]s/c\n%[1]s/missing\n", ts.URL)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte(r.URL.Path))
+		}
+	}))
+	defer ts.Close()
+
+	transport := naivehttpcache.NewTransport(naivehttpcache.NewMemoryCache(0, 0),
+		naivehttpcache.WithMaxAge(time.Minute),
+	)
+	var progress []naivehttpcache.WarmProgress
+	if err := transport.WarmSitemap(context.Background(), ts.URL+"/sitemap.xml", 2, func(p naivehttpcache.WarmProgress) {
+		progress = append(progress, p)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(progress) != 4 {
+		t.Fatalf("expected progress of 4 URLs; got %+v", progress)
+	}
+	for i, p := range progress {
+		if p.Done != i+1 || p.Total != 4 || p.Err != nil || p.Outcome != naivehttpcache.OutcomeMiss {
+			t.Errorf("unexpected progress %+v", p)
+		}
+		want := http.StatusOK
+		if strings.HasSuffix(p.URL, "/missing") {
+			want = http.StatusNotFound
+		}
+		if p.StatusCode != want {
+			t.Errorf("%s: expected status %d; got %d", p.URL, want, p.StatusCode)
+		}
+	}
+
+	client := &http.Client{Transport: transport}
+	for _, path := range []string{"/a", "/b", "/c"} {
+		if resp, _ := mustGet(t, client, ts.URL+path); resp.Header.Get(naivehttpcache.XFromCache) != "1" {
+			t.Errorf("%s: expected to be warmed", path)
+		}
+	}
+
+	// sitemaps are not cached, pages are not fetched again
+	progress = nil
+	if err := transport.WarmSitemap(context.Background(), ts.URL+"/sitemap.xml", 0, func(p naivehttpcache.WarmProgress) {
+		progress = append(progress, p)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/sitemap.xml"] != 2 || hits["/a"] != 1 {
+		t.Fatalf("expected only sitemaps to be fetched again; got %v", hits)
+	}
+	for _, p := range progress {
+		if !strings.HasSuffix(p.URL, "/missing") && p.Outcome != naivehttpcache.OutcomeHit {
+			t.Errorf("expected warmed URLs to be hits; got %+v", p)
+		}
+	}
+}
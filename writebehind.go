@@ -0,0 +1,233 @@
+package naivehttpcache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// writeBehindWorkers is the number of queued writes that are written to the
+// cache at a time, see Transport.WriteBehind.
+const writeBehindWorkers = 4
+
+// writeRetryDelay is the delay before the first retry of a failed queued
+// write, it doubles with every retry.
+const writeRetryDelay = 100 * time.Millisecond
+
+// WithWriteBehind makes Transport store responses in the background, through
+// a queue of at most queue entries, retrying failed writes up to retries
+// times, see Transport.WriteBehind.
+func WithWriteBehind(queue, retries int) Option {
+	return func(o *Options) {
+		o.WriteBehind = queue
+		o.WriteRetries = retries
+	}
+}
+
+// QueuedWriteCount returns the number of entries that wait in the queue of t
+// to be written to the cache, see Transport.WriteBehind.
+func (t *Transport) QueuedWriteCount() int {
+	t.writeQueue.mu.Lock()
+	defer t.writeQueue.mu.Unlock()
+	return len(t.writeQueue.queued)
+}
+
+// DroppedWriteCount returns the number of entries that were not stored
+// because the queue of t was full, or because writing them failed after all
+// retries.
+func (t *Transport) DroppedWriteCount() uint64 {
+	return atomic.LoadUint64(&t.droppedWrites)
+}
+
+// flushWrites closes the queue of WriteBehind and waits for the writes that
+// are queued, or until ctx is done. Entries of responses that are stored
+// afterwards are written synchronously.
+func (t *Transport) flushWrites(ctx context.Context) error {
+	q := &t.writeQueue
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		if q.ch != nil {
+			close(q.ch)
+		}
+	}
+	q.mu.Unlock()
+	return waitContext(ctx, &q.workers)
+}
+
+// writeQueue is the queue of Transport.WriteBehind.
+type writeQueue struct {
+	mu sync.Mutex
+	ch chan *queuedWrite
+	// queued holds writes that wait in ch by their keys, writes of the same
+	// key are coalesced into one.
+	queued map[string]*queuedWrite
+	// writing holds writes that are being written by their keys.
+	writing map[string]*queuedWrite
+	closed  bool
+	workers sync.WaitGroup
+}
+
+// queuedWrite is a write of writeQueue.
+type queuedWrite struct {
+	// ctx carries values of the context of the store.
+	ctx context.Context
+	key string
+	val []byte
+	ttl time.Duration
+	// done is closed once the write is done, whether it succeeded or not.
+	done chan struct{}
+	// tickets are of the stores of the write, their bytes are held until
+	// it's done, so queued values count against MaxStoreBytes.
+	tickets []*storeTicket
+}
+
+// hold holds ticket until w is done.
+func (w *queuedWrite) hold(ticket *storeTicket) {
+	if ticket != nil {
+		ticket.hold()
+		w.tickets = append(w.tickets, ticket)
+	}
+}
+
+// unhold releases tickets of w once it's done.
+func (w *queuedWrite) unhold() {
+	for _, ticket := range w.tickets {
+		ticket.unhold()
+	}
+	w.tickets = nil
+}
+
+// enqueueWrite queues writing val under key with ttl to the cache, with values
+// of ctx. False means that the queue is closed and the write has to be done
+// synchronously.
+func (t *Transport) enqueueWrite(ctx context.Context, key string, val []byte, ttl time.Duration) bool {
+	q := &t.writeQueue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return false
+	}
+	if w, ok := q.queued[key]; ok {
+		w.ctx, w.val, w.ttl = detachedContext{ctx}, val, ttl
+		w.hold(storeTicketOf(ctx))
+		return true
+	}
+	if q.ch == nil {
+		q.ch = make(chan *queuedWrite, t.WriteBehind)
+		q.queued = make(map[string]*queuedWrite)
+		q.writing = make(map[string]*queuedWrite)
+		q.workers.Add(writeBehindWorkers)
+		for i := 0; i < writeBehindWorkers; i++ {
+			go t.writeBehind()
+		}
+	}
+	w := &queuedWrite{ctx: detachedContext{ctx}, key: key, val: val, ttl: ttl, done: make(chan struct{})}
+	select {
+	case q.ch <- w:
+		q.queued[key] = w
+		w.hold(storeTicketOf(ctx))
+	default:
+		atomic.AddUint64(&t.droppedWrites, 1)
+		t.countStore(ctx, false)
+	}
+	return true
+}
+
+// writeBehind writes queued writes until the queue is closed.
+func (t *Transport) writeBehind() {
+	q := &t.writeQueue
+	defer q.workers.Done()
+	for w := range q.ch {
+		q.mu.Lock()
+		if q.queued[w.key] != w {
+			// the key was deleted meanwhile
+			q.mu.Unlock()
+			w.unhold()
+			continue
+		}
+		delete(q.queued, w.key)
+		prev := q.writing[w.key]
+		q.writing[w.key] = w
+		q.mu.Unlock()
+
+		// writes of the same key land in order
+		if prev != nil {
+			<-prev.done
+		}
+		ok := t.writeQueued(w)
+		t.countStore(w.ctx, ok)
+		if ok {
+			t.stored(w.ctx, w.key)
+		} else {
+			atomic.AddUint64(&t.droppedWrites, 1)
+		}
+
+		q.mu.Lock()
+		if q.writing[w.key] == w {
+			delete(q.writing, w.key)
+		}
+		q.mu.Unlock()
+		w.unhold()
+		close(w.done)
+	}
+}
+
+// writeQueued writes w to the cache, retrying it up to WriteRetries times, and
+// reports whether it succeeded. Failures are handled as by BackendFailOpen.
+func (t *Transport) writeQueued(w *queuedWrite) bool {
+	delay := writeRetryDelay
+	for retry := 0; ; retry++ {
+		if bypass, _ := t.bypassBackend("set", w.key); bypass {
+			return false
+		}
+		err := t.trySet(w.ctx, w.key, w.val, w.ttl)
+		if err == nil {
+			t.backendHealthy(true)
+			return true
+		}
+		t.backendError("set", w.key, err)
+		if retry >= t.WriteRetries {
+			return false
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// queuedVal returns the value that is queued (or being written) under key,
+// if any, so entries can be read before they land in the cache.
+func (t *Transport) queuedVal(key string) ([]byte, bool) {
+	q := &t.writeQueue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if w, ok := q.queued[key]; ok {
+		return w.val, true
+	}
+	if w, ok := q.writing[key]; ok {
+		return w.val, true
+	}
+	return nil, false
+}
+
+// cancelWrite drops the queued write of key, if any, and waits for the one
+// that is being written, so it doesn't land after key is deleted.
+func (t *Transport) cancelWrite(ctx context.Context, key string) error {
+	q := &t.writeQueue
+	q.mu.Lock()
+	delete(q.queued, key)
+	w := q.writing[key]
+	q.mu.Unlock()
+
+	if w == nil {
+		return nil
+	}
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,125 @@
+package naivehttpcache_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blukai/naivehttpcache"
+)
+
+// blockingCache is MemoryCache which writes wait for release to be closed.
+type blockingCache struct {
+	*naivehttpcache.MemoryCache
+	release chan struct{}
+}
+
+func (c *blockingCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	<-c.release
+	return c.MemoryCache.Set(ctx, key, val, ttl)
+}
+
+// flakyCache is MemoryCache which writes fail every other time.
+type flakyCache struct {
+	*naivehttpcache.MemoryCache
+	mu   sync.Mutex
+	sets int
+}
+
+func (c *flakyCache) Set(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	c.sets++
+	fail := c.sets%2 == 1
+	c.mu.Unlock()
+	if fail {
+		return errBackend
+	}
+	return c.MemoryCache.Set(ctx, key, val, ttl)
+}
+
+func TestWriteBehind(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer ts.Close()
+
+	t.Run("queued", func(t *testing.T) {
+		cache := &blockingCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0), release: make(chan struct{})}
+		transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithWriteBehind(16, 0))
+		client := &http.Client{Transport: transport}
+
+		// reading the body doesn't wait for the cache
+		mustGet(t, client, ts.URL)
+		if resp, body := mustGet(t, client, ts.URL); resp.Header.Get(naivehttpcache.XFromCache) != "1" || body != "hello" {
+			t.Fatal("expected the queued entry to be served")
+		}
+		if cache.Len() != 0 {
+			t.Fatal("expected the entry to wait for the cache")
+		}
+
+		close(cache.release)
+		transport.Close(context.Background())
+		if cache.Len() != 1 || transport.QueuedWriteCount() != 0 {
+			t.Fatalf("expected the entry to be written on Close; got %d entries", cache.Len())
+		}
+	})
+
+	t.Run("full", func(t *testing.T) {
+		cache := &blockingCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0), release: make(chan struct{})}
+		transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithWriteBehind(1, 0))
+		client := &http.Client{Transport: transport}
+
+		const n = 10
+		for i := 0; i < n; i++ {
+			mustGet(t, client, fmt.Sprintf("%s/%d", ts.URL, i))
+		}
+		close(cache.release)
+		transport.Close(context.Background())
+		dropped := transport.DroppedWriteCount()
+		// the queue holds one entry, workers hold a few more
+		if dropped < n/2 || cache.Len()+int(dropped) != n {
+			t.Fatalf("expected entries over the queue to be dropped; got %d dropped and %d written", dropped, cache.Len())
+		}
+	})
+
+	t.Run("retries", func(t *testing.T) {
+		cache := &flakyCache{MemoryCache: naivehttpcache.NewMemoryCache(0, 0)}
+		transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithWriteBehind(16, 1))
+		client := &http.Client{Transport: transport}
+
+		mustGet(t, client, ts.URL)
+		transport.Close(context.Background())
+		if cache.Len() != 1 || transport.BackendErrorCount() != 1 || transport.DroppedWriteCount() != 0 {
+			t.Fatalf("expected the failed write to be retried; got %d entries and %d errors", cache.Len(), transport.BackendErrorCount())
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		cache := naivehttpcache.NewMemoryCache(0, 0)
+		transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithWriteBehind(16, 0))
+		client := &http.Client{Transport: transport}
+
+		mustGet(t, client, ts.URL)
+		if err := transport.Purge(context.Background(), ts.URL); err != nil {
+			t.Fatal(err)
+		}
+		transport.Close(context.Background())
+		if cache.Len() != 0 {
+			t.Fatal("expected the purged entry not to be written")
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		cache := naivehttpcache.NewMemoryCache(0, 0)
+		transport := naivehttpcache.NewTransport(cache, naivehttpcache.WithWriteBehind(16, 0))
+		transport.Close(context.Background())
+		mustGet(t, &http.Client{Transport: transport}, ts.URL)
+		if cache.Len() != 1 {
+			t.Fatal("expected entries to be written synchronously once closed")
+		}
+	})
+}